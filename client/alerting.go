@@ -0,0 +1,331 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/grafana/grafana-openapi-client-go/client/provisioning"
+	"github.com/grafana/grafana-openapi-client-go/models"
+)
+
+// AlertingClient defines operations for provisioning Grafana-managed
+// alerting resources.
+type AlertingClient interface {
+	// ListAlertRuleGroups lists the alert rule groups of a folder, or of all
+	// the folders when folderUID is empty.
+	ListAlertRuleGroups(folderUID string) ([]*AlertRuleGroup, error)
+
+	// GetAlertRuleGroup retrieves an alert rule group by its folder and title.
+	// It returns nil when the group does not exist.
+	GetAlertRuleGroup(folderUID, group string) (*AlertRuleGroup, error)
+
+	// PutAlertRuleGroup creates or replaces an alert rule group in the folder
+	// identified by its FolderUID.
+	PutAlertRuleGroup(group *AlertRuleGroup) error
+
+	// DeleteAlertRuleGroup removes an alert rule group and its rules.
+	DeleteAlertRuleGroup(folderUID, group string) error
+
+	// ListContactPoints lists the contact points of the instance.
+	ListContactPoints() ([]*ContactPoint, error)
+
+	// UploadContactPoint creates or updates a contact point, identified by its
+	// UID. It is updated when its UID is one of the existing contact points,
+	// as returned by ListContactPoints, so that uploading many contact points
+	// lists them once.
+	UploadContactPoint(contactPoint *ContactPoint, existing []*ContactPoint) error
+
+	// DeleteContactPoint removes a contact point identified by its UID.
+	DeleteContactPoint(uid string) error
+
+	// ListNotificationTemplates lists the notification templates of the instance.
+	ListNotificationTemplates() ([]*NotificationTemplate, error)
+
+	// PutNotificationTemplate creates or replaces a notification template.
+	PutNotificationTemplate(name, template string) error
+
+	// DeleteNotificationTemplate removes a notification template identified by its name.
+	DeleteNotificationTemplate(name string) error
+
+	// ListMuteTimings lists the mute timings of the instance.
+	ListMuteTimings() ([]*MuteTiming, error)
+
+	// UploadMuteTiming creates or updates a mute timing, identified by its name.
+	UploadMuteTiming(muteTiming *MuteTiming) error
+
+	// DeleteMuteTiming removes a mute timing identified by its name.
+	DeleteMuteTiming(name string) error
+
+	// GetNotificationPolicyTree retrieves the notification policy tree.
+	GetNotificationPolicyTree() (*NotificationPolicy, error)
+
+	// SetNotificationPolicyTree replaces the notification policy tree.
+	SetNotificationPolicyTree(policy *NotificationPolicy) error
+}
+
+// AlertRuleGroup is a group of alert rules evaluated together, as exposed by
+// the Grafana alerting provisioning API.
+type AlertRuleGroup = models.AlertRuleGroup
+
+// AlertRule is an alert rule of an AlertRuleGroup.
+type AlertRule = models.ProvisionedAlertRule
+
+// ContactPoint is an integration alert notifications are sent to.
+type ContactPoint = models.EmbeddedContactPoint
+
+// NotificationTemplate is a named template notifications can use.
+type NotificationTemplate = models.NotificationTemplate
+
+// MuteTiming is a named set of time intervals notifications are muted during.
+type MuteTiming = models.MuteTimeInterval
+
+// NotificationPolicy is a node of the notification policy tree, routing
+// alerts to contact points.
+type NotificationPolicy = models.Route
+
+func (sc *StackClient) ListAlertRuleGroups(folderUID string) ([]*AlertRuleGroup, error) {
+
+	res, err := sc.httpApi.Provisioning.GetAlertRules()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list alert rules: %w", err)
+	}
+
+	type groupKey struct {
+		folderUID string
+		title     string
+	}
+
+	keys := []groupKey{}
+	seen := map[groupKey]struct{}{}
+	for _, rule := range res.Payload {
+		if rule.FolderUID == nil || rule.RuleGroup == nil {
+			continue
+		}
+		if folderUID != "" && *rule.FolderUID != folderUID {
+			continue
+		}
+		key := groupKey{folderUID: *rule.FolderUID, title: *rule.RuleGroup}
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].folderUID != keys[j].folderUID {
+			return keys[i].folderUID < keys[j].folderUID
+		}
+		return keys[i].title < keys[j].title
+	})
+
+	groups := make([]*AlertRuleGroup, 0, len(keys))
+	for _, key := range keys {
+		group, err := sc.GetAlertRuleGroup(key.folderUID, key.title)
+		if err != nil {
+			return nil, err
+		}
+		if group != nil {
+			groups = append(groups, group)
+		}
+	}
+
+	return groups, nil
+}
+
+func (sc *StackClient) GetAlertRuleGroup(folderUID, group string) (*AlertRuleGroup, error) {
+
+	res, err := sc.httpApi.Provisioning.GetAlertRuleGroup(group, folderUID)
+
+	if err != nil {
+		var notFound *provisioning.GetAlertRuleGroupNotFound
+		if errors.As(err, &notFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get alert rule group %s in folder %s: %w", group, folderUID, err)
+	}
+
+	if res.Payload == nil {
+		return nil, fmt.Errorf("received no alert rule group data for %s in folder %s", group, folderUID)
+	}
+
+	return res.Payload, nil
+}
+
+func (sc *StackClient) PutAlertRuleGroup(group *AlertRuleGroup) error {
+
+	params := provisioning.NewPutAlertRuleGroupParams().
+		WithFolderUID(group.FolderUID).
+		WithGroup(group.Title).
+		WithBody(group)
+
+	_, err := sc.httpApi.Provisioning.PutAlertRuleGroup(params)
+
+	if err != nil {
+		return fmt.Errorf("failed to put alert rule group %s in folder %s: %w", group.Title, group.FolderUID, err)
+	}
+
+	return nil
+}
+
+func (sc *StackClient) DeleteAlertRuleGroup(folderUID, group string) error {
+
+	_, err := sc.httpApi.Provisioning.DeleteAlertRuleGroup(group, folderUID)
+
+	if err != nil {
+		return fmt.Errorf("failed to delete alert rule group %s in folder %s: %w", group, folderUID, err)
+	}
+
+	return nil
+}
+
+func (sc *StackClient) ListContactPoints() ([]*ContactPoint, error) {
+
+	res, err := sc.httpApi.Provisioning.GetContactpoints(provisioning.NewGetContactpointsParams())
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list contact points: %w", err)
+	}
+
+	return res.Payload, nil
+}
+
+func (sc *StackClient) UploadContactPoint(contactPoint *ContactPoint, existing []*ContactPoint) error {
+
+	exists := false
+	for _, candidate := range existing {
+		if contactPoint.UID != "" && candidate.UID == contactPoint.UID {
+			exists = true
+		}
+	}
+
+	var err error
+	if exists {
+		_, err = sc.httpApi.Provisioning.PutContactpoint(provisioning.NewPutContactpointParams().
+			WithUID(contactPoint.UID).
+			WithBody(contactPoint))
+	} else {
+		_, err = sc.httpApi.Provisioning.PostContactpoints(provisioning.NewPostContactpointsParams().
+			WithBody(contactPoint))
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to upload contact point %s: %w", contactPoint.Name, err)
+	}
+
+	return nil
+}
+
+func (sc *StackClient) DeleteContactPoint(uid string) error {
+
+	_, err := sc.httpApi.Provisioning.DeleteContactpoints(uid)
+
+	if err != nil {
+		return fmt.Errorf("failed to delete contact point %s: %w", uid, err)
+	}
+
+	return nil
+}
+
+func (sc *StackClient) ListNotificationTemplates() ([]*NotificationTemplate, error) {
+
+	res, err := sc.httpApi.Provisioning.GetTemplates()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notification templates: %w", err)
+	}
+
+	return res.Payload, nil
+}
+
+func (sc *StackClient) PutNotificationTemplate(name, template string) error {
+
+	_, err := sc.httpApi.Provisioning.PutTemplate(provisioning.NewPutTemplateParams().
+		WithName(name).
+		WithBody(&models.NotificationTemplateContent{Template: template}))
+
+	if err != nil {
+		return fmt.Errorf("failed to put notification template %s: %w", name, err)
+	}
+
+	return nil
+}
+
+func (sc *StackClient) DeleteNotificationTemplate(name string) error {
+
+	_, err := sc.httpApi.Provisioning.DeleteTemplate(provisioning.NewDeleteTemplateParams().WithName(name))
+
+	if err != nil {
+		return fmt.Errorf("failed to delete notification template %s: %w", name, err)
+	}
+
+	return nil
+}
+
+func (sc *StackClient) ListMuteTimings() ([]*MuteTiming, error) {
+
+	res, err := sc.httpApi.Provisioning.GetMuteTimings()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list mute timings: %w", err)
+	}
+
+	return res.Payload, nil
+}
+
+func (sc *StackClient) UploadMuteTiming(muteTiming *MuteTiming) error {
+
+	_, err := sc.httpApi.Provisioning.GetMuteTiming(muteTiming.Name)
+
+	var notFound *provisioning.GetMuteTimingNotFound
+	switch {
+	case errors.As(err, &notFound):
+		_, err = sc.httpApi.Provisioning.PostMuteTiming(provisioning.NewPostMuteTimingParams().
+			WithBody(muteTiming))
+	case err == nil:
+		_, err = sc.httpApi.Provisioning.PutMuteTiming(provisioning.NewPutMuteTimingParams().
+			WithName(muteTiming.Name).
+			WithBody(muteTiming))
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to upload mute timing %s: %w", muteTiming.Name, err)
+	}
+
+	return nil
+}
+
+func (sc *StackClient) DeleteMuteTiming(name string) error {
+
+	_, err := sc.httpApi.Provisioning.DeleteMuteTiming(provisioning.NewDeleteMuteTimingParams().WithName(name))
+
+	if err != nil {
+		return fmt.Errorf("failed to delete mute timing %s: %w", name, err)
+	}
+
+	return nil
+}
+
+func (sc *StackClient) GetNotificationPolicyTree() (*NotificationPolicy, error) {
+
+	res, err := sc.httpApi.Provisioning.GetPolicyTree()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification policy tree: %w", err)
+	}
+
+	return res.Payload, nil
+}
+
+func (sc *StackClient) SetNotificationPolicyTree(policy *NotificationPolicy) error {
+
+	_, err := sc.httpApi.Provisioning.PutPolicyTree(provisioning.NewPutPolicyTreeParams().WithBody(policy))
+
+	if err != nil {
+		return fmt.Errorf("failed to set notification policy tree: %w", err)
+	}
+
+	return nil
+}
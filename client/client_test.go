@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"path"
 	"testing"
 
 	testutils "github.com/adevinta/go-testutils-toolkit"
@@ -189,6 +190,36 @@ func TestNewStackClient(t *testing.T) {
 		assert.NotNil(t, stackClient)
 	})
 
+	t.Run("should create an admin stack client", func(t *testing.T) {
+		cloudClient, err := NewCloudClientWithHttpClient(&http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				var payload map[string]interface{}
+				require.NoError(t, json.NewDecoder(req.Body).Decode(&payload))
+
+				switch req.URL.String() {
+				case "https://grafana.com/api/instances/1234/api/serviceaccounts":
+					assert.Equal(t, "Admin", payload["role"])
+					assert.Contains(t, payload["name"], "cpr-dashboard-admin-")
+					return testutils.NewHTTPResponseBuilder().
+						WithJsonBody(map[string]interface{}{"id": 5678, "name": payload["name"], "role": "Admin"}).
+						WithStatusCode(http.StatusOK).Build(), nil
+				case "https://grafana.com/api/instances/1234/api/serviceaccounts/5678/tokens":
+					return testutils.NewHTTPResponseBuilder().
+						WithJsonBody(map[string]interface{}{"id": 9012, "key": "fake-token-key", "name": payload["name"]}).
+						WithStatusCode(http.StatusOK).Build(), nil
+				default:
+					t.Errorf("unexpected request: %s", req.URL.String())
+					return nil, fmt.Errorf("unexpected request: %s", req.URL.String())
+				}
+			}),
+		})
+		require.NoError(t, err)
+
+		stackClient, err := cloudClient.NewStackClientWithRole(testStack, RoleAdmin)
+		assert.NoError(t, err)
+		assert.NotNil(t, stackClient)
+	})
+
 	t.Run("should fail when service account creation fails", func(t *testing.T) {
 		cloudClient, err := NewCloudClientWithHttpClient(&http.Client{
 			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
@@ -290,6 +321,39 @@ func TestEnsureFolder(t *testing.T) {
 		assert.Equal(t, "new-folder-uid", folder.UID)
 	})
 
+	t.Run("should create folder with the given uid", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		created := false
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				folders := []map[string]interface{}{}
+				if req.Method == "POST" {
+					payload := map[string]interface{}{}
+					require.NoError(t, json.NewDecoder(req.Body).Decode(&payload))
+					assert.Equal(t, map[string]interface{}{"title": "test", "uid": "fixed-uid"}, payload)
+					created = true
+					return testutils.NewHTTPResponseBuilder().
+						WithJsonBody(map[string]interface{}{"uid": "fixed-uid", "title": "test"}).
+						WithStatusCode(http.StatusOK).Build(), nil
+				}
+				if created {
+					folders = append(folders, map[string]interface{}{"uid": "fixed-uid", "title": "test"})
+				}
+				return testutils.NewHTTPResponseBuilder().
+					WithJsonBody(folders).
+					WithStatusCode(http.StatusOK).Build(), nil
+			}),
+		})
+
+		assert.NoError(t, err)
+
+		folder, err := stackClient.EnsureFolderWithUID(nil, "test", "fixed-uid")
+		assert.NoError(t, err)
+		assert.Equal(t, "fixed-uid", folder.UID)
+	})
+
 	t.Run("should fail when folder creation fails", func(t *testing.T) {
 		cloudClient, err := buildCloudClient(t)
 		assert.NoError(t, err)
@@ -498,3 +562,1141 @@ func TestUploadDashboard(t *testing.T) {
 		assert.Contains(t, err.Error(), "failed to updload dashboard")
 	})
 }
+
+func TestListPlugins(t *testing.T) {
+	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+
+	t.Run("should list installed plugins", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				assert.Equal(t, "https://test-stack.grafana.net/api/plugins", req.URL.String())
+				assert.Equal(t, "GET", req.Method)
+				return testutils.NewHTTPResponseBuilder().
+					WithJsonBody([]map[string]interface{}{
+						{"id": "timeseries", "name": "Time series", "type": "panel", "enabled": true},
+						{"id": "prometheus", "name": "Prometheus", "type": "datasource", "enabled": true},
+					}).
+					WithStatusCode(http.StatusOK).Build(), nil
+			}),
+		})
+
+		assert.NoError(t, err)
+
+		plugins, err := stackClient.ListPlugins()
+		assert.NoError(t, err)
+		assert.Equal(t, []Plugin{
+			{ID: "timeseries", Name: "Time series", Type: "panel", Enabled: true},
+			{ID: "prometheus", Name: "Prometheus", Type: "datasource", Enabled: true},
+		}, plugins)
+	})
+
+	t.Run("should handle server errors", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				return testutils.NewHTTPResponseBuilder().
+					WithJsonBody(map[string]interface{}{"message": "Internal server error"}).
+					WithStatusCode(http.StatusInternalServerError).Build(), nil
+			}),
+		})
+
+		assert.NoError(t, err)
+
+		plugins, err := stackClient.ListPlugins()
+		assert.Error(t, err)
+		assert.Nil(t, plugins)
+		assert.Contains(t, err.Error(), "failed to list plugins")
+	})
+}
+
+func TestListFolders(t *testing.T) {
+	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+
+	t.Run("should list the subfolders of a folder", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				assert.Equal(t, "GET", req.Method)
+				assert.Equal(t, "https://test-stack.grafana.net/api/folders?parentUid=parent-uid", req.URL.String())
+				return testutils.NewHTTPResponseBuilder().
+					WithJsonBody([]map[string]interface{}{
+						{"uid": "child-1", "title": "Child 1"},
+						{"uid": "child-2", "title": "Child 2"},
+					}).
+					WithStatusCode(http.StatusOK).Build(), nil
+			}),
+		})
+
+		assert.NoError(t, err)
+
+		folders, err := stackClient.ListFolders(&Folder{UID: "parent-uid", Title: "Parent"})
+		assert.NoError(t, err)
+		assert.Equal(t, []*Folder{
+			{UID: "child-1", Title: "Child 1"},
+			{UID: "child-2", Title: "Child 2"},
+		}, folders)
+	})
+}
+
+func TestListDashboardIDs(t *testing.T) {
+	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+
+	t.Run("should list the dashboards holding a tag", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				assert.Equal(t, "GET", req.Method)
+				assert.Equal(t, "https://test-stack.grafana.net/api/search?limit=1000&page=1&tag=pr-1234&type=dash-db", req.URL.String())
+				return testutils.NewHTTPResponseBuilder().
+					WithJsonBody([]map[string]interface{}{
+						{"uid": "dash-1", "title": "Dashboard 1"},
+						{"uid": "dash-2", "title": "Dashboard 2"},
+					}).
+					WithStatusCode(http.StatusOK).Build(), nil
+			}),
+		})
+
+		assert.NoError(t, err)
+
+		uids, err := stackClient.ListDashboardIDs("pr-1234")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"dash-1", "dash-2"}, uids)
+	})
+
+	t.Run("should list every page of dashboards", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				assert.Empty(t, req.URL.Query().Get("tag"))
+				hits := []map[string]interface{}{}
+				switch req.URL.Query().Get("page") {
+				case "1":
+					for i := 0; i < 1000; i++ {
+						hits = append(hits, map[string]interface{}{"uid": fmt.Sprintf("dash-%d", i)})
+					}
+				case "2":
+					hits = append(hits, map[string]interface{}{"uid": "last"})
+				default:
+					t.Errorf("unexpected page %s", req.URL.Query().Get("page"))
+				}
+				return testutils.NewHTTPResponseBuilder().
+					WithJsonBody(hits).
+					WithStatusCode(http.StatusOK).Build(), nil
+			}),
+		})
+
+		assert.NoError(t, err)
+
+		uids, err := stackClient.ListDashboardIDs("")
+		assert.NoError(t, err)
+		assert.Len(t, uids, 1001)
+		assert.Equal(t, "last", uids[1000])
+	})
+}
+
+func TestDeleteFolder(t *testing.T) {
+	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+
+	t.Run("should delete a folder", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				assert.Equal(t, "DELETE", req.Method)
+				assert.Equal(t, "https://test-stack.grafana.net/api/folders/folder-uid", req.URL.String())
+				return testutils.NewHTTPResponseBuilder().
+					WithJsonBody(map[string]interface{}{"message": "Folder deleted"}).
+					WithStatusCode(http.StatusOK).Build(), nil
+			}),
+		})
+
+		assert.NoError(t, err)
+
+		err = stackClient.DeleteFolder("folder-uid")
+		assert.NoError(t, err)
+	})
+
+	t.Run("should handle server errors", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				return testutils.NewHTTPResponseBuilder().
+					WithJsonBody(map[string]interface{}{"message": "Internal server error"}).
+					WithStatusCode(http.StatusInternalServerError).Build(), nil
+			}),
+		})
+
+		assert.NoError(t, err)
+
+		err = stackClient.DeleteFolder("folder-uid")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to delete folder")
+	})
+}
+
+func TestDashboardModel(t *testing.T) {
+	t.Run("should round-trip unknown fields", func(t *testing.T) {
+		source := `{
+			"uid": "dash-1",
+			"title": "Dashboard",
+			"id": null,
+			"tags": [],
+			"refresh": "5m",
+			"schemaVersion": 39,
+			"panels": [
+				{"id": 1, "type": "row", "title": "Row", "collapsed": true, "gridPos": {"h": 1, "w": 24, "x": 0, "y": 0}, "panels": [
+					{"id": 2, "type": "timeseries", "datasource": "grafanacloud-prom", "fieldConfig": {"defaults": {"unit": "s"}}}
+				]},
+				{"id": 3, "type": "stat", "datasource": {"type": "loki", "uid": "logs-uid"}, "targets": [{"refId": "A", "expr": "up", "hide": false}]}
+			],
+			"templating": {"list": [{"name": "env", "type": "custom", "query": "dev,prod", "multi": true, "current": {"text": "dev", "value": "dev"}}]},
+			"annotations": {"list": [{"name": "Deploys", "datasource": {"uid": "logs-uid"}, "enable": true}]},
+			"links": [{"title": "Docs", "type": "link", "url": "https://example.com", "targetBlank": true}]
+		}`
+
+		model, err := DecodeDashboardModel([]byte(source))
+		require.NoError(t, err)
+
+		assert.Equal(t, "dash-1", model.UID)
+		assert.Len(t, model.AllPanels(), 3)
+		assert.Equal(t, "grafanacloud-prom", model.AllPanels()[1].Datasource.Reference())
+		assert.Equal(t, "logs-uid", model.AllPanels()[2].Datasource.Reference())
+		assert.Equal(t, "env", model.Variables()[0].Name)
+
+		encoded, err := json.Marshal(model)
+		require.NoError(t, err)
+		assert.JSONEq(t, source, string(encoded))
+	})
+
+	t.Run("should keep modified fields and drop deleted ones", func(t *testing.T) {
+		model, err := DecodeDashboardModel(map[string]interface{}{
+			"id":      12,
+			"title":   "Dashboard",
+			"version": 3,
+			"templating": map[string]interface{}{
+				"list": []interface{}{map[string]interface{}{"name": "ds", "type": "datasource"}},
+			},
+		})
+		require.NoError(t, err)
+
+		model.ID = nil
+		model.Delete("id")
+		model.Delete("version")
+		model.Variables()[0].Current = NewVariableOption("prom", "prom-uid", false)
+		require.NoError(t, model.SetExtra("folderUid", "folder-uid"))
+
+		dash, err := model.JSON()
+		require.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{
+			"title":     "Dashboard",
+			"folderUid": "folder-uid",
+			"templating": map[string]interface{}{
+				"list": []interface{}{map[string]interface{}{
+					"name":    "ds",
+					"type":    "datasource",
+					"current": map[string]interface{}{"selected": false, "text": "prom", "value": "prom-uid"},
+				}},
+			},
+		}, dash)
+	})
+
+	t.Run("should report malformed dashboards", func(t *testing.T) {
+		for _, source := range []string{
+			`[]`,
+			`{"templating": "oops"}`,
+			`{"templating": {"list": ["oops"]}}`,
+			`{"panels": {"id": 1}}`,
+			`{"tags": "oops"}`,
+		} {
+			_, err := DecodeDashboardModel([]byte(source))
+			assert.Error(t, err, source)
+		}
+	})
+}
+
+func TestLibraryPanels(t *testing.T) {
+	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+
+	t.Run("should list the library panels of a folder across pages", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				assert.Equal(t, "GET", req.Method)
+				assert.Equal(t, "/api/library-elements", req.URL.Path)
+				assert.Equal(t, "1", req.URL.Query().Get("kind"))
+				assert.Equal(t, "folder-uid", req.URL.Query().Get("folderFilterUIDs"))
+				page := req.URL.Query().Get("page")
+				return testutils.NewHTTPResponseBuilder().
+					WithJsonBody(map[string]interface{}{
+						"result": map[string]interface{}{
+							"totalCount": 2,
+							"elements": []map[string]interface{}{
+								{"uid": "panel-" + page, "name": "Panel " + page, "folderUid": "folder-uid", "version": 3, "model": map[string]interface{}{"type": "stat"}},
+							},
+						},
+					}).
+					WithStatusCode(http.StatusOK).Build(), nil
+			}),
+		})
+		assert.NoError(t, err)
+
+		panels, err := stackClient.ListLibraryPanels("folder-uid")
+		assert.NoError(t, err)
+		assert.Equal(t, []*LibraryPanel{
+			{UID: "panel-1", Name: "Panel 1", FolderUID: "folder-uid", Version: 3, Model: map[string]interface{}{"type": "stat"}},
+			{UID: "panel-2", Name: "Panel 2", FolderUID: "folder-uid", Version: 3, Model: map[string]interface{}{"type": "stat"}},
+		}, panels)
+	})
+
+	t.Run("should return nil for a missing library panel", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				assert.Equal(t, "GET", req.Method)
+				assert.Equal(t, "https://test-stack.grafana.net/api/library-elements/missing", req.URL.String())
+				return testutils.NewHTTPResponseBuilder().
+					WithJsonBody(map[string]interface{}{"message": "library element could not be found"}).
+					WithStatusCode(http.StatusNotFound).Build(), nil
+			}),
+		})
+		assert.NoError(t, err)
+
+		panel, err := stackClient.GetLibraryPanel("missing")
+		assert.NoError(t, err)
+		assert.Nil(t, panel)
+	})
+
+	t.Run("should create a missing library panel", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		requests := []string{}
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				requests = append(requests, req.Method+" "+req.URL.Path)
+				if req.Method == "GET" {
+					return testutils.NewHTTPResponseBuilder().
+						WithJsonBody(map[string]interface{}{"message": "library element could not be found"}).
+						WithStatusCode(http.StatusNotFound).Build(), nil
+				}
+				payload := map[string]interface{}{}
+				require.NoError(t, json.NewDecoder(req.Body).Decode(&payload))
+				assert.Equal(t, map[string]interface{}{
+					"uid":       "panel-uid",
+					"name":      "Panel",
+					"folderUid": "folder-uid",
+					"kind":      float64(1),
+					"model":     map[string]interface{}{"type": "stat"},
+				}, payload)
+				return testutils.NewHTTPResponseBuilder().
+					WithJsonBody(map[string]interface{}{"result": payload}).
+					WithStatusCode(http.StatusOK).Build(), nil
+			}),
+		})
+		assert.NoError(t, err)
+
+		err = stackClient.UploadLibraryPanel(&LibraryPanel{UID: "panel-uid", Name: "Panel", FolderUID: "folder-uid", Model: map[string]interface{}{"type": "stat"}})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"GET /api/library-elements/panel-uid", "POST /api/library-elements"}, requests)
+	})
+
+	t.Run("should update an existing library panel", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		requests := []string{}
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				requests = append(requests, req.Method+" "+req.URL.Path)
+				if req.Method == "GET" {
+					return testutils.NewHTTPResponseBuilder().
+						WithJsonBody(map[string]interface{}{"result": map[string]interface{}{"uid": "panel-uid", "name": "Panel", "version": 4}}).
+						WithStatusCode(http.StatusOK).Build(), nil
+				}
+				payload := map[string]interface{}{}
+				require.NoError(t, json.NewDecoder(req.Body).Decode(&payload))
+				assert.Equal(t, float64(4), payload["version"])
+				return testutils.NewHTTPResponseBuilder().
+					WithJsonBody(map[string]interface{}{"result": payload}).
+					WithStatusCode(http.StatusOK).Build(), nil
+			}),
+		})
+		assert.NoError(t, err)
+
+		err = stackClient.UploadLibraryPanel(&LibraryPanel{UID: "panel-uid", Name: "Panel", FolderUID: "folder-uid", Model: map[string]interface{}{"type": "stat"}})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"GET /api/library-elements/panel-uid", "PATCH /api/library-elements/panel-uid"}, requests)
+	})
+
+	t.Run("should delete a library panel", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				assert.Equal(t, "DELETE", req.Method)
+				assert.Equal(t, "https://test-stack.grafana.net/api/library-elements/panel-uid", req.URL.String())
+				return testutils.NewHTTPResponseBuilder().
+					WithJsonBody(map[string]interface{}{"message": "Library element deleted"}).
+					WithStatusCode(http.StatusOK).Build(), nil
+			}),
+		})
+		assert.NoError(t, err)
+
+		err = stackClient.DeleteLibraryPanel("panel-uid")
+		assert.NoError(t, err)
+	})
+}
+
+func TestAlertRuleGroups(t *testing.T) {
+	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+
+	t.Run("should list the alert rule groups of a folder", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				assert.Equal(t, "GET", req.Method)
+				switch req.URL.Path {
+				case "/api/v1/provisioning/alert-rules":
+					return testutils.NewHTTPResponseBuilder().
+						WithJsonBody([]map[string]interface{}{
+							{"uid": "rule-1", "title": "Rule 1", "folderUID": "folder-uid", "ruleGroup": "latency"},
+							{"uid": "rule-2", "title": "Rule 2", "folderUID": "folder-uid", "ruleGroup": "errors"},
+							{"uid": "rule-3", "title": "Rule 3", "folderUID": "folder-uid", "ruleGroup": "errors"},
+							{"uid": "rule-4", "title": "Rule 4", "folderUID": "other-folder-uid", "ruleGroup": "errors"},
+						}).
+						WithStatusCode(http.StatusOK).Build(), nil
+				case "/api/v1/provisioning/folder/folder-uid/rule-groups/errors", "/api/v1/provisioning/folder/folder-uid/rule-groups/latency":
+					return testutils.NewHTTPResponseBuilder().
+						WithJsonBody(map[string]interface{}{
+							"title":     path.Base(req.URL.Path),
+							"folderUid": "folder-uid",
+							"interval":  60,
+							"rules":     []map[string]interface{}{},
+						}).
+						WithStatusCode(http.StatusOK).Build(), nil
+				default:
+					t.Errorf("unexpected request: %s", req.URL.String())
+					return nil, fmt.Errorf("unexpected request: %s", req.URL.String())
+				}
+			}),
+		})
+		assert.NoError(t, err)
+
+		groups, err := stackClient.ListAlertRuleGroups("folder-uid")
+		assert.NoError(t, err)
+		assert.Equal(t, []*AlertRuleGroup{
+			{Title: "errors", FolderUID: "folder-uid", Interval: 60, Rules: []*AlertRule{}},
+			{Title: "latency", FolderUID: "folder-uid", Interval: 60, Rules: []*AlertRule{}},
+		}, groups)
+	})
+
+	t.Run("should return nil for a missing alert rule group", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				assert.Equal(t, "https://test-stack.grafana.net/api/v1/provisioning/folder/folder-uid/rule-groups/errors", req.URL.String())
+				return testutils.NewHTTPResponseBuilder().
+					WithJsonBody(map[string]interface{}{"message": "rule group not found"}).
+					WithStatusCode(http.StatusNotFound).Build(), nil
+			}),
+		})
+		assert.NoError(t, err)
+
+		group, err := stackClient.GetAlertRuleGroup("folder-uid", "errors")
+		assert.NoError(t, err)
+		assert.Nil(t, group)
+	})
+
+	t.Run("should put an alert rule group", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				assert.Equal(t, "PUT", req.Method)
+				assert.Equal(t, "https://test-stack.grafana.net/api/v1/provisioning/folder/folder-uid/rule-groups/errors", req.URL.String())
+				payload := map[string]interface{}{}
+				require.NoError(t, json.NewDecoder(req.Body).Decode(&payload))
+				assert.Equal(t, "errors", payload["title"])
+				assert.Equal(t, float64(60), payload["interval"])
+				return testutils.NewHTTPResponseBuilder().
+					WithJsonBody(payload).
+					WithStatusCode(http.StatusOK).Build(), nil
+			}),
+		})
+		assert.NoError(t, err)
+
+		err = stackClient.PutAlertRuleGroup(&AlertRuleGroup{Title: "errors", FolderUID: "folder-uid", Interval: 60, Rules: []*AlertRule{}})
+		assert.NoError(t, err)
+	})
+
+	t.Run("should delete an alert rule group", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				assert.Equal(t, "DELETE", req.Method)
+				assert.Equal(t, "https://test-stack.grafana.net/api/v1/provisioning/folder/folder-uid/rule-groups/errors", req.URL.String())
+				return testutils.NewHTTPResponseBuilder().
+					WithStatusCode(http.StatusNoContent).Build(), nil
+			}),
+		})
+		assert.NoError(t, err)
+
+		err = stackClient.DeleteAlertRuleGroup("folder-uid", "errors")
+		assert.NoError(t, err)
+	})
+}
+
+func TestNotificationResources(t *testing.T) {
+	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+
+	t.Run("should create a missing contact point and update an existing one", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		requests := []string{}
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				requests = append(requests, req.Method+" "+req.URL.Path)
+				payload := map[string]interface{}{}
+				require.NoError(t, json.NewDecoder(req.Body).Decode(&payload))
+				assert.Equal(t, "oncall", payload["uid"])
+				assert.Equal(t, map[string]interface{}{"url": "https://hooks.example.com"}, payload["settings"])
+				return testutils.NewHTTPResponseBuilder().
+					WithJsonBody(payload).
+					WithStatusCode(http.StatusAccepted).Build(), nil
+			}),
+		})
+		assert.NoError(t, err)
+
+		contactPoint := &ContactPoint{
+			UID:      "oncall",
+			Name:     "On call",
+			Type:     p("webhook"),
+			Settings: map[string]interface{}{"url": "https://hooks.example.com"},
+		}
+		err = stackClient.UploadContactPoint(contactPoint, []*ContactPoint{{UID: "other", Name: "Other", Type: p("email")}})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"POST /api/v1/provisioning/contact-points"}, requests)
+
+		requests = []string{}
+		err = stackClient.UploadContactPoint(contactPoint, []*ContactPoint{{UID: "oncall", Name: "On call", Type: p("webhook")}})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"PUT /api/v1/provisioning/contact-points/oncall"}, requests)
+	})
+
+	t.Run("should update an existing mute timing", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		requests := []string{}
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				requests = append(requests, req.Method+" "+req.URL.Path)
+				status := http.StatusOK
+				if req.Method == "PUT" {
+					status = http.StatusAccepted
+				}
+				return testutils.NewHTTPResponseBuilder().
+					WithJsonBody(map[string]interface{}{"name": "weekends", "time_intervals": []interface{}{}}).
+					WithStatusCode(status).Build(), nil
+			}),
+		})
+		assert.NoError(t, err)
+
+		err = stackClient.UploadMuteTiming(&MuteTiming{Name: "weekends"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"GET /api/v1/provisioning/mute-timings/weekends", "PUT /api/v1/provisioning/mute-timings/weekends"}, requests)
+	})
+
+	t.Run("should put a notification template", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				assert.Equal(t, "PUT", req.Method)
+				assert.Equal(t, "https://test-stack.grafana.net/api/v1/provisioning/templates/summary", req.URL.String())
+				payload := map[string]interface{}{}
+				require.NoError(t, json.NewDecoder(req.Body).Decode(&payload))
+				assert.Equal(t, map[string]interface{}{"template": `{{ define "summary" }}{{ end }}`}, payload)
+				return testutils.NewHTTPResponseBuilder().
+					WithJsonBody(map[string]interface{}{"name": "summary"}).
+					WithStatusCode(http.StatusAccepted).Build(), nil
+			}),
+		})
+		assert.NoError(t, err)
+
+		err = stackClient.PutNotificationTemplate("summary", `{{ define "summary" }}{{ end }}`)
+		assert.NoError(t, err)
+	})
+
+	t.Run("should replace the notification policy tree", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				assert.Equal(t, "PUT", req.Method)
+				assert.Equal(t, "https://test-stack.grafana.net/api/v1/provisioning/policies", req.URL.String())
+				payload := map[string]interface{}{}
+				require.NoError(t, json.NewDecoder(req.Body).Decode(&payload))
+				assert.Equal(t, "On call", payload["receiver"])
+				return testutils.NewHTTPResponseBuilder().
+					WithJsonBody(map[string]interface{}{"message": "policies updated"}).
+					WithStatusCode(http.StatusAccepted).Build(), nil
+			}),
+		})
+		assert.NoError(t, err)
+
+		err = stackClient.SetNotificationPolicyTree(&NotificationPolicy{Receiver: "On call"})
+		assert.NoError(t, err)
+	})
+}
+
+func TestDataSources(t *testing.T) {
+	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+
+	t.Run("should list the datasources of a type", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				assert.Equal(t, "GET", req.Method)
+				assert.Equal(t, "https://test-stack.grafana.net/api/datasources", req.URL.String())
+				return testutils.NewHTTPResponseBuilder().
+					WithJsonBody([]map[string]interface{}{
+						{"uid": "prom", "name": "Prometheus", "type": "prometheus", "url": "https://prometheus.example.com"},
+						{"uid": "logs", "name": "Loki", "type": "loki"},
+					}).
+					WithStatusCode(http.StatusOK).Build(), nil
+			}),
+		})
+		assert.NoError(t, err)
+
+		datasources, err := stackClient.ListDataSources("prometheus")
+		assert.NoError(t, err)
+		require.Len(t, datasources, 1)
+		assert.Equal(t, "prom", datasources[0].UID)
+		assert.Equal(t, "https://prometheus.example.com", datasources[0].URL)
+
+		datasources, err = stackClient.ListDataSources("")
+		assert.NoError(t, err)
+		assert.Len(t, datasources, 2)
+	})
+
+	t.Run("should return nil for a missing datasource", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				assert.Equal(t, "https://test-stack.grafana.net/api/datasources/uid/missing", req.URL.String())
+				return testutils.NewHTTPResponseBuilder().
+					WithJsonBody(map[string]interface{}{"message": "Data source not found"}).
+					WithStatusCode(http.StatusNotFound).Build(), nil
+			}),
+		})
+		assert.NoError(t, err)
+
+		datasource, err := stackClient.GetDataSourceByUID("missing")
+		assert.NoError(t, err)
+		assert.Nil(t, datasource)
+	})
+
+	t.Run("should create a datasource with secure fields", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				assert.Equal(t, "POST", req.Method)
+				assert.Equal(t, "https://test-stack.grafana.net/api/datasources", req.URL.String())
+				payload := map[string]interface{}{}
+				require.NoError(t, json.NewDecoder(req.Body).Decode(&payload))
+				assert.Equal(t, "prom", payload["uid"])
+				assert.Equal(t, map[string]interface{}{"basicAuthPassword": "secret"}, payload["secureJsonData"])
+				return testutils.NewHTTPResponseBuilder().
+					WithJsonBody(map[string]interface{}{
+						"id":         1,
+						"name":       "Prometheus",
+						"datasource": map[string]interface{}{"id": 1, "uid": "prom", "name": "Prometheus", "type": "prometheus", "version": 1},
+					}).
+					WithStatusCode(http.StatusOK).Build(), nil
+			}),
+		})
+		assert.NoError(t, err)
+
+		datasource, err := stackClient.CreateDataSource(&Datasource{UID: "prom", Name: "Prometheus", Type: "prometheus"}, map[string]string{"basicAuthPassword": "secret"})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), datasource.Version)
+	})
+
+	t.Run("should update a datasource by uid", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				assert.Equal(t, "PUT", req.Method)
+				assert.Equal(t, "https://test-stack.grafana.net/api/datasources/uid/prom", req.URL.String())
+				payload := map[string]interface{}{}
+				require.NoError(t, json.NewDecoder(req.Body).Decode(&payload))
+				assert.Equal(t, "https://prometheus.example.com", payload["url"])
+				return testutils.NewHTTPResponseBuilder().
+					WithJsonBody(map[string]interface{}{
+						"id":         1,
+						"name":       "Prometheus",
+						"datasource": map[string]interface{}{"id": 1, "uid": "prom", "url": "https://prometheus.example.com", "version": 2},
+					}).
+					WithStatusCode(http.StatusOK).Build(), nil
+			}),
+		})
+		assert.NoError(t, err)
+
+		datasource, err := stackClient.UpdateDataSource(&Datasource{UID: "prom", Name: "Prometheus", URL: "https://prometheus.example.com", Version: 1}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), datasource.Version)
+	})
+
+	t.Run("should report failed health checks", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				assert.Equal(t, "https://test-stack.grafana.net/api/datasources/uid/prom/health", req.URL.String())
+				return testutils.NewHTTPResponseBuilder().
+					WithJsonBody(map[string]interface{}{"status": "ERROR", "message": "connection refused"}).
+					WithStatusCode(http.StatusBadRequest).Build(), nil
+			}),
+		})
+		assert.NoError(t, err)
+
+		health, err := stackClient.CheckDataSourceHealth("prom")
+		assert.NoError(t, err)
+		assert.False(t, health.OK)
+		assert.Equal(t, "connection refused", health.Message)
+	})
+}
+
+func TestFolderPermissions(t *testing.T) {
+	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+
+	t.Run("should replace the permissions resolving the grantees by name", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				switch req.URL.Path {
+				case "/api/teams/search":
+					assert.Equal(t, "SRE", req.URL.Query().Get("name"))
+					return testutils.NewHTTPResponseBuilder().
+						WithJsonBody(map[string]interface{}{"teams": []map[string]interface{}{{"id": 3, "name": "SRE"}}}).
+						WithStatusCode(http.StatusOK).Build(), nil
+				case "/api/org/users/search":
+					return testutils.NewHTTPResponseBuilder().
+						WithJsonBody(map[string]interface{}{
+							"totalCount": 1,
+							"orgUsers":   []map[string]interface{}{{"userId": 7, "login": "jdoe", "email": "jdoe@example.com"}},
+						}).
+						WithStatusCode(http.StatusOK).Build(), nil
+				case "/api/serviceaccounts/search":
+					return testutils.NewHTTPResponseBuilder().
+						WithJsonBody(map[string]interface{}{"serviceAccounts": []map[string]interface{}{{"id": 9, "name": "publisher"}}}).
+						WithStatusCode(http.StatusOK).Build(), nil
+				case "/api/folders/folder-uid/permissions":
+					assert.Equal(t, "POST", req.Method)
+					payload := map[string]interface{}{}
+					require.NoError(t, json.NewDecoder(req.Body).Decode(&payload))
+					assert.Equal(t, []interface{}{
+						map[string]interface{}{"teamId": float64(3), "permission": float64(2)},
+						map[string]interface{}{"userId": float64(7), "permission": float64(4)},
+						map[string]interface{}{"userId": float64(9), "permission": float64(4)},
+						map[string]interface{}{"role": "Viewer", "permission": float64(1)},
+					}, payload["items"])
+					return testutils.NewHTTPResponseBuilder().
+						WithJsonBody(map[string]interface{}{"message": "Folder permissions updated"}).
+						WithStatusCode(http.StatusOK).Build(), nil
+				}
+				t.Errorf("unexpected request %s %s", req.Method, req.URL)
+				return nil, nil
+			}),
+		})
+		assert.NoError(t, err)
+
+		err = stackClient.SetFolderPermissions("folder-uid", []*FolderPermission{
+			{Team: "SRE", Permission: PermissionEdit},
+			{User: "JDoe@Example.com", Permission: PermissionAdmin},
+			{ServiceAccount: "publisher", Permission: PermissionAdmin},
+			{Role: "Viewer", Permission: PermissionView},
+		})
+		assert.NoError(t, err)
+	})
+
+	t.Run("should reject ambiguous permissions", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				t.Errorf("unexpected request %s %s", req.Method, req.URL)
+				return nil, nil
+			}),
+		})
+		assert.NoError(t, err)
+
+		err = stackClient.SetFolderPermissions("folder-uid", []*FolderPermission{{Team: "SRE", Role: "Viewer", Permission: PermissionView}})
+		assert.Error(t, err)
+
+		err = stackClient.SetFolderPermissions("folder-uid", []*FolderPermission{{Role: "Viewer", Permission: "Read"}})
+		assert.Error(t, err)
+	})
+
+	t.Run("should list the permissions of the folder only", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				assert.Equal(t, "https://test-stack.grafana.net/api/folders/folder-uid/permissions", req.URL.String())
+				return testutils.NewHTTPResponseBuilder().
+					WithJsonBody([]map[string]interface{}{
+						{"teamId": 3, "team": "SRE", "permission": 2},
+						{"userId": 7, "userLogin": "jdoe", "permission": 4},
+						{"role": "Editor", "permission": 2, "inherited": true},
+					}).
+					WithStatusCode(http.StatusOK).Build(), nil
+			}),
+		})
+		assert.NoError(t, err)
+
+		permissions, err := stackClient.GetFolderPermissions("folder-uid")
+		assert.NoError(t, err)
+		assert.Equal(t, []*FolderPermission{
+			{Team: "SRE", Permission: PermissionEdit},
+			{User: "jdoe", Permission: PermissionAdmin},
+		}, permissions)
+	})
+}
+
+func TestReconcileTeams(t *testing.T) {
+	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+
+	cloudClient, err := buildCloudClient(t)
+	assert.NoError(t, err)
+
+	requests := []string{}
+	stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+		Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			request := req.Method + " " + req.URL.Path
+			requests = append(requests, request)
+			var body interface{} = map[string]interface{}{"message": "ok"}
+			switch request {
+			case "GET /api/teams/search":
+				body = map[string]interface{}{
+					"totalCount": 2,
+					"teams":      []map[string]interface{}{{"id": 1, "name": "SRE"}, {"id": 2, "name": "Legacy"}},
+				}
+			case "GET /api/teams/1/members":
+				body = []map[string]interface{}{{"userId": 7, "login": "jdoe", "email": "jdoe@example.com"}, {"userId": 9, "login": "old"}}
+			case "GET /api/teams/3/members":
+				body = []map[string]interface{}{}
+			case "GET /api/org/users/search":
+				body = map[string]interface{}{
+					"totalCount": 2,
+					"orgUsers":   []map[string]interface{}{{"userId": 7, "login": "jdoe"}, {"userId": 8, "login": "asmith"}},
+				}
+			case "POST /api/teams":
+				payload := map[string]interface{}{}
+				require.NoError(t, json.NewDecoder(req.Body).Decode(&payload))
+				assert.Equal(t, map[string]interface{}{"name": "Platform", "email": "platform@example.com"}, payload)
+				body = map[string]interface{}{"teamId": 3}
+			case "POST /api/teams/3/members":
+				payload := map[string]interface{}{}
+				require.NoError(t, json.NewDecoder(req.Body).Decode(&payload))
+				assert.Equal(t, map[string]interface{}{"userId": float64(8)}, payload)
+			}
+			return testutils.NewHTTPResponseBuilder().
+				WithJsonBody(body).
+				WithStatusCode(http.StatusOK).Build(), nil
+		}),
+	})
+	assert.NoError(t, err)
+
+	changes, err := ReconcileTeams(stackClient, []TeamSpec{
+		{Name: "SRE", Members: []string{"JDoe@example.com"}},
+		{Name: "Platform", Email: "platform@example.com", Members: []string{"asmith"}},
+	}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []TeamChange{
+		{Action: TeamMemberRemoved, Team: "SRE", Member: "old"},
+		{Action: TeamCreated, Team: "Platform"},
+		{Action: TeamMemberAdded, Team: "Platform", Member: "asmith"},
+		{Action: TeamDeleted, Team: "Legacy"},
+	}, changes)
+	assert.Equal(t, "remove member old from team SRE", changes[0].String())
+	assert.Contains(t, requests, "DELETE /api/teams/1/members/9")
+	assert.Contains(t, requests, "DELETE /api/teams/2")
+}
+
+func TestFolderLifecycle(t *testing.T) {
+	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+
+	t.Run("should return nil for a missing folder", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				assert.Equal(t, "https://test-stack.grafana.net/api/folders/missing", req.URL.String())
+				return testutils.NewHTTPResponseBuilder().
+					WithJsonBody(map[string]interface{}{"message": "folder not found"}).
+					WithStatusCode(http.StatusNotFound).Build(), nil
+			}),
+		})
+		assert.NoError(t, err)
+
+		folder, err := stackClient.GetFolderByUID("missing")
+		assert.NoError(t, err)
+		assert.Nil(t, folder)
+	})
+
+	t.Run("should list a page of the subfolders of a folder", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				assert.Equal(t, "parent-uid", req.URL.Query().Get("parentUid"))
+				assert.Equal(t, "2", req.URL.Query().Get("page"))
+				assert.Equal(t, "10", req.URL.Query().Get("limit"))
+				return testutils.NewHTTPResponseBuilder().
+					WithJsonBody([]map[string]interface{}{{"uid": "child-11", "title": "Child 11", "parentUid": "parent-uid"}}).
+					WithStatusCode(http.StatusOK).Build(), nil
+			}),
+		})
+		assert.NoError(t, err)
+
+		folders, err := stackClient.ListFolderChildren(&Folder{UID: "parent-uid"}, 2, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, []*Folder{{UID: "child-11", Title: "Child 11", ParentUID: "parent-uid"}}, folders)
+	})
+
+	t.Run("should rename a folder at its current version", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				assert.Equal(t, "https://test-stack.grafana.net/api/folders/folder-uid", req.URL.String())
+				if req.Method == "GET" {
+					return testutils.NewHTTPResponseBuilder().
+						WithJsonBody(map[string]interface{}{"uid": "folder-uid", "title": "Old", "version": 4}).
+						WithStatusCode(http.StatusOK).Build(), nil
+				}
+				assert.Equal(t, "PUT", req.Method)
+				payload := map[string]interface{}{}
+				require.NoError(t, json.NewDecoder(req.Body).Decode(&payload))
+				assert.Equal(t, map[string]interface{}{"title": "New", "version": float64(4)}, payload)
+				return testutils.NewHTTPResponseBuilder().
+					WithJsonBody(map[string]interface{}{"uid": "folder-uid", "title": "New", "version": 5}).
+					WithStatusCode(http.StatusOK).Build(), nil
+			}),
+		})
+		assert.NoError(t, err)
+
+		folder, err := stackClient.RenameFolder("folder-uid", "New")
+		assert.NoError(t, err)
+		assert.Equal(t, &Folder{UID: "folder-uid", Title: "New"}, folder)
+	})
+
+	t.Run("should move a folder under another folder", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				assert.Equal(t, "POST", req.Method)
+				assert.Equal(t, "https://test-stack.grafana.net/api/folders/folder-uid/move", req.URL.String())
+				payload := map[string]interface{}{}
+				require.NoError(t, json.NewDecoder(req.Body).Decode(&payload))
+				assert.Equal(t, map[string]interface{}{"parentUid": "parent-uid"}, payload)
+				return testutils.NewHTTPResponseBuilder().
+					WithJsonBody(map[string]interface{}{"uid": "folder-uid", "title": "Folder", "parentUid": "parent-uid"}).
+					WithStatusCode(http.StatusOK).Build(), nil
+			}),
+		})
+		assert.NoError(t, err)
+
+		folder, err := stackClient.MoveFolder("folder-uid", &Folder{UID: "parent-uid"})
+		assert.NoError(t, err)
+		assert.Equal(t, &Folder{UID: "folder-uid", Title: "Folder", ParentUID: "parent-uid"}, folder)
+	})
+
+	t.Run("should refuse to delete a non-empty folder", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				assert.Equal(t, "GET", req.Method)
+				assert.Equal(t, "https://test-stack.grafana.net/api/folders/folder-uid/counts", req.URL.String())
+				return testutils.NewHTTPResponseBuilder().
+					WithJsonBody(map[string]interface{}{"folder": 0, "dashboard": 2, "alertrule": 1}).
+					WithStatusCode(http.StatusOK).Build(), nil
+			}),
+		})
+		assert.NoError(t, err)
+
+		err = stackClient.DeleteFolderIfEmpty("folder-uid")
+		var notEmpty *FolderNotEmptyError
+		require.ErrorAs(t, err, &notEmpty)
+		assert.Equal(t, map[string]int64{"dashboard": 2, "alertrule": 1}, notEmpty.Counts)
+		assert.Equal(t, "folder folder-uid is not empty: 1 alertrule, 2 dashboard", err.Error())
+	})
+
+	t.Run("should delete an empty folder", func(t *testing.T) {
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		requests := []string{}
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				requests = append(requests, req.Method+" "+req.URL.Path)
+				return testutils.NewHTTPResponseBuilder().
+					WithJsonBody(map[string]interface{}{"folder": 0, "dashboard": 0}).
+					WithStatusCode(http.StatusOK).Build(), nil
+			}),
+		})
+		assert.NoError(t, err)
+
+		err = stackClient.DeleteFolderIfEmpty("folder-uid")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"GET /api/folders/folder-uid/counts", "DELETE /api/folders/folder-uid"}, requests)
+	})
+}
+
+func TestFolderPath(t *testing.T) {
+	t.Run("should split escaped folder paths", func(t *testing.T) {
+		assert.Equal(t, []string{"root", "a/b", `c\d`}, SplitFolderPath(`/root/a\/b/c\\d/`))
+		assert.Equal(t, []string{}, SplitFolderPath(""))
+		assert.Equal(t, `root/a\/b/c\\d`, JoinFolderPath([]string{"root", "a/b", `c\d`}))
+	})
+
+	t.Run("should resolve folder paths with cached listings", func(t *testing.T) {
+		os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+		defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+
+		cloudClient, err := buildCloudClient(t)
+		assert.NoError(t, err)
+
+		requests := []string{}
+		stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+			Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				requests = append(requests, req.Method+" "+req.URL.String())
+				assert.Equal(t, "GET", req.Method)
+				assert.Equal(t, "/api/folders", req.URL.Path)
+				folders := []map[string]interface{}{{"uid": "root-uid", "title": "root"}}
+				if req.URL.Query().Get("parentUid") == "root-uid" {
+					folders = []map[string]interface{}{
+						{"uid": "ab-uid", "title": "a/b", "parentUid": "root-uid"},
+						{"uid": "c-uid", "title": "c", "parentUid": "root-uid"},
+					}
+				}
+				return testutils.NewHTTPResponseBuilder().
+					WithJsonBody(folders).
+					WithStatusCode(http.StatusOK).Build(), nil
+			}),
+		})
+		assert.NoError(t, err)
+
+		folder, err := stackClient.EnsureFolderPath(`root/a\/b`)
+		assert.NoError(t, err)
+		assert.Equal(t, &Folder{UID: "ab-uid", Title: "a/b", ParentUID: "root-uid"}, folder)
+
+		folder, err = stackClient.EnsureFolderPath("root/c")
+		assert.NoError(t, err)
+		assert.Equal(t, &Folder{UID: "c-uid", Title: "c", ParentUID: "root-uid"}, folder)
+
+		folder, err = stackClient.EnsureFolderPath("")
+		assert.NoError(t, err)
+		assert.Nil(t, folder)
+
+		assert.Equal(t, []string{
+			"GET https://test-stack.grafana.net/api/folders",
+			"GET https://test-stack.grafana.net/api/folders?parentUid=root-uid",
+		}, requests)
+	})
+}
+
+func TestListUsers(t *testing.T) {
+	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+
+	cloudClient, err := buildCloudClient(t)
+	assert.NoError(t, err)
+
+	stackClient, err := cloudClient.NewStackClientWithHttpClient(testStack, &http.Client{
+		Transport: testutils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			assert.Equal(t, "/api/org/users/search", req.URL.Path)
+			assert.Equal(t, "100", req.URL.Query().Get("perpage"))
+			users := []map[string]interface{}{}
+			if req.URL.Query().Get("page") == "1" {
+				for i := 0; i < 100; i++ {
+					users = append(users, map[string]interface{}{"userId": i, "login": fmt.Sprintf("user-%d", i)})
+				}
+			} else {
+				assert.Equal(t, "2", req.URL.Query().Get("page"))
+				users = append(users, map[string]interface{}{"userId": 100, "login": "user-100"})
+			}
+			return testutils.NewHTTPResponseBuilder().
+				WithJsonBody(map[string]interface{}{"totalCount": 101, "orgUsers": users}).
+				WithStatusCode(http.StatusOK).Build(), nil
+		}),
+	})
+	assert.NoError(t, err)
+
+	users, err := stackClient.ListUsers()
+	assert.NoError(t, err)
+	require.Len(t, users, 101)
+	assert.Equal(t, "user-100", users[100].Login)
+}
@@ -30,11 +30,57 @@ type DashboardClient interface {
 	// EnsureFolder creates a folder if it doesn't exist or returns existing folder.
 	EnsureFolder(rootFolder *Folder, folder string) (*Folder, error)
 
+	// EnsureFolderWithUID creates a folder with the given UID if no folder
+	// with that title exists, or returns the existing folder whatever its UID.
+	EnsureFolderWithUID(rootFolder *Folder, folder, uid string) (*Folder, error)
+
+	// EnsureFolderPath creates the folders of a slash separated path from the
+	// top level which don't exist, and returns the innermost one, or nil for
+	// an empty path. Slashes in titles are escaped as \/.
+	// Lookups are cached for the lifetime of the client.
+	EnsureFolderPath(path string) (*Folder, error)
+
+	// ListFolders lists the folders directly under a folder, or the top level
+	// folders when rootFolder is nil.
+	ListFolders(rootFolder *Folder) ([]*Folder, error)
+
+	// GetFolder retrieves the folder with the given title directly under a
+	// folder, or at the top level when rootFolder is nil.
+	// It returns nil when the folder does not exist.
+	GetFolder(rootFolder *Folder, folderName string) (*Folder, error)
+
+	// GetFolderByUID retrieves a folder by its UID.
+	// It returns nil when the folder does not exist.
+	GetFolderByUID(uid string) (*Folder, error)
+
+	// ListFolderChildren lists a page, starting at 1, of the folders directly
+	// under a folder, or of the top level folders when rootFolder is nil.
+	ListFolderChildren(rootFolder *Folder, page, limit int64) ([]*Folder, error)
+
+	// RenameFolder changes the title of a folder identified by its UID.
+	RenameFolder(uid, title string) (*Folder, error)
+
+	// MoveFolder moves a folder identified by its UID under another folder,
+	// or to the top level when parentFolder is nil.
+	MoveFolder(uid string, parentFolder *Folder) (*Folder, error)
+
+	// DeleteFolder removes a folder identified by its UID, along with its content.
+	DeleteFolder(uid string) error
+
+	// DeleteFolderIfEmpty removes a folder identified by its UID, and returns
+	// a *FolderNotEmptyError instead when it holds dashboards, subfolders,
+	// library panels or alert rules.
+	DeleteFolderIfEmpty(uid string) error
+
 	// GetDataSource retrieves a datasource by its name.
 	GetDataSource(name string) (*Datasource, error)
 
 	// ListDashboardIDsInFolder lists all dashboards in a folder.
 	ListDashboardIDsInFolder(folderUID string) ([]string, error)
+
+	// ListDashboardIDs lists the dashboards of the stack holding the given
+	// tag, or all of them when tag is empty.
+	ListDashboardIDs(tag string) ([]string, error)
 }
 
 type JSON interface{}
@@ -43,6 +89,9 @@ type JSON interface{}
 type Folder struct {
 	UID   string `json:"uid"`
 	Title string `json:"title"`
+
+	// ParentUID is the UID of the parent folder, when known.
+	ParentUID string `json:"parentUid,omitempty"`
 }
 
 // Dashboard represents a Grafana dashboard with its metadata and content
@@ -144,7 +193,36 @@ func (sc *StackClient) ListDashboardIDsInFolder(folderUID string) ([]string, err
 	return dashboardUIDs, nil
 }
 
-func (sc *StackClient) GetFolder(rootFolder *Folder, folderName string) (*Folder, error) {
+func (sc *StackClient) ListDashboardIDs(tag string) ([]string, error) {
+
+	dashboardUIDs := []string{}
+	limit := int64(1000)
+	for page := int64(1); ; page++ {
+		params := search.NewSearchParams().
+			WithType(p("dash-db")).
+			WithPage(&page).
+			WithLimit(&limit)
+		if tag != "" {
+			params = params.WithTag([]string{tag})
+		}
+
+		res, err := sc.httpApi.Search.Search(params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list dashboards: %w", err)
+		}
+
+		for _, hit := range res.Payload {
+			dashboardUIDs = append(dashboardUIDs, hit.UID)
+		}
+		if int64(len(res.Payload)) < limit {
+			break
+		}
+	}
+
+	return dashboardUIDs, nil
+}
+
+func (sc *StackClient) ListFolders(rootFolder *Folder) ([]*Folder, error) {
 
 	params := folders.NewGetFoldersParams()
 	if rootFolder != nil {
@@ -153,18 +231,47 @@ func (sc *StackClient) GetFolder(rootFolder *Folder, folderName string) (*Folder
 	foldersRes, err := sc.httpApi.Folders.GetFolders(params)
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to get folders for  %s: %w", folderName, err)
+		return nil, fmt.Errorf("failed to list folders: %w", err)
 	}
 
 	log.DefaultLogger.WithField("folders", len(foldersRes.Payload)).Debugf("done listing folders")
 
+	result := make([]*Folder, 0, len(foldersRes.Payload))
 	for _, f := range foldersRes.Payload {
+		result = append(result, &Folder{
+			UID:       f.UID,
+			Title:     f.Title,
+			ParentUID: f.ParentUID,
+		})
+	}
+
+	return result, nil
+}
+
+func (sc *StackClient) DeleteFolder(uid string) error {
+
+	_, err := sc.httpApi.Folders.DeleteFolder(folders.NewDeleteFolderParams().WithFolderUID(uid))
+
+	if err != nil {
+		return fmt.Errorf("failed to delete folder %s: %w", uid, err)
+	}
+
+	sc.folders.reset()
+	return nil
+}
+
+func (sc *StackClient) GetFolder(rootFolder *Folder, folderName string) (*Folder, error) {
+
+	children, err := sc.ListFolders(rootFolder)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get folders for  %s: %w", folderName, err)
+	}
+
+	for _, f := range children {
 		log.DefaultLogger.WithField("folder", f.Title).WithField("searched", folderName).Tracef("matching folder")
 		if f.Title == folderName {
-			return &Folder{
-				UID:   f.UID,
-				Title: f.Title,
-			}, nil
+			return f, nil
 		}
 	}
 
@@ -174,6 +281,10 @@ func (sc *StackClient) GetFolder(rootFolder *Folder, folderName string) (*Folder
 }
 
 func (sc *StackClient) EnsureFolder(rootFolder *Folder, folderName string) (*Folder, error) {
+	return sc.EnsureFolderWithUID(rootFolder, folderName, "")
+}
+
+func (sc *StackClient) EnsureFolderWithUID(rootFolder *Folder, folderName, uid string) (*Folder, error) {
 
 	folder, err := sc.GetFolder(rootFolder, folderName)
 
@@ -189,7 +300,7 @@ func (sc *StackClient) EnsureFolder(rootFolder *Folder, folderName string) (*Fol
 
 	log.DefaultLogger.WithField("folder", folderName).Debugf("creating new folder")
 
-	createFolderCmd := &models.CreateFolderCommand{Title: folderName}
+	createFolderCmd := &models.CreateFolderCommand{Title: folderName, UID: uid}
 	if rootFolder != nil {
 		createFolderCmd.ParentUID = rootFolder.UID
 	}
@@ -220,8 +331,5 @@ func (sc *StackClient) EnsureFolder(rootFolder *Folder, folderName string) (*Fol
 		return nil, fmt.Errorf("failed to create folder %s: %w", folderName, err)
 	}
 
-	return &Folder{
-		UID:   createRes.Payload.UID,
-		Title: createRes.Payload.Title,
-	}, nil
+	return folderFromModel(createRes.Payload), nil
 }
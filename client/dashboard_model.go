@@ -0,0 +1,499 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Object holds the parts of a JSON object the typed dashboard model does not
+// describe, so that decoding and encoding a dashboard is lossless.
+// Known fields are encoded when they are set or were present in the decoded
+// JSON. To remove one, reset the field and call Delete.
+type Object struct {
+	// Extra are the fields of the object which are not modelled.
+	Extra map[string]json.RawMessage
+
+	present map[string]bool
+}
+
+// Has reports whether a field, modelled or not, was present in the decoded
+// JSON or was set with SetExtra.
+func (o *Object) Has(key string) bool {
+	_, ok := o.Extra[key]
+	return ok || o.present[key]
+}
+
+// GetExtra decodes a field which is not modelled into v and reports whether
+// it is present.
+func (o *Object) GetExtra(key string, v interface{}) (bool, error) {
+	raw, ok := o.Extra[key]
+	if !ok {
+		return false, nil
+	}
+	err := json.Unmarshal(raw, v)
+	if err != nil {
+		return true, fmt.Errorf("invalid field %s: %w", key, err)
+	}
+	return true, nil
+}
+
+// SetExtra sets a field which is not modelled.
+func (o *Object) SetExtra(key string, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("invalid field %s: %w", key, err)
+	}
+	if o.Extra == nil {
+		o.Extra = map[string]json.RawMessage{}
+	}
+	o.Extra[key] = raw
+	return nil
+}
+
+// Delete removes a field. Modelled fields must also be reset to their zero
+// value to be removed.
+func (o *Object) Delete(key string) {
+	delete(o.Extra, key)
+	delete(o.present, key)
+}
+
+// objectField is a modelled field of a type embedding Object.
+type objectField struct {
+	name  string
+	value reflect.Value
+}
+
+// objectFields lists the modelled fields of a pointer to a struct embedding
+// Object, by their JSON name.
+func objectFields(v interface{}) []objectField {
+	value := reflect.ValueOf(v).Elem()
+	fields := []objectField{}
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.Anonymous || !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, objectField{name: name, value: value.Field(i)})
+	}
+	return fields
+}
+
+// unmarshalObject decodes a JSON object into the modelled fields of v and
+// keeps the other ones in object.
+func unmarshalObject(data []byte, v interface{}, object *Object) error {
+	raw := map[string]json.RawMessage{}
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+
+	object.present = map[string]bool{}
+	for _, field := range objectFields(v) {
+		value, ok := raw[field.name]
+		if !ok {
+			continue
+		}
+		if string(value) == "null" && !nillable(field.value) {
+			// Keep null scalars as is rather than as their zero value.
+			continue
+		}
+		err = json.Unmarshal(value, field.value.Addr().Interface())
+		if err != nil {
+			return fmt.Errorf("invalid field %s: %w", field.name, err)
+		}
+		object.present[field.name] = true
+		delete(raw, field.name)
+	}
+
+	object.Extra = nil
+	if len(raw) > 0 {
+		object.Extra = raw
+	}
+	return nil
+}
+
+func nillable(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Interface:
+		return true
+	}
+	return false
+}
+
+// marshalObject encodes the modelled fields of v which are set or were
+// decoded, along with the fields kept in object.
+func marshalObject(v interface{}, object *Object) ([]byte, error) {
+	raw := map[string]json.RawMessage{}
+	for key, value := range object.Extra {
+		raw[key] = value
+	}
+
+	for _, field := range objectFields(v) {
+		if field.value.IsZero() && !object.present[field.name] {
+			continue
+		}
+		value, err := json.Marshal(field.value.Interface())
+		if err != nil {
+			return nil, fmt.Errorf("invalid field %s: %w", field.name, err)
+		}
+		raw[field.name] = value
+	}
+
+	return json.Marshal(raw)
+}
+
+// DashboardModel is a typed view of the JSON model of a dashboard.
+type DashboardModel struct {
+	Object
+
+	ID          *int64           `json:"id"`
+	UID         string           `json:"uid"`
+	Title       string           `json:"title"`
+	Tags        []string         `json:"tags"`
+	Panels      []*Panel         `json:"panels"`
+	Rows        []*Row           `json:"rows"`
+	Templating  *Templating      `json:"templating"`
+	Annotations *Annotations     `json:"annotations"`
+	Links       []*DashboardLink `json:"links"`
+}
+
+func (d *DashboardModel) UnmarshalJSON(data []byte) error {
+	return unmarshalObject(data, d, &d.Object)
+}
+
+func (d DashboardModel) MarshalJSON() ([]byte, error) {
+	return marshalObject(&d, &d.Object)
+}
+
+// DecodeDashboardModel decodes the content of a dashboard, either raw JSON
+// or a decoded value such as Dashboard.Dashboard.
+// Unexpected shapes of the modelled fields are reported as errors.
+func DecodeDashboardModel(dashboard JSON) (*DashboardModel, error) {
+	var data []byte
+	switch v := dashboard.(type) {
+	case []byte:
+		data = v
+	case json.RawMessage:
+		data = v
+	default:
+		var err error
+		data, err = json.Marshal(dashboard)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dashboard: %w", err)
+		}
+	}
+
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return nil, fmt.Errorf("invalid dashboard: expected a JSON object")
+	}
+
+	model := &DashboardModel{}
+	err := json.Unmarshal(data, model)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dashboard: %w", err)
+	}
+	return model, nil
+}
+
+// JSON returns the dashboard as a generic JSON value, as used in
+// Dashboard.Dashboard.
+func (d *DashboardModel) JSON() (map[string]interface{}, error) {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	dashboard := map[string]interface{}{}
+	err = json.Unmarshal(data, &dashboard)
+	return dashboard, err
+}
+
+// AllPanels returns the panels of the dashboard, including the panels of
+// collapsed rows and of legacy rows.
+func (d *DashboardModel) AllPanels() []*Panel {
+	panels := []*Panel{}
+	var collect func([]*Panel)
+	collect = func(items []*Panel) {
+		for _, panel := range items {
+			if panel == nil {
+				continue
+			}
+			panels = append(panels, panel)
+			collect(panel.Panels)
+		}
+	}
+	collect(d.Panels)
+	for _, row := range d.Rows {
+		if row != nil {
+			collect(row.Panels)
+		}
+	}
+	return panels
+}
+
+// Variables returns the template variables of the dashboard.
+func (d *DashboardModel) Variables() []*TemplateVariable {
+	if d.Templating == nil {
+		return nil
+	}
+	variables := []*TemplateVariable{}
+	for _, variable := range d.Templating.List {
+		if variable != nil {
+			variables = append(variables, variable)
+		}
+	}
+	return variables
+}
+
+// Panel is a dashboard panel. Row panels hold their panels when collapsed.
+type Panel struct {
+	Object
+
+	ID         *int64         `json:"id"`
+	Type       string         `json:"type"`
+	Title      string         `json:"title"`
+	GridPos    *GridPos       `json:"gridPos"`
+	Datasource *DatasourceRef `json:"datasource"`
+	Targets    []*Target      `json:"targets"`
+	Panels     []*Panel       `json:"panels"`
+
+	LibraryPanel *LibraryPanelRef `json:"libraryPanel"`
+}
+
+func (p *Panel) UnmarshalJSON(data []byte) error {
+	return unmarshalObject(data, p, &p.Object)
+}
+
+func (p Panel) MarshalJSON() ([]byte, error) {
+	return marshalObject(&p, &p.Object)
+}
+
+// LibraryPanelRef references the library panel a dashboard panel is an
+// instance of.
+type LibraryPanelRef struct {
+	Object
+
+	UID  string `json:"uid"`
+	Name string `json:"name"`
+}
+
+func (r *LibraryPanelRef) UnmarshalJSON(data []byte) error {
+	return unmarshalObject(data, r, &r.Object)
+}
+
+func (r LibraryPanelRef) MarshalJSON() ([]byte, error) {
+	return marshalObject(&r, &r.Object)
+}
+
+// GridPos is the position of a panel in the dashboard grid.
+type GridPos struct {
+	Object
+
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+func (g *GridPos) UnmarshalJSON(data []byte) error {
+	return unmarshalObject(data, g, &g.Object)
+}
+
+func (g GridPos) MarshalJSON() ([]byte, error) {
+	return marshalObject(&g, &g.Object)
+}
+
+// Target is a query of a panel.
+type Target struct {
+	Object
+
+	RefID      string         `json:"refId"`
+	Datasource *DatasourceRef `json:"datasource"`
+}
+
+func (t *Target) UnmarshalJSON(data []byte) error {
+	return unmarshalObject(data, t, &t.Object)
+}
+
+func (t Target) MarshalJSON() ([]byte, error) {
+	return marshalObject(&t, &t.Object)
+}
+
+// Row is a row of the legacy dashboard schema, holding its panels.
+type Row struct {
+	Object
+
+	Title  string   `json:"title"`
+	Panels []*Panel `json:"panels"`
+}
+
+func (r *Row) UnmarshalJSON(data []byte) error {
+	return unmarshalObject(data, r, &r.Object)
+}
+
+func (r Row) MarshalJSON() ([]byte, error) {
+	return marshalObject(&r, &r.Object)
+}
+
+// DatasourceRef references a datasource, either by UID or, in legacy
+// dashboards, by name.
+type DatasourceRef struct {
+	Object
+
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+
+	// Name is set instead of the other fields for legacy references, which
+	// are encoded as the datasource name.
+	Name string `json:"-"`
+
+	legacy bool
+}
+
+func (r *DatasourceRef) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(`"`)) {
+		r.legacy = true
+		return json.Unmarshal(data, &r.Name)
+	}
+	return unmarshalObject(data, r, &r.Object)
+}
+
+func (r DatasourceRef) MarshalJSON() ([]byte, error) {
+	if r.Name != "" || r.legacy {
+		return json.Marshal(r.Name)
+	}
+	return marshalObject(&r, &r.Object)
+}
+
+// Reference returns the UID of the datasource, or its name for legacy
+// references.
+func (r *DatasourceRef) Reference() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.UID
+}
+
+// Templating holds the template variables of a dashboard.
+type Templating struct {
+	Object
+
+	List []*TemplateVariable `json:"list"`
+}
+
+func (t *Templating) UnmarshalJSON(data []byte) error {
+	return unmarshalObject(data, t, &t.Object)
+}
+
+func (t Templating) MarshalJSON() ([]byte, error) {
+	return marshalObject(&t, &t.Object)
+}
+
+// TemplateVariable is a dashboard template variable.
+// Query is a string or an object depending on the variable type.
+type TemplateVariable struct {
+	Object
+
+	Name       string            `json:"name"`
+	Type       string            `json:"type"`
+	Label      string            `json:"label"`
+	Datasource *DatasourceRef    `json:"datasource"`
+	Current    *VariableOption   `json:"current"`
+	Options    []*VariableOption `json:"options"`
+	Query      interface{}       `json:"query"`
+}
+
+func (v *TemplateVariable) UnmarshalJSON(data []byte) error {
+	return unmarshalObject(data, v, &v.Object)
+}
+
+func (v TemplateVariable) MarshalJSON() ([]byte, error) {
+	return marshalObject(&v, &v.Object)
+}
+
+// VariableOption is a value of a template variable. Text and Value are
+// lists for variables with multiple values selected.
+type VariableOption struct {
+	Object
+
+	Selected bool        `json:"selected"`
+	Text     interface{} `json:"text"`
+	Value    interface{} `json:"value"`
+}
+
+// NewVariableOption returns a variable option encoding all its fields, even
+// when Selected is false.
+func NewVariableOption(text, value interface{}, selected bool) *VariableOption {
+	return &VariableOption{
+		Object:   Object{present: map[string]bool{"selected": true, "text": true, "value": true}},
+		Selected: selected,
+		Text:     text,
+		Value:    value,
+	}
+}
+
+func (o *VariableOption) UnmarshalJSON(data []byte) error {
+	return unmarshalObject(data, o, &o.Object)
+}
+
+func (o VariableOption) MarshalJSON() ([]byte, error) {
+	return marshalObject(&o, &o.Object)
+}
+
+// Annotations holds the annotation queries of a dashboard.
+type Annotations struct {
+	Object
+
+	List []*Annotation `json:"list"`
+}
+
+func (a *Annotations) UnmarshalJSON(data []byte) error {
+	return unmarshalObject(data, a, &a.Object)
+}
+
+func (a Annotations) MarshalJSON() ([]byte, error) {
+	return marshalObject(&a, &a.Object)
+}
+
+// Annotation is an annotation query of a dashboard.
+type Annotation struct {
+	Object
+
+	Name       string         `json:"name"`
+	Datasource *DatasourceRef `json:"datasource"`
+}
+
+func (a *Annotation) UnmarshalJSON(data []byte) error {
+	return unmarshalObject(data, a, &a.Object)
+}
+
+func (a Annotation) MarshalJSON() ([]byte, error) {
+	return marshalObject(&a, &a.Object)
+}
+
+// DashboardLink is a link displayed in the dashboard header.
+type DashboardLink struct {
+	Object
+
+	Title string   `json:"title"`
+	Type  string   `json:"type"`
+	URL   string   `json:"url"`
+	Tags  []string `json:"tags"`
+}
+
+func (l *DashboardLink) UnmarshalJSON(data []byte) error {
+	return unmarshalObject(data, l, &l.Object)
+}
+
+func (l DashboardLink) MarshalJSON() ([]byte, error) {
+	return marshalObject(&l, &l.Object)
+}
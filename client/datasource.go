@@ -0,0 +1,189 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/grafana/grafana-openapi-client-go/client/datasources"
+	"github.com/grafana/grafana-openapi-client-go/models"
+)
+
+// DatasourceClient defines operations for provisioning the datasources of a
+// Grafana instance.
+type DatasourceClient interface {
+	// ListDataSources lists the datasources of the given plugin type, or all
+	// of them when dsType is empty.
+	ListDataSources(dsType string) ([]*Datasource, error)
+
+	// GetDataSourceByUID retrieves a datasource by its UID.
+	// It returns nil when the datasource does not exist.
+	GetDataSourceByUID(uid string) (*Datasource, error)
+
+	// CreateDataSource creates a datasource with the given secure fields,
+	// such as passwords or tokens, and returns it.
+	CreateDataSource(datasource *Datasource, secureJSONData map[string]string) (*Datasource, error)
+
+	// UpdateDataSource updates the datasource identified by its UID and
+	// returns it. Secure fields which are not provided are kept.
+	UpdateDataSource(datasource *Datasource, secureJSONData map[string]string) (*Datasource, error)
+
+	// DeleteDataSource removes a datasource identified by its UID.
+	DeleteDataSource(uid string) error
+
+	// CheckDataSourceHealth runs the health check of a datasource plugin
+	// against the datasource identified by its UID.
+	CheckDataSourceHealth(uid string) (*DatasourceHealth, error)
+}
+
+// DatasourceHealth is the result of a datasource health check.
+type DatasourceHealth struct {
+	// OK is true when Grafana could query the datasource.
+	OK      bool
+	Message string
+}
+
+func (sc *StackClient) ListDataSources(dsType string) ([]*Datasource, error) {
+
+	res, err := sc.httpApi.Datasources.GetDataSources()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list datasources: %w", err)
+	}
+
+	result := []*Datasource{}
+	for _, item := range res.Payload {
+		if dsType != "" && item.Type != dsType {
+			continue
+		}
+		result = append(result, &Datasource{
+			Access:    item.Access,
+			BasicAuth: item.BasicAuth,
+			Database:  item.Database,
+			ID:        item.ID,
+			IsDefault: item.IsDefault,
+			JSONData:  item.JSONData,
+			Name:      item.Name,
+			OrgID:     item.OrgID,
+			ReadOnly:  item.ReadOnly,
+			Type:      item.Type,
+			UID:       item.UID,
+			URL:       item.URL,
+			User:      item.User,
+		})
+	}
+
+	return result, nil
+}
+
+func (sc *StackClient) GetDataSourceByUID(uid string) (*Datasource, error) {
+
+	res, err := sc.httpApi.Datasources.GetDataSourceByUID(uid)
+
+	if err != nil {
+		var notFound *datasources.GetDataSourceByUIDNotFound
+		if errors.As(err, &notFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get datasource %s: %w", uid, err)
+	}
+
+	if res.Payload == nil {
+		return nil, fmt.Errorf("received no datasource data for uid: %s", uid)
+	}
+
+	return res.Payload, nil
+}
+
+func (sc *StackClient) CreateDataSource(datasource *Datasource, secureJSONData map[string]string) (*Datasource, error) {
+
+	res, err := sc.httpApi.Datasources.AddDataSource(&models.AddDataSourceCommand{
+		Access:          datasource.Access,
+		BasicAuth:       datasource.BasicAuth,
+		BasicAuthUser:   datasource.BasicAuthUser,
+		Database:        datasource.Database,
+		IsDefault:       datasource.IsDefault,
+		JSONData:        datasource.JSONData,
+		Name:            datasource.Name,
+		SecureJSONData:  secureJSONData,
+		Type:            datasource.Type,
+		UID:             datasource.UID,
+		URL:             datasource.URL,
+		User:            datasource.User,
+		WithCredentials: datasource.WithCredentials,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create datasource %s: %w", datasource.Name, err)
+	}
+
+	if res.Payload == nil || res.Payload.Datasource == nil {
+		return nil, fmt.Errorf("received no datasource data for: %s", datasource.Name)
+	}
+
+	return res.Payload.Datasource, nil
+}
+
+func (sc *StackClient) UpdateDataSource(datasource *Datasource, secureJSONData map[string]string) (*Datasource, error) {
+
+	res, err := sc.httpApi.Datasources.UpdateDataSourceByUID(datasource.UID, &models.UpdateDataSourceCommand{
+		Access:          datasource.Access,
+		BasicAuth:       datasource.BasicAuth,
+		BasicAuthUser:   datasource.BasicAuthUser,
+		Database:        datasource.Database,
+		IsDefault:       datasource.IsDefault,
+		JSONData:        datasource.JSONData,
+		Name:            datasource.Name,
+		SecureJSONData:  secureJSONData,
+		Type:            datasource.Type,
+		UID:             datasource.UID,
+		URL:             datasource.URL,
+		User:            datasource.User,
+		Version:         datasource.Version,
+		WithCredentials: datasource.WithCredentials,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to update datasource %s: %w", datasource.UID, err)
+	}
+
+	if res.Payload == nil || res.Payload.Datasource == nil {
+		return nil, fmt.Errorf("received no datasource data for uid: %s", datasource.UID)
+	}
+
+	return res.Payload.Datasource, nil
+}
+
+func (sc *StackClient) DeleteDataSource(uid string) error {
+
+	_, err := sc.httpApi.Datasources.DeleteDataSourceByUID(uid)
+
+	if err != nil {
+		return fmt.Errorf("failed to delete datasource %s: %w", uid, err)
+	}
+
+	return nil
+}
+
+func (sc *StackClient) CheckDataSourceHealth(uid string) (*DatasourceHealth, error) {
+
+	res, err := sc.httpApi.Datasources.CheckDatasourceHealthWithUID(uid)
+
+	if err != nil {
+		// Grafana reports failed health checks as bad requests.
+		var failed *datasources.CheckDatasourceHealthWithUIDBadRequest
+		if errors.As(err, &failed) {
+			health := &DatasourceHealth{}
+			if failed.Payload != nil && failed.Payload.Message != nil {
+				health.Message = *failed.Payload.Message
+			}
+			return health, nil
+		}
+		return nil, fmt.Errorf("failed to check datasource %s health: %w", uid, err)
+	}
+
+	health := &DatasourceHealth{OK: true}
+	if res.Payload != nil {
+		health.Message = res.Payload.Message
+	}
+	return health, nil
+}
@@ -0,0 +1,249 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/grafana/grafana-openapi-client-go/client/folders"
+	"github.com/grafana/grafana-openapi-client-go/models"
+)
+
+// FolderNotEmptyError is returned when deleting a folder which still holds
+// resources, with the number of resources of each kind it holds.
+type FolderNotEmptyError struct {
+	UID    string
+	Counts map[string]int64
+}
+
+func (e *FolderNotEmptyError) Error() string {
+	kinds := make([]string, 0, len(e.Counts))
+	for kind, count := range e.Counts {
+		kinds = append(kinds, fmt.Sprintf("%d %s", count, kind))
+	}
+	sort.Strings(kinds)
+	return fmt.Sprintf("folder %s is not empty: %s", e.UID, strings.Join(kinds, ", "))
+}
+
+// folderCache holds the folders resolved by EnsureFolderPath, by path, and
+// the paths whose subfolders have all been listed.
+type folderCache struct {
+	lock    sync.Mutex
+	folders map[string]*Folder
+	listed  map[string]bool
+}
+
+func newFolderCache() *folderCache {
+	return &folderCache{
+		folders: map[string]*Folder{},
+		listed:  map[string]bool{},
+	}
+}
+
+// reset forgets the cached folders, after they are renamed, moved or deleted.
+func (c *folderCache) reset() {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.folders = map[string]*Folder{}
+	c.listed = map[string]bool{}
+}
+
+// SplitFolderPath returns the folder titles of a slash separated path.
+// Slashes and backslashes in titles are escaped with a backslash, and empty
+// titles are ignored.
+func SplitFolderPath(path string) []string {
+	titles := []string{}
+	title := strings.Builder{}
+	escaped := false
+	for _, r := range path {
+		switch {
+		case escaped:
+			title.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '/':
+			if title.Len() > 0 {
+				titles = append(titles, title.String())
+			}
+			title.Reset()
+		default:
+			title.WriteRune(r)
+		}
+	}
+	if title.Len() > 0 {
+		titles = append(titles, title.String())
+	}
+	return titles
+}
+
+// JoinFolderPath returns the slash separated path of folder titles, escaping
+// the slashes and backslashes of the titles.
+func JoinFolderPath(titles []string) string {
+	escaped := make([]string, 0, len(titles))
+	for _, title := range titles {
+		title = strings.ReplaceAll(title, `\`, `\\`)
+		escaped = append(escaped, strings.ReplaceAll(title, "/", `\/`))
+	}
+	return strings.Join(escaped, "/")
+}
+
+func (sc *StackClient) EnsureFolderPath(path string) (*Folder, error) {
+
+	sc.folders.lock.Lock()
+	defer sc.folders.lock.Unlock()
+
+	var folder *Folder
+	titles := SplitFolderPath(path)
+	for i, title := range titles {
+		parentPath := JoinFolderPath(titles[:i])
+		folderPath := JoinFolderPath(titles[:i+1])
+
+		// Listing the subfolders once resolves the sibling paths as well.
+		if !sc.folders.listed[parentPath] {
+			children, err := sc.ListFolders(folder)
+			if err != nil {
+				return nil, fmt.Errorf("failed to ensure folder path %s: %w", path, err)
+			}
+			for _, child := range children {
+				sc.folders.folders[JoinFolderPath(append(titles[:i:i], child.Title))] = child
+			}
+			sc.folders.listed[parentPath] = true
+		}
+
+		cached, ok := sc.folders.folders[folderPath]
+		if !ok {
+			var err error
+			cached, err = sc.EnsureFolder(folder, title)
+			if err != nil {
+				return nil, fmt.Errorf("failed to ensure folder path %s: %w", path, err)
+			}
+			sc.folders.folders[folderPath] = cached
+			// The folder was missing from the listing, so it was just created.
+			sc.folders.listed[folderPath] = true
+		}
+		folder = cached
+	}
+
+	return folder, nil
+}
+
+func (sc *StackClient) GetFolderByUID(uid string) (*Folder, error) {
+
+	res, err := sc.httpApi.Folders.GetFolderByUID(uid)
+
+	if err != nil {
+		var notFound *folders.GetFolderByUIDNotFound
+		if errors.As(err, &notFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get folder %s: %w", uid, err)
+	}
+
+	if res.Payload == nil {
+		return nil, fmt.Errorf("received no folder data for uid: %s", uid)
+	}
+
+	return folderFromModel(res.Payload), nil
+}
+
+func (sc *StackClient) ListFolderChildren(rootFolder *Folder, page, limit int64) ([]*Folder, error) {
+
+	params := folders.NewGetFoldersParams().WithPage(&page).WithLimit(&limit)
+	if rootFolder != nil {
+		params.ParentUID = &rootFolder.UID
+	}
+	res, err := sc.httpApi.Folders.GetFolders(params)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list folders: %w", err)
+	}
+
+	result := make([]*Folder, 0, len(res.Payload))
+	for _, f := range res.Payload {
+		result = append(result, &Folder{
+			UID:       f.UID,
+			Title:     f.Title,
+			ParentUID: f.ParentUID,
+		})
+	}
+
+	return result, nil
+}
+
+func (sc *StackClient) RenameFolder(uid, title string) (*Folder, error) {
+
+	res, err := sc.httpApi.Folders.GetFolderByUID(uid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rename folder %s: %w", uid, err)
+	}
+	if res.Payload == nil {
+		return nil, fmt.Errorf("received no folder data for uid: %s", uid)
+	}
+
+	updated, err := sc.httpApi.Folders.UpdateFolder(uid, &models.UpdateFolderCommand{
+		Title:   title,
+		Version: res.Payload.Version,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to rename folder %s: %w", uid, err)
+	}
+
+	sc.folders.reset()
+	return folderFromModel(updated.Payload), nil
+}
+
+func (sc *StackClient) MoveFolder(uid string, parentFolder *Folder) (*Folder, error) {
+
+	cmd := &models.MoveFolderCommand{}
+	if parentFolder != nil {
+		cmd.ParentUID = parentFolder.UID
+	}
+	res, err := sc.httpApi.Folders.MoveFolder(uid, cmd)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to move folder %s: %w", uid, err)
+	}
+
+	sc.folders.reset()
+	return folderFromModel(res.Payload), nil
+}
+
+func (sc *StackClient) DeleteFolderIfEmpty(uid string) error {
+
+	res, err := sc.httpApi.Folders.GetFolderDescendantCounts(uid)
+
+	if err != nil {
+		return fmt.Errorf("failed to count the content of folder %s: %w", uid, err)
+	}
+
+	counts := map[string]int64{}
+	for kind, count := range res.Payload {
+		if count > 0 {
+			counts[kind] = count
+		}
+	}
+	if len(counts) > 0 {
+		return &FolderNotEmptyError{UID: uid, Counts: counts}
+	}
+
+	return sc.DeleteFolder(uid)
+}
+
+// folderFromModel converts a folder of the Grafana API.
+func folderFromModel(folder *models.Folder) *Folder {
+	if folder == nil {
+		return nil
+	}
+	return &Folder{
+		UID:       folder.UID,
+		Title:     folder.Title,
+		ParentUID: folder.ParentUID,
+	}
+}
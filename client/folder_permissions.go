@@ -0,0 +1,192 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/grafana/grafana-openapi-client-go/client/service_accounts"
+	"github.com/grafana/grafana-openapi-client-go/models"
+)
+
+// FolderPermissionClient defines operations for managing who can access the
+// dashboards of a folder.
+type FolderPermissionClient interface {
+	// GetFolderPermissions lists the permissions granted on a folder itself,
+	// excluding the ones inherited from its parents.
+	GetFolderPermissions(folderUID string) ([]*FolderPermission, error)
+
+	// SetFolderPermissions replaces the permissions granted on a folder.
+	// Teams, users and service accounts are resolved by name.
+	// It requires a client created with RoleAdmin, unless its service account
+	// created the folder and no user is listed.
+	SetFolderPermissions(folderUID string, permissions []*FolderPermission) error
+}
+
+// PermissionLevel is the access a FolderPermission grants.
+type PermissionLevel string
+
+const (
+	// PermissionView allows to view the dashboards of the folder.
+	PermissionView PermissionLevel = "View"
+	// PermissionEdit allows to change the dashboards of the folder.
+	PermissionEdit PermissionLevel = "Edit"
+	// PermissionAdmin allows to change the dashboards and permissions of the folder.
+	PermissionAdmin PermissionLevel = "Admin"
+)
+
+var permissionTypes = map[PermissionLevel]models.PermissionType{
+	PermissionView:  1,
+	PermissionEdit:  2,
+	PermissionAdmin: 4,
+}
+
+// FolderPermission grants a permission level on a folder to exactly one of a
+// team, a user, a service account or a basic role.
+type FolderPermission struct {
+	// Team is the name of a team.
+	Team string `json:"team,omitempty" yaml:"team,omitempty"`
+	// User is the login or email of a user.
+	User string `json:"user,omitempty" yaml:"user,omitempty"`
+	// ServiceAccount is the name of a service account.
+	ServiceAccount string `json:"serviceAccount,omitempty" yaml:"serviceAccount,omitempty"`
+	// Role is a basic role: Viewer or Editor.
+	Role string `json:"role,omitempty" yaml:"role,omitempty"`
+
+	Permission PermissionLevel `json:"permission" yaml:"permission"`
+}
+
+func (sc *StackClient) GetFolderPermissions(folderUID string) ([]*FolderPermission, error) {
+
+	res, err := sc.httpApi.FolderPermissions.GetFolderPermissionList(folderUID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get permissions of folder %s: %w", folderUID, err)
+	}
+
+	permissions := []*FolderPermission{}
+	for _, item := range res.Payload {
+		if item.Inherited {
+			continue
+		}
+		permission := &FolderPermission{
+			Team: item.Team,
+			Role: item.Role,
+		}
+		// Service accounts are users in the folder permissions API.
+		if item.UserID != 0 {
+			permission.User = item.UserLogin
+		}
+		for level, permissionType := range permissionTypes {
+			if permissionType == item.Permission {
+				permission.Permission = level
+			}
+		}
+		permissions = append(permissions, permission)
+	}
+
+	return permissions, nil
+}
+
+func (sc *StackClient) SetFolderPermissions(folderUID string, permissions []*FolderPermission) error {
+
+	items := make([]*models.DashboardACLUpdateItem, 0, len(permissions))
+	for _, permission := range permissions {
+		item, err := sc.folderPermissionItem(permission)
+		if err != nil {
+			return fmt.Errorf("failed to set permissions of folder %s: %w", folderUID, err)
+		}
+		items = append(items, item)
+	}
+
+	_, err := sc.httpApi.FolderPermissions.UpdateFolderPermissions(folderUID, &models.UpdateDashboardACLCommand{Items: items})
+
+	if err != nil {
+		return fmt.Errorf("failed to set permissions of folder %s: %w", folderUID, err)
+	}
+
+	return nil
+}
+
+// folderPermissionItem resolves the grantee of a permission.
+func (sc *StackClient) folderPermissionItem(permission *FolderPermission) (*models.DashboardACLUpdateItem, error) {
+	permissionType, ok := permissionTypes[permission.Permission]
+	if !ok {
+		return nil, fmt.Errorf("unsupported permission %q, expected View, Edit or Admin", permission.Permission)
+	}
+	item := &models.DashboardACLUpdateItem{Permission: permissionType}
+
+	grantees := 0
+	for _, grantee := range []string{permission.Team, permission.User, permission.ServiceAccount, permission.Role} {
+		if grantee != "" {
+			grantees++
+		}
+	}
+	if grantees != 1 {
+		return nil, fmt.Errorf("permissions require exactly one of team, user, serviceAccount or role")
+	}
+
+	var err error
+	switch {
+	case permission.Team != "":
+		item.TeamID, err = sc.teamID(permission.Team)
+	case permission.User != "":
+		item.UserID, err = sc.userID(permission.User)
+	case permission.ServiceAccount != "":
+		item.UserID, err = sc.serviceAccountID(permission.ServiceAccount)
+	default:
+		item.Role = permission.Role
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// teamID returns the ID of the team with the given name.
+func (sc *StackClient) teamID(name string) (int64, error) {
+	team, err := sc.GetTeamByName(name)
+	if err != nil {
+		return 0, err
+	}
+	if team == nil {
+		return 0, fmt.Errorf("team not found: %s", name)
+	}
+	return team.ID, nil
+}
+
+// userID returns the ID of the organisation user with the given login or
+// email, compared case-insensitively.
+func (sc *StackClient) userID(loginOrEmail string) (int64, error) {
+	users, err := sc.ListUsers()
+	if err != nil {
+		return 0, err
+	}
+	for _, user := range users {
+		if strings.EqualFold(user.Login, loginOrEmail) || strings.EqualFold(user.Email, loginOrEmail) {
+			return user.UserID, nil
+		}
+	}
+	return 0, fmt.Errorf("user not found: %s", loginOrEmail)
+}
+
+// serviceAccountID returns the ID of the service account with the given name.
+func (sc *StackClient) serviceAccountID(name string) (int64, error) {
+
+	res, err := sc.httpApi.ServiceAccounts.SearchOrgServiceAccountsWithPaging(
+		service_accounts.NewSearchOrgServiceAccountsWithPagingParams().WithQuery(&name))
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to search service account %s: %w", name, err)
+	}
+
+	if res.Payload != nil {
+		for _, serviceAccount := range res.Payload.ServiceAccounts {
+			if serviceAccount.Name == name {
+				return serviceAccount.ID, nil
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("service account not found: %s", name)
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	log "github.com/adevinta/go-log-toolkit"
@@ -24,8 +25,21 @@ type GrafanaCloudClient interface {
 	OrganisationClient
 	NewStackClient(stack *Stack) (GrafanaStackClient, error)
 	NewStackClientWithHttpClient(stack *Stack, httpClient *http.Client) (GrafanaStackClient, error)
+	// NewStackClientWithRole creates a stack client whose service account has
+	// the given basic role, RoleEditor or RoleAdmin.
+	NewStackClientWithRole(stack *Stack, role string) (GrafanaStackClient, error)
 }
 
+// Basic roles of the service accounts stack clients are authenticated with.
+const (
+	// RoleEditor allows to manage dashboards, folders, library panels and
+	// alerting resources. It is the role of NewStackClient.
+	RoleEditor = "Editor"
+	// RoleAdmin is additionally required to manage datasources, teams, users
+	// and the permissions of folders the service account did not create.
+	RoleAdmin = "Admin"
+)
+
 // CloudClient implements GrafanaCloudClient interface and handles
 // communication with the Grafana Cloud API.
 type CloudClient struct {
@@ -36,6 +50,12 @@ type CloudClient struct {
 // It provides operations for managing dashboards and cleanup operations.
 type GrafanaStackClient interface {
 	DashboardClient
+	PluginClient
+	LibraryPanelClient
+	AlertingClient
+	DatasourceClient
+	FolderPermissionClient
+	TeamClient
 	Cleanup() error
 	GrafanaStackClient() *client.GrafanaHTTPAPI
 }
@@ -47,6 +67,9 @@ type StackClient struct {
 	cloudApi GrafanaCloudClient
 	sa       *ServiceAccount
 	stack    *Stack
+
+	// folders caches the folders resolved by EnsureFolderPath, by path.
+	folders *folderCache
 }
 
 var timeNow = time.Now
@@ -80,16 +103,19 @@ func newCloudClient(httpClient *http.Client) (GrafanaCloudClient, error) {
 }
 
 func (cc *CloudClient) NewStackClientWithHttpClient(stack *Stack, httpClient *http.Client) (GrafanaStackClient, error) {
-	return cc.newStackClient(stack, httpClient)
+	return cc.newStackClient(stack, httpClient, RoleEditor)
 }
 
 func (cc *CloudClient) NewStackClient(stack *Stack) (GrafanaStackClient, error) {
-	return cc.newStackClient(stack, nil)
+	return cc.newStackClient(stack, nil, RoleEditor)
+}
+
+func (cc *CloudClient) NewStackClientWithRole(stack *Stack, role string) (GrafanaStackClient, error) {
+	return cc.newStackClient(stack, nil, role)
 }
 
-func (cc *CloudClient) newStackClient(stack *Stack, httpClient *http.Client) (GrafanaStackClient, error) {
-	roleName := "Editor"
-	saName := fmt.Sprintf("cpr-dashboard-editor-%s", time.Now().Format("20060102_1504"))
+func (cc *CloudClient) newStackClient(stack *Stack, httpClient *http.Client, roleName string) (GrafanaStackClient, error) {
+	saName := fmt.Sprintf("cpr-dashboard-%s-%s", strings.ToLower(roleName), time.Now().Format("20060102_1504"))
 	log.DefaultLogger.WithField("stack", stack.Slug).WithField("saName", saName).Println("creating SA")
 
 	cprSA, err := cc.CreateServiceAccount(stack.StackID, saName, roleName)
@@ -137,6 +163,7 @@ func (cc *CloudClient) newStackClient(stack *Stack, httpClient *http.Client) (Gr
 		cloudApi: cc,
 		stack:    stack,
 		sa:       cprSA,
+		folders:  newFolderCache(),
 	}, nil
 }
 
@@ -0,0 +1,149 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/grafana/grafana-openapi-client-go/client/library_elements"
+	"github.com/grafana/grafana-openapi-client-go/models"
+)
+
+// libraryPanelKind is the kind of library elements holding panels.
+const libraryPanelKind = 1
+
+// LibraryPanelClient defines operations for managing the library panels
+// dashboards reference through libraryPanel.uid.
+type LibraryPanelClient interface {
+	// ListLibraryPanels lists the library panels of a folder, or of all the
+	// folders when folderUID is empty.
+	ListLibraryPanels(folderUID string) ([]*LibraryPanel, error)
+
+	// GetLibraryPanel retrieves a library panel by its UID.
+	// It returns nil when the library panel does not exist.
+	GetLibraryPanel(uid string) (*LibraryPanel, error)
+
+	// UploadLibraryPanel creates or updates a library panel, identified by its UID.
+	UploadLibraryPanel(panel *LibraryPanel) error
+
+	// DeleteLibraryPanel removes a library panel identified by its UID.
+	DeleteLibraryPanel(uid string) error
+}
+
+// LibraryPanel represents a Grafana library panel with its metadata and the
+// model of the panel.
+type LibraryPanel struct {
+	UID       string
+	Name      string
+	FolderUID string
+	Model     JSON
+	Version   int64
+}
+
+func newLibraryPanel(element *models.LibraryElementDTO) *LibraryPanel {
+	return &LibraryPanel{
+		UID:       element.UID,
+		Name:      element.Name,
+		FolderUID: element.FolderUID,
+		Model:     element.Model,
+		Version:   element.Version,
+	}
+}
+
+func (sc *StackClient) ListLibraryPanels(folderUID string) ([]*LibraryPanel, error) {
+	panels := []*LibraryPanel{}
+
+	for page := 1; ; page++ {
+		// The generated client only filters by folder ID, use folderFilterUIDs instead.
+		query := url.Values{
+			"kind":    []string{strconv.Itoa(libraryPanelKind)},
+			"page":    []string{strconv.Itoa(page)},
+			"perPage": []string{"100"},
+		}
+		if folderUID != "" {
+			query.Set("folderFilterUIDs", folderUID)
+		}
+
+		res := models.LibraryElementSearchResponse{}
+		err := sc.submit(http.MethodGet, "/library-elements", query, nil, &res)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list library panels: %w", err)
+		}
+		if res.Result == nil {
+			return panels, nil
+		}
+
+		for _, element := range res.Result.Elements {
+			panels = append(panels, newLibraryPanel(element))
+		}
+
+		if len(res.Result.Elements) == 0 || int64(len(panels)) >= res.Result.TotalCount {
+			return panels, nil
+		}
+	}
+}
+
+func (sc *StackClient) GetLibraryPanel(uid string) (*LibraryPanel, error) {
+
+	res, err := sc.httpApi.LibraryElements.GetLibraryElementByUID(uid)
+
+	if err != nil {
+		var notFound *library_elements.GetLibraryElementByUIDNotFound
+		if errors.As(err, &notFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get library panel %s: %w", uid, err)
+	}
+
+	if res.Payload == nil || res.Payload.Result == nil {
+		return nil, fmt.Errorf("received no library panel data for uid: %s", uid)
+	}
+
+	return newLibraryPanel(res.Payload.Result), nil
+}
+
+func (sc *StackClient) UploadLibraryPanel(panel *LibraryPanel) error {
+
+	existing, err := sc.GetLibraryPanel(panel.UID)
+	if err != nil {
+		return fmt.Errorf("failed to upload library panel %s: %w", panel.UID, err)
+	}
+
+	if existing == nil {
+		_, err = sc.httpApi.LibraryElements.CreateLibraryElement(&models.CreateLibraryElementCommand{
+			UID:       panel.UID,
+			Name:      panel.Name,
+			FolderUID: panel.FolderUID,
+			Kind:      libraryPanelKind,
+			Model:     panel.Model,
+		})
+	} else {
+		_, err = sc.httpApi.LibraryElements.UpdateLibraryElement(panel.UID, &models.PatchLibraryElementCommand{
+			UID:       panel.UID,
+			Name:      panel.Name,
+			FolderUID: panel.FolderUID,
+			Kind:      libraryPanelKind,
+			Model:     panel.Model,
+			Version:   existing.Version,
+		})
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to upload library panel %s: %w", panel.UID, err)
+	}
+
+	return nil
+}
+
+func (sc *StackClient) DeleteLibraryPanel(uid string) error {
+
+	_, err := sc.httpApi.LibraryElements.DeleteLibraryElementByUID(uid)
+
+	if err != nil {
+		return fmt.Errorf("failed to delete library panel %s: %w", uid, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/go-openapi/runtime"
+	"github.com/go-openapi/strfmt"
+)
+
+// PluginClient defines operations for inspecting the plugins installed
+// in a Grafana instance.
+type PluginClient interface {
+	// ListPlugins lists the plugins installed in the instance, including core plugins.
+	ListPlugins() ([]Plugin, error)
+}
+
+// Plugin represents a panel, datasource or app plugin installed in Grafana.
+type Plugin struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Enabled bool   `json:"enabled"`
+}
+
+func (sc *StackClient) ListPlugins() ([]Plugin, error) {
+	plugins := []Plugin{}
+
+	err := sc.submit(http.MethodGet, "/plugins", nil, nil, &plugins)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list plugins: %w", err)
+	}
+
+	return plugins, nil
+}
+
+// submit sends a request to a Grafana HTTP API endpoint which is not covered
+// by the generated client, and decodes the JSON response into result when
+// not nil.
+func (sc *StackClient) submit(method, path string, query url.Values, body, result interface{}) error {
+	op := &runtime.ClientOperation{
+		ID:                 method + " " + path,
+		Method:             method,
+		PathPattern:        path,
+		ProducesMediaTypes: []string{"application/json"},
+		ConsumesMediaTypes: []string{"application/json"},
+		Schemes:            []string{"http", "https"},
+		Params: runtime.ClientRequestWriterFunc(func(req runtime.ClientRequest, _ strfmt.Registry) error {
+			for key, values := range query {
+				if err := req.SetQueryParam(key, values...); err != nil {
+					return err
+				}
+			}
+			if body != nil {
+				return req.SetBodyParam(body)
+			}
+			return nil
+		}),
+		Reader: runtime.ClientResponseReaderFunc(func(response runtime.ClientResponse, consumer runtime.Consumer) (interface{}, error) {
+			if response.Code() < http.StatusOK || response.Code() >= http.StatusMultipleChoices {
+				return nil, runtime.NewAPIError(method+" "+path, response, response.Code())
+			}
+			if result != nil {
+				err := consumer.Consume(response.Body(), result)
+				if err != nil && !errors.Is(err, io.EOF) {
+					return nil, err
+				}
+			}
+			return result, nil
+		}),
+	}
+
+	_, err := sc.httpApi.Transport.Submit(op)
+	return err
+}
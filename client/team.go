@@ -0,0 +1,351 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/grafana-openapi-client-go/client/teams"
+	"github.com/grafana/grafana-openapi-client-go/models"
+)
+
+// TeamClient defines operations for managing the teams and users of a
+// Grafana instance.
+// Except for ListTeams, GetTeamByName and ListTeamMembers, they require a
+// client created with RoleAdmin.
+type TeamClient interface {
+	// ListTeams lists the teams of the instance.
+	ListTeams() ([]*Team, error)
+
+	// GetTeamByName retrieves a team by its name.
+	// It returns nil when the team does not exist.
+	GetTeamByName(name string) (*Team, error)
+
+	// CreateTeam creates a team and returns it.
+	CreateTeam(name, email string) (*Team, error)
+
+	// UpdateTeam updates the name and email of the team identified by its ID.
+	UpdateTeam(team *Team) error
+
+	// DeleteTeam removes a team identified by its ID.
+	DeleteTeam(teamID int64) error
+
+	// ListTeamMembers lists the members of a team.
+	ListTeamMembers(teamID int64) ([]*TeamMember, error)
+
+	// AddTeamMember adds the user with the given login or email to a team.
+	AddTeamMember(teamID int64, loginOrEmail string) error
+
+	// RemoveTeamMember removes the member with the given login or email from
+	// a team.
+	RemoveTeamMember(teamID int64, loginOrEmail string) error
+
+	// ListUsers lists the users of the organisation.
+	ListUsers() ([]*User, error)
+}
+
+// Team is a group of users permissions can be granted to.
+type Team = models.TeamDTO
+
+// TeamMember is a user belonging to a Team.
+type TeamMember = models.TeamMemberDTO
+
+// User is a user of the organisation of a stack.
+type User = models.OrgUserDTO
+
+func (sc *StackClient) ListTeams() ([]*Team, error) {
+
+	result := []*Team{}
+	perPage := int64(100)
+	for page := int64(1); ; page++ {
+		res, err := sc.httpApi.Teams.SearchTeams(teams.NewSearchTeamsParams().WithPage(&page).WithPerpage(&perPage))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list teams: %w", err)
+		}
+		if res.Payload == nil {
+			break
+		}
+		result = append(result, res.Payload.Teams...)
+		if int64(len(res.Payload.Teams)) < perPage || int64(len(result)) >= res.Payload.TotalCount {
+			break
+		}
+	}
+
+	return result, nil
+}
+
+func (sc *StackClient) GetTeamByName(name string) (*Team, error) {
+
+	res, err := sc.httpApi.Teams.SearchTeams(teams.NewSearchTeamsParams().WithName(&name))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to search team %s: %w", name, err)
+	}
+
+	if res.Payload != nil {
+		for _, team := range res.Payload.Teams {
+			if team.Name == name {
+				return team, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+func (sc *StackClient) CreateTeam(name, email string) (*Team, error) {
+
+	res, err := sc.httpApi.Teams.CreateTeam(&models.CreateTeamCommand{Name: name, Email: email})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create team %s: %w", name, err)
+	}
+
+	if res.Payload == nil {
+		return nil, fmt.Errorf("received no team data for: %s", name)
+	}
+
+	return &Team{ID: res.Payload.TeamID, UID: res.Payload.UID, Name: name, Email: email}, nil
+}
+
+func (sc *StackClient) UpdateTeam(team *Team) error {
+
+	_, err := sc.httpApi.Teams.UpdateTeam(strconv.FormatInt(team.ID, 10), &models.UpdateTeamCommand{
+		ID:    team.ID,
+		Name:  team.Name,
+		Email: team.Email,
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to update team %s: %w", team.Name, err)
+	}
+
+	return nil
+}
+
+func (sc *StackClient) DeleteTeam(teamID int64) error {
+
+	_, err := sc.httpApi.Teams.DeleteTeamByID(strconv.FormatInt(teamID, 10))
+
+	if err != nil {
+		return fmt.Errorf("failed to delete team %d: %w", teamID, err)
+	}
+
+	return nil
+}
+
+func (sc *StackClient) ListTeamMembers(teamID int64) ([]*TeamMember, error) {
+
+	res, err := sc.httpApi.Teams.GetTeamMembers(strconv.FormatInt(teamID, 10))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list members of team %d: %w", teamID, err)
+	}
+
+	return res.Payload, nil
+}
+
+func (sc *StackClient) AddTeamMember(teamID int64, loginOrEmail string) error {
+
+	userID, err := sc.userID(loginOrEmail)
+	if err != nil {
+		return fmt.Errorf("failed to add %s to team %d: %w", loginOrEmail, teamID, err)
+	}
+
+	_, err = sc.httpApi.Teams.AddTeamMember(strconv.FormatInt(teamID, 10), &models.AddTeamMemberCommand{UserID: userID})
+
+	if err != nil {
+		return fmt.Errorf("failed to add %s to team %d: %w", loginOrEmail, teamID, err)
+	}
+
+	return nil
+}
+
+func (sc *StackClient) RemoveTeamMember(teamID int64, loginOrEmail string) error {
+
+	members, err := sc.ListTeamMembers(teamID)
+	if err != nil {
+		return err
+	}
+
+	member := findTeamMember(members, loginOrEmail)
+	if member == nil {
+		return fmt.Errorf("failed to remove %s from team %d: not a member", loginOrEmail, teamID)
+	}
+
+	_, err = sc.httpApi.Teams.RemoveTeamMember(member.UserID, strconv.FormatInt(teamID, 10))
+
+	if err != nil {
+		return fmt.Errorf("failed to remove %s from team %d: %w", loginOrEmail, teamID, err)
+	}
+
+	return nil
+}
+
+func (sc *StackClient) ListUsers() ([]*User, error) {
+
+	users := []*User{}
+	perPage := 100
+	for page := 1; ; page++ {
+		// The generated client only lists the users of the current
+		// organisation without paging, use the search endpoint instead.
+		query := url.Values{
+			"page":    []string{strconv.Itoa(page)},
+			"perpage": []string{strconv.Itoa(perPage)},
+		}
+
+		res := models.SearchOrgUsersQueryResult{}
+		err := sc.submit(http.MethodGet, "/org/users/search", query, nil, &res)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list users: %w", err)
+		}
+
+		users = append(users, res.OrgUsers...)
+		if len(res.OrgUsers) < perPage || int64(len(users)) >= res.TotalCount {
+			return users, nil
+		}
+	}
+}
+
+// TeamSpec is the desired state of a team.
+type TeamSpec struct {
+	Name  string `json:"name" yaml:"name"`
+	Email string `json:"email,omitempty" yaml:"email,omitempty"`
+	// Members are the logins or emails of the users of the team.
+	Members []string `json:"members,omitempty" yaml:"members,omitempty"`
+}
+
+// TeamChangeAction is the kind of change ReconcileTeams made.
+type TeamChangeAction string
+
+const (
+	TeamCreated       TeamChangeAction = "create team"
+	TeamUpdated       TeamChangeAction = "update team"
+	TeamDeleted       TeamChangeAction = "delete team"
+	TeamMemberAdded   TeamChangeAction = "add member"
+	TeamMemberRemoved TeamChangeAction = "remove member"
+)
+
+// TeamChange is a change ReconcileTeams made to a stack.
+type TeamChange struct {
+	Action TeamChangeAction
+	Team   string
+	// Member is the login or email of the user added or removed.
+	Member string
+}
+
+func (c TeamChange) String() string {
+	switch c.Action {
+	case TeamMemberAdded:
+		return fmt.Sprintf("%s %s to team %s", c.Action, c.Member, c.Team)
+	case TeamMemberRemoved:
+		return fmt.Sprintf("%s %s from team %s", c.Action, c.Member, c.Team)
+	}
+	return fmt.Sprintf("%s %s", c.Action, c.Team)
+}
+
+// findTeamMember returns the member with the given login or email, compared
+// case-insensitively as Grafana does, or nil.
+func findTeamMember(members []*TeamMember, loginOrEmail string) *TeamMember {
+	for _, member := range members {
+		if strings.EqualFold(member.Login, loginOrEmail) || strings.EqualFold(member.Email, loginOrEmail) {
+			return member
+		}
+	}
+	return nil
+}
+
+// ReconcileTeams applies the desired teams to a stack, through a client
+// created with RoleAdmin: missing teams are
+// created, emails are updated and members are added or removed so that each
+// team has exactly the desired members. When deleteUnlisted is set, the teams
+// which are not desired are deleted.
+// It returns the changes made, including the ones made before an error.
+func ReconcileTeams(client TeamClient, desired []TeamSpec, deleteUnlisted bool) ([]TeamChange, error) {
+	changes := []TeamChange{}
+
+	existing, err := client.ListTeams()
+	if err != nil {
+		return changes, err
+	}
+	byName := map[string]*Team{}
+	for _, team := range existing {
+		byName[team.Name] = team
+	}
+
+	desiredNames := map[string]struct{}{}
+	for _, spec := range desired {
+		if spec.Name == "" {
+			return changes, fmt.Errorf("teams require a name")
+		}
+		desiredNames[spec.Name] = struct{}{}
+
+		team, ok := byName[spec.Name]
+		if !ok {
+			team, err = client.CreateTeam(spec.Name, spec.Email)
+			if err != nil {
+				return changes, err
+			}
+			changes = append(changes, TeamChange{Action: TeamCreated, Team: spec.Name})
+		} else if team.Email != spec.Email {
+			team.Email = spec.Email
+			err = client.UpdateTeam(team)
+			if err != nil {
+				return changes, err
+			}
+			changes = append(changes, TeamChange{Action: TeamUpdated, Team: spec.Name})
+		}
+
+		members, err := client.ListTeamMembers(team.ID)
+		if err != nil {
+			return changes, err
+		}
+
+		wanted := map[string]bool{}
+		for _, loginOrEmail := range spec.Members {
+			wanted[strings.ToLower(loginOrEmail)] = true
+			if findTeamMember(members, loginOrEmail) != nil {
+				continue
+			}
+			err = client.AddTeamMember(team.ID, loginOrEmail)
+			if err != nil {
+				return changes, err
+			}
+			changes = append(changes, TeamChange{Action: TeamMemberAdded, Team: spec.Name, Member: loginOrEmail})
+		}
+
+		for _, member := range members {
+			if wanted[strings.ToLower(member.Login)] || wanted[strings.ToLower(member.Email)] {
+				continue
+			}
+			loginOrEmail := member.Login
+			if loginOrEmail == "" {
+				loginOrEmail = member.Email
+			}
+			err = client.RemoveTeamMember(team.ID, loginOrEmail)
+			if err != nil {
+				return changes, err
+			}
+			changes = append(changes, TeamChange{Action: TeamMemberRemoved, Team: spec.Name, Member: loginOrEmail})
+		}
+	}
+
+	if deleteUnlisted {
+		sort.Slice(existing, func(i, j int) bool { return existing[i].Name < existing[j].Name })
+		for _, team := range existing {
+			if _, ok := desiredNames[team.Name]; ok {
+				continue
+			}
+			err = client.DeleteTeam(team.ID)
+			if err != nil {
+				return changes, err
+			}
+			changes = append(changes, TeamChange{Action: TeamDeleted, Team: team.Name})
+		}
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,243 @@
+package publisher
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	grafana "github.com/adevinta/go-grafana-toolkit/client"
+	log "github.com/adevinta/go-log-toolkit"
+	"github.com/spf13/afero"
+)
+
+// readAlertRuleGroupFile reads an alert rule group, or the tombstone of a
+// deleted alert rule group, rendered for the given stack.
+// Files have the shape of the Grafana provisioning API rule groups.
+func (p Publisher) readAlertRuleGroupFile(fsys afero.Fs, path string, stack *grafana.Stack) (*grafana.AlertRuleGroup, error) {
+	data, err := p.readStackDashboardSource(fsys, path, stack)
+	if err != nil {
+		return nil, err
+	}
+
+	group := &grafana.AlertRuleGroup{}
+	err = json.Unmarshal(data, group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode alert rule group %s: %w", path, err)
+	}
+
+	if group.Title == "" {
+		return nil, fmt.Errorf("unable to find alert rule group title in %s", path)
+	}
+	return group, nil
+}
+
+// syncAlertRules publishes the alert rule groups of a reference to the given
+// stacks.
+func (p Publisher) syncAlertRules(grafanaStacks grafana.Stacks, parentFolders map[string]*grafana.Folder, reference DashboardReference) error {
+	log.DefaultLogger.WithField("localFolder", reference.LocalFolder).WithField("grafanaFolder", reference.GrafanaFolder).Println("Syncing alert rules...")
+
+	_, err := reference.fileSystem().Stat(reference.LocalFolder)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("Failed to discover %s: %w", reference.LocalFolder, err)
+		}
+		log.DefaultLogger.WithField("localFolder", reference.LocalFolder).Info("Local folder not present, skipping sync.")
+		return nil
+	}
+
+	for _, stack := range grafanaStacks {
+		err := p.syncAlertRulesForStack(&stack, parentFolders[stack.Slug], reference)
+		if err != nil {
+			return fmt.Errorf("failed to sync alert rules for stack %s: %w", stack.Slug, err)
+		}
+	}
+	return nil
+}
+
+// syncAlertRulesForStack creates or replaces the alert rule groups of a
+// reference in a single stack, and deletes the ones with a tombstone.
+func (p Publisher) syncAlertRulesForStack(stack *grafana.Stack, parentFolder *grafana.Folder, reference DashboardReference) error {
+	sc, err := p.stackClient(stack)
+	if err != nil {
+		return fmt.Errorf("failed to get grafana stack client for stack %v, error: %w", stack.Slug, err)
+	}
+
+	folder, err := sc.EnsureFolder(parentFolder, reference.GrafanaFolder)
+	if err != nil {
+		return fmt.Errorf("could not ensure folder %s: %w", reference.GrafanaFolder, err)
+	}
+
+	err = enforceFolderPermissions(sc, folder, reference.Permissions)
+	if err != nil {
+		return err
+	}
+
+	subfolders := map[string]*grafana.Folder{".": folder}
+	datasources := map[string]string{}
+
+	err = walkDashboardFiles(reference, func(path string, info os.FileInfo) error {
+		dir, err := filepath.Rel(reference.LocalFolder, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		if !reference.NestedFolders {
+			dir = "."
+		}
+
+		switch filepath.Ext(p.renderedPath(path)) {
+		case ".json", ".yaml", ".yml":
+			log.DefaultLogger.WithField("alertRules", path).WithField("destination", stack.Slug).Println("Syncing alert rule group")
+
+			group, err := p.readAlertRuleGroupFile(reference.fileSystem(), path, stack)
+			if err != nil {
+				return err
+			}
+
+			err = p.setAlertRuleUIDs(reference, path, group)
+			if err != nil {
+				return err
+			}
+
+			folder, err := ensureSubfolder(sc, subfolders, dir)
+			if err != nil {
+				return err
+			}
+
+			group.FolderUID = folder.UID
+			for _, rule := range group.Rules {
+				rule.FolderUID = &folder.UID
+				rule.RuleGroup = &group.Title
+
+				for _, query := range rule.Data {
+					if query == nil {
+						continue
+					}
+					query.DatasourceUID, err = p.resolveAlertDatasource(sc, stack, datasources, query.DatasourceUID)
+					if err != nil {
+						return fmt.Errorf("%w in %s", err, path)
+					}
+					if model, ok := query.Model.(map[string]interface{}); ok {
+						if datasource, ok := model["datasource"].(map[string]interface{}); ok {
+							if uid, ok := datasource["uid"].(string); ok {
+								datasource["uid"], err = p.resolveAlertDatasource(sc, stack, datasources, uid)
+								if err != nil {
+									return fmt.Errorf("%w in %s", err, path)
+								}
+							}
+						}
+					}
+				}
+			}
+
+			return sc.PutAlertRuleGroup(group)
+
+		case ".deleted":
+			log.DefaultLogger.WithField("alertRules", path).WithField("destination", stack.Slug).Println("Deleting alert rule group")
+
+			group, err := p.readAlertRuleGroupFile(reference.fileSystem(), path, stack)
+			if err != nil {
+				return err
+			}
+
+			// Tombstones do not create the folder of their directory, whose
+			// UID is derived as when it was created.
+			folderUID := lookupSubfolderUID(subfolders, dir)
+			existing, err := sc.GetAlertRuleGroup(folderUID, group.Title)
+			if err != nil {
+				return err
+			}
+			if existing != nil {
+				return sc.DeleteAlertRuleGroup(folderUID, group.Title)
+			}
+
+		default:
+			switch p.config.UnknownFiles {
+			case UnknownFilesIgnore:
+			case UnknownFilesWarn:
+				log.DefaultLogger.WithField("file", path).WithField("destination", stack.Slug).Warn("Skipping file with unsupported extension")
+			default:
+				return fmt.Errorf("unsupported file extension %s for path %v", filepath.Ext(path), path)
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if reference.NestedFolders {
+		err = pruneSubfolders(sc, folder, reference, ".")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setAlertRuleUIDs sets the UIDs the rules of a group read from path are
+// published with. Rules without uid get one derived from their Grafana
+// folder path, group and title, so that publishing again updates them
+// instead of adding new ones.
+func (p Publisher) setAlertRuleUIDs(reference DashboardReference, path string, group *grafana.AlertRuleGroup) error {
+	folderPath := reference.GrafanaFolder
+	if reference.NestedFolders {
+		dir, err := filepath.Rel(reference.LocalFolder, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		folderPath = filepath.ToSlash(filepath.Join(folderPath, dir))
+	}
+
+	for _, rule := range group.Rules {
+		if rule == nil {
+			return fmt.Errorf("unexpected empty alert rule in %s", path)
+		}
+
+		var err error
+		if rule.UID == "" {
+			if rule.Title == nil || *rule.Title == "" {
+				return fmt.Errorf("alert rules without uid require a title in %s", path)
+			}
+			rule.UID, err = p.publishedUID("", folderPath+"/"+group.Title+"/"+*rule.Title)
+		} else {
+			rule.UID, err = p.publishedUID(rule.UID, "")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveAlertDatasource returns the UID of the stack datasource a datasource
+// variable reference, such as ${PROMPRO}, of an alert query is bound to.
+// Other datasource UIDs are returned as is. Resolved UIDs are cached in
+// datasources.
+func (p Publisher) resolveAlertDatasource(sc grafana.GrafanaStackClient, stack *grafana.Stack, datasources map[string]string, uid string) (string, error) {
+	name := strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(uid, "$"), "{"), "}")
+	if name == uid {
+		return uid, nil
+	}
+
+	variable, ok := lookupDatasourceVariable(name)
+	if !ok {
+		return "", fmt.Errorf("unsupported datasource variable %s", uid)
+	}
+
+	datasourceName := variable.datasourceValue(stack)
+	if resolved, ok := datasources[datasourceName]; ok {
+		return resolved, nil
+	}
+
+	datasource, err := sc.GetDataSource(datasourceName)
+	if err != nil {
+		return "", fmt.Errorf("failed to get datasource %s for %s: %w", datasourceName, uid, err)
+	}
+
+	datasources[datasourceName] = datasource.UID
+	return datasource.UID, nil
+}
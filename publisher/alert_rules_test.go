@@ -0,0 +1,141 @@
+package publisher
+
+import (
+	"os"
+	"testing"
+
+	grafana "github.com/adevinta/go-grafana-toolkit/client"
+	system "github.com/adevinta/go-system-toolkit"
+	testutils "github.com/adevinta/go-testutils-toolkit"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublishAlertRules(t *testing.T) {
+	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+
+	system.DefaultFileSystem = afero.NewMemMapFs()
+	defer func() { system.DefaultFileSystem = afero.NewOsFs() }()
+
+	require.NoError(t, system.DefaultFileSystem.MkdirAll("/alert_rules", 0777))
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/alert_rules/errors.yaml", `
+title: errors
+interval: 60
+rules:
+- uid: high-error-rate
+  title: High error rate
+  condition: B
+  for: 5m
+  noDataState: OK
+  execErrState: Error
+  data:
+  - refId: A
+    datasourceUid: ${PROMPRO}
+    relativeTimeRange: {from: 600, to: 0}
+    model:
+      datasource: {type: prometheus, uid: "${PROMPRO}"}
+      expr: sum(rate(errors_total[5m]))
+  - refId: B
+    datasourceUid: __expr__
+    model: {type: threshold, expression: A}
+- title: Error budget burn
+  condition: A
+  data:
+  - refId: A
+    datasourceUid: __expr__
+    model: {type: math, expression: "1"}
+`)
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/alert_rules/latency.json.deleted", `{"title": "latency"}`)
+
+	cloudClient := new(MockCloudClient)
+	testStackClient := new(MockStackClient)
+	alertsFolder := &grafana.Folder{UID: "alerts-folder-uid", Title: "Alerts"}
+
+	cloudClient.
+		On("ListStacks").
+		Return(grafana.Stacks{testStack}, nil).
+		Once()
+	cloudClient.
+		On("NewStackClient", &testStack).
+		Return(testStackClient, nil)
+
+	testStackClient.
+		On("EnsureFolder", nilFolder, "Alerts").
+		Return(alertsFolder, nil)
+	testStackClient.
+		On("GetDataSource", "grafanacloud-test-stack-prom").
+		Return(&grafana.Datasource{Name: "grafanacloud-test-stack-prom", UID: "prom-uid"}, nil).
+		Once()
+	testStackClient.
+		On("PutAlertRuleGroup", mock.AnythingOfType("*models.AlertRuleGroup")).
+		Run(func(args mock.Arguments) {
+			group := args.Get(0).(*grafana.AlertRuleGroup)
+			assert.Equal(t, "errors", group.Title)
+			assert.Equal(t, "alerts-folder-uid", group.FolderUID)
+			assert.Equal(t, int64(60), group.Interval)
+			require.Len(t, group.Rules, 2)
+
+			rule := group.Rules[0]
+			assert.Equal(t, "high-error-rate", rule.UID)
+			assert.Equal(t, "alerts-folder-uid", *rule.FolderUID)
+			assert.Equal(t, "errors", *rule.RuleGroup)
+			require.Len(t, rule.Data, 2)
+			assert.Equal(t, "prom-uid", rule.Data[0].DatasourceUID)
+			assert.Equal(t, map[string]interface{}{"type": "prometheus", "uid": "prom-uid"}, rule.Data[0].Model.(map[string]interface{})["datasource"])
+			assert.Equal(t, "__expr__", rule.Data[1].DatasourceUID)
+
+			assert.Equal(t, GenerateUniqueID("Alerts/errors/Error budget burn"), group.Rules[1].UID)
+		}).
+		Return(nil).
+		Once()
+	testStackClient.
+		On("GetAlertRuleGroup", "alerts-folder-uid", "latency").
+		Return(&grafana.AlertRuleGroup{Title: "latency", FolderUID: "alerts-folder-uid"}, nil)
+	testStackClient.
+		On("DeleteAlertRuleGroup", "alerts-folder-uid", "latency").
+		Return(nil).
+		Once()
+	testStackClient.On("Cleanup").Return(nil)
+
+	pub, err := NewPublisher(
+		WithCloudClient(cloudClient),
+		WithConfig(&PublisherConfig{
+			AlertRules: DashboardReferences{{LocalFolder: "/alert_rules", GrafanaFolder: "Alerts"}},
+			TestStack:  "test-stack",
+		}),
+	)
+	require.NoError(t, err)
+
+	err = pub.Publish(false)
+	assert.NoError(t, err)
+
+	cloudClient.AssertExpectations(t)
+	testStackClient.AssertExpectations(t)
+}
+
+func TestPruneSubfoldersKeepsFoldersWithAlertRules(t *testing.T) {
+	system.DefaultFileSystem = afero.NewMemMapFs()
+	defer func() { system.DefaultFileSystem = afero.NewOsFs() }()
+
+	require.NoError(t, system.DefaultFileSystem.MkdirAll("/alert_rules", 0777))
+
+	alertsFolder := &grafana.Folder{UID: "alerts-folder-uid", Title: "Alerts"}
+	removedFolder := &grafana.Folder{UID: subfolderUID(alertsFolder, "removed"), Title: "removed"}
+
+	testStackClient := new(MockStackClient)
+	testStackClient.On("ListFolders", alertsFolder).Return([]*grafana.Folder{removedFolder}, nil)
+	testStackClient.On("ListFolders", removedFolder).Return([]*grafana.Folder{}, nil)
+	testStackClient.
+		On("DeleteFolderIfEmpty", removedFolder.UID).
+		Return(&grafana.FolderNotEmptyError{UID: removedFolder.UID, Counts: map[string]int64{"alertrule": 1}}).
+		Once()
+
+	err := pruneSubfolders(testStackClient, alertsFolder, DashboardReference{LocalFolder: "/alert_rules"}, ".")
+	require.NoError(t, err)
+
+	testStackClient.AssertExpectations(t)
+	testStackClient.AssertNotCalled(t, "DeleteFolder", mock.Anything)
+}
@@ -0,0 +1,519 @@
+package publisher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	grafana "github.com/adevinta/go-grafana-toolkit/client"
+	log "github.com/adevinta/go-log-toolkit"
+)
+
+// CleanupTarget selects the dashboards removed by Cleanup.
+type CleanupTarget struct {
+	// IDSuffix selects the dashboards, library panels and alert rule groups
+	// under the root folder whose UID ends with it, such as the ones published
+	// for a pull request. It defaults to the configured IDSuffix.
+	IDSuffix string
+
+	// Tag selects the dashboards holding it, under the root folder when one
+	// is configured.
+	Tag string
+}
+
+// Cleanup deletes the resources published under the root folder with an ID
+// suffix, or the dashboards holding a tag, typically once the pull request
+// they were previewed for is closed.
+// When a root folder is configured, the dashboards holding the tag are only
+// deleted under it, and the folders of the references and the root folder
+// itself are deleted as well once empty.
+// If syncAllStacks is true, it cleans all non-excluded stacks.
+// If syncAllStacks is false, it cleans only the test stack.
+// Requires GRAFANA_CLOUD_TOKEN environment variable to be set.
+func (p Publisher) Cleanup(syncAllStacks bool, target CleanupTarget) error {
+
+	if _, ok := os.LookupEnv("GRAFANA_CLOUD_TOKEN"); !ok {
+		fmt.Fprint(os.Stderr, "GRAFANA_CLOUD_TOKEN not set, skipping grafana cleanup")
+		return nil
+	}
+
+	if target.IDSuffix == "" {
+		target.IDSuffix = p.config.IDSuffix
+	}
+	// Without any selector every dashboard of the stacks would be deleted.
+	if target.IDSuffix == "" && target.Tag == "" {
+		return errors.New("cleanup requires an ID suffix or a tag")
+	}
+	// The ID suffix is only applied under a root folder.
+	if target.Tag == "" && p.config.RootFolder == "" {
+		return errors.New("cleanup by ID suffix requires a root folder")
+	}
+	// The configured tags are added to every published dashboard.
+	if target.Tag != "" && p.config.RootFolder == "" {
+		for _, tag := range p.config.Tags {
+			if tag == target.Tag {
+				return fmt.Errorf("cleanup by the configured tag %s requires a root folder", tag)
+			}
+		}
+	}
+
+	// Local dashboards are matched with the UID they were published with.
+	config := *p.config
+	config.IDSuffix = target.IDSuffix
+	p.config = &config
+
+	p.mode = PublishModeTest
+	if syncAllStacks {
+		p.mode = PublishModeAll
+	}
+
+	if p.gcc == nil {
+		cloudClient, err := grafana.NewCloudClient()
+		if err != nil {
+			return fmt.Errorf("failed to create Grafana Cloud client: %w", err)
+		}
+		p.gcc = cloudClient
+	}
+
+	stacksWithCommonDashboards, stacksWithCustomDashboards, err := p.selectStacks(syncAllStacks)
+	if err != nil {
+		return err
+	}
+
+	p.stackClients = map[string]grafana.GrafanaStackClient{}
+	defer p.cleanupStackClients()
+
+	errs := []error{}
+	for _, stack := range uniqueStacks(append(stacksWithCommonDashboards, stacksWithCustomDashboards...)) {
+		err = p.cleanupStack(&stack, target)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cleanup failed for stack %s: %w", stack.Slug, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// cleanupStack deletes the dashboards, alert rule groups and library panels
+// selected by the target from a stack, then the folders left empty under the
+// root folder.
+func (p Publisher) cleanupStack(stack *grafana.Stack, target CleanupTarget) error {
+	sc, err := p.stackClient(stack)
+
+	if err != nil {
+		return fmt.Errorf("failed to get grafana stack client for stack %v, error: %w", stack.Slug, err)
+	}
+
+	// Resources are only selected under the root folder, when one is
+	// configured, so that resources published by other means are never
+	// deleted.
+	folders := []*grafana.Folder{}
+	if p.config.RootFolder != "" {
+		folders, err = rootFolderTree(sc, p.config.RootFolder)
+		if err != nil {
+			return err
+		}
+	}
+
+	uids, err := p.cleanupDashboardUIDs(sc, stack, target, folders)
+	if err != nil {
+		return err
+	}
+
+	for _, uid := range uids {
+		log.DefaultLogger.WithField("dashboard", uid).WithField("destination", stack.Slug).Println("Deleting dashboard")
+		err = sc.DeleteDashboard(uid)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Library panels are deleted last, as Grafana refuses to delete the ones
+	// still used by dashboards or alert rules.
+	err = p.cleanupAlertRuleGroups(sc, stack, target, folders)
+	if err != nil {
+		return err
+	}
+	err = p.cleanupLibraryPanels(sc, stack, target, folders)
+	if err != nil {
+		return err
+	}
+
+	if p.config.RootFolder != "" {
+		return p.cleanupFolders(sc)
+	}
+	return nil
+}
+
+// rootFolderTree returns the folders of a root folder path and all their
+// subfolders. It returns no folder when the root folder does not exist.
+func rootFolderTree(sc grafana.GrafanaStackClient, rootFolder string) ([]*grafana.Folder, error) {
+	rootFolders, err := lookupFolderPath(sc, rootFolder)
+	if err != nil {
+		return nil, fmt.Errorf("could not look up root folder %s: %w", rootFolder, err)
+	}
+	if len(rootFolders) == 0 {
+		return nil, nil
+	}
+
+	folders := []*grafana.Folder{rootFolders[len(rootFolders)-1]}
+	for i := 0; i < len(folders); i++ {
+		children, err := sc.ListFolders(folders[i])
+		if err != nil {
+			return nil, err
+		}
+		folders = append(folders, children...)
+	}
+	return folders, nil
+}
+
+// cleanupDashboardUIDs returns the sorted UIDs of the dashboards of a stack
+// selected by the target.
+// With a root folder, only the dashboards of the given folders are selected.
+// Besides the UIDs ending with the ID suffix in them, the local dashboards
+// published in them are selected, as their UIDs may have been hashed.
+func (p Publisher) cleanupDashboardUIDs(sc grafana.GrafanaStackClient, stack *grafana.Stack, target CleanupTarget, folders []*grafana.Folder) ([]string, error) {
+	selected := map[string]struct{}{}
+
+	inFolders := map[string]struct{}{}
+	if len(folders) > 0 {
+		local := []string{}
+		if target.IDSuffix != "" {
+			var err error
+			local, err = p.localDashboardUIDs(stack)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, folder := range folders {
+			uids, err := sc.ListDashboardIDsInFolder(folder.UID)
+			if err != nil {
+				return nil, err
+			}
+			for _, uid := range uids {
+				inFolders[uid] = struct{}{}
+				if target.IDSuffix != "" && isPreviewUID(uid, target.IDSuffix, local) {
+					selected[uid] = struct{}{}
+				}
+			}
+		}
+	}
+
+	if target.Tag != "" {
+		uids, err := sc.ListDashboardIDs(target.Tag)
+		if err != nil {
+			return nil, err
+		}
+		for _, uid := range uids {
+			if _, ok := inFolders[uid]; p.config.RootFolder != "" && !ok {
+				continue
+			}
+			selected[uid] = struct{}{}
+		}
+	}
+
+	result := make([]string, 0, len(selected))
+	for uid := range selected {
+		result = append(result, uid)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// cleanupAlertRuleGroups deletes the alert rule groups of the given folders
+// holding a rule selected by the target.
+func (p Publisher) cleanupAlertRuleGroups(sc grafana.GrafanaStackClient, stack *grafana.Stack, target CleanupTarget, folders []*grafana.Folder) error {
+	if len(folders) == 0 || target.IDSuffix == "" {
+		return nil
+	}
+
+	local, err := p.localAlertRuleUIDs(stack)
+	if err != nil {
+		return err
+	}
+
+	for _, folder := range folders {
+		groups, err := sc.ListAlertRuleGroups(folder.UID)
+		if err != nil {
+			return err
+		}
+		for _, group := range groups {
+			selected := false
+			for _, rule := range group.Rules {
+				if rule != nil && isPreviewUID(rule.UID, target.IDSuffix, local) {
+					selected = true
+					break
+				}
+			}
+			if !selected {
+				continue
+			}
+
+			log.DefaultLogger.WithField("alertRules", group.Title).WithField("destination", stack.Slug).Println("Deleting alert rule group")
+			err = sc.DeleteAlertRuleGroup(folder.UID, group.Title)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// cleanupLibraryPanels deletes the library panels of the given folders
+// selected by the target.
+func (p Publisher) cleanupLibraryPanels(sc grafana.GrafanaStackClient, stack *grafana.Stack, target CleanupTarget, folders []*grafana.Folder) error {
+	if len(folders) == 0 || target.IDSuffix == "" {
+		return nil
+	}
+
+	local, err := p.localLibraryPanelUIDs(stack)
+	if err != nil {
+		return err
+	}
+
+	for _, folder := range folders {
+		panels, err := sc.ListLibraryPanels(folder.UID)
+		if err != nil {
+			return err
+		}
+		for _, panel := range panels {
+			if !isPreviewUID(panel.UID, target.IDSuffix, local) {
+				continue
+			}
+
+			log.DefaultLogger.WithField("libraryPanel", panel.UID).WithField("destination", stack.Slug).Println("Deleting library panel")
+			err = sc.DeleteLibraryPanel(panel.UID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isPreviewUID reports whether a UID found under the root folder was
+// published with the ID suffix, either as is or hashed from a local UID.
+func isPreviewUID(uid, idSuffix string, local []string) bool {
+	if strings.HasSuffix(uid, idSuffix) {
+		return true
+	}
+	for _, localUID := range local {
+		if uid == localUID {
+			return true
+		}
+	}
+	return false
+}
+
+// localDashboardUIDs returns the UIDs the local dashboards of every
+// reference are published with on a stack.
+func (p Publisher) localDashboardUIDs(stack *grafana.Stack) ([]string, error) {
+	uids := []string{}
+	for _, reference := range append(p.config.CommonDashboards, p.config.CustomDashboards...) {
+		if reference.LocalFolder == "" || reference.GrafanaFolder == "" {
+			continue
+		}
+		referenceUIDs, err := p.referenceDashboardUIDs(stack, reference)
+		if err != nil {
+			return nil, err
+		}
+		uids = append(uids, referenceUIDs...)
+	}
+	return uids, nil
+}
+
+// referenceDashboardUIDs returns the UIDs the local dashboards of a reference
+// are published with on a stack.
+func (p Publisher) referenceDashboardUIDs(stack *grafana.Stack, reference DashboardReference) ([]string, error) {
+	_, err := reference.fileSystem().Stat(reference.LocalFolder)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to discover %s: %w", reference.LocalFolder, err)
+	}
+
+	uids := []string{}
+	err = walkDashboardFiles(reference, func(path string, info os.FileInfo) error {
+		switch filepath.Ext(p.renderedPath(path)) {
+		case ".json", ".yaml", ".yml":
+		default:
+			return nil
+		}
+
+		data, err := p.readStackDashboardSource(reference.fileSystem(), path, stack)
+		if err != nil {
+			return err
+		}
+
+		dashboard := map[string]interface{}{}
+		err = json.Unmarshal(data, &dashboard)
+		if err != nil {
+			return err
+		}
+
+		dash, ok := dashboard["dashboard"].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("unable to find dashboard in %s", path)
+		}
+
+		uid, err := p.dashboardUID(dash)
+		if err != nil {
+			return fmt.Errorf("%w in %s", err, path)
+		}
+		uids = append(uids, uid)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return uids, nil
+}
+
+// localLibraryPanelUIDs returns the UIDs the local library panels are
+// published with on a stack.
+func (p Publisher) localLibraryPanelUIDs(stack *grafana.Stack) ([]string, error) {
+	uids := []string{}
+	err := p.walkLocalFiles(p.config.LibraryPanels, func(reference DashboardReference, path string) error {
+		panel, err := p.readLibraryPanelFile(reference.fileSystem(), path, stack)
+		if err != nil {
+			return err
+		}
+		uid, err := p.publishedUID(panel.UID, panel.Name)
+		if err != nil {
+			return fmt.Errorf("unable to find library panel name in %s", path)
+		}
+		uids = append(uids, uid)
+		return nil
+	})
+	return uids, err
+}
+
+// localAlertRuleUIDs returns the UIDs the local alert rules are published
+// with on a stack.
+func (p Publisher) localAlertRuleUIDs(stack *grafana.Stack) ([]string, error) {
+	uids := []string{}
+	err := p.walkLocalFiles(p.config.AlertRules, func(reference DashboardReference, path string) error {
+		group, err := p.readAlertRuleGroupFile(reference.fileSystem(), path, stack)
+		if err != nil {
+			return err
+		}
+		err = p.setAlertRuleUIDs(reference, path, group)
+		if err != nil {
+			return err
+		}
+		for _, rule := range group.Rules {
+			uids = append(uids, rule.UID)
+		}
+		return nil
+	})
+	return uids, err
+}
+
+// walkLocalFiles calls fn for the JSON and YAML files of the references
+// whose local folder exists.
+func (p Publisher) walkLocalFiles(references DashboardReferences, fn func(reference DashboardReference, path string) error) error {
+	for _, reference := range references {
+		if reference.LocalFolder == "" {
+			continue
+		}
+		_, err := reference.fileSystem().Stat(reference.LocalFolder)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to discover %s: %w", reference.LocalFolder, err)
+		}
+
+		err = walkDashboardFiles(reference, func(path string, info os.FileInfo) error {
+			switch filepath.Ext(p.renderedPath(path)) {
+			case ".json", ".yaml", ".yml":
+				return fn(reference, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cleanupFolders deletes the folders of the dashboard, library panel and
+// alert rule references under the root folder, and the levels of the root
+// folder, which are left empty.
+func (p Publisher) cleanupFolders(sc grafana.GrafanaStackClient) error {
+	rootFolders, err := lookupFolderPath(sc, p.config.RootFolder)
+	if err != nil {
+		return fmt.Errorf("could not look up root folder %s: %w", p.config.RootFolder, err)
+	}
+	if len(rootFolders) == 0 {
+		return nil
+	}
+	rootFolder := rootFolders[len(rootFolders)-1]
+
+	cleaned := map[string]struct{}{}
+	references := append(append(append(DashboardReferences{}, p.config.CommonDashboards...), p.config.CustomDashboards...), p.config.LibraryPanels...)
+	for _, reference := range append(references, p.config.AlertRules...) {
+		if reference.GrafanaFolder == "" {
+			continue
+		}
+		if _, ok := cleaned[reference.GrafanaFolder]; ok {
+			continue
+		}
+		cleaned[reference.GrafanaFolder] = struct{}{}
+
+		folder, err := sc.GetFolder(rootFolder, reference.GrafanaFolder)
+		if err != nil {
+			return err
+		}
+		if folder == nil {
+			continue
+		}
+		err = deleteEmptyFolders(sc, folder)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := len(rootFolders) - 1; i >= 0; i-- {
+		err = sc.DeleteFolderIfEmpty(rootFolders[i].UID)
+		var notEmpty *grafana.FolderNotEmptyError
+		if errors.As(err, &notEmpty) {
+			if i == len(rootFolders)-1 {
+				log.DefaultLogger.WithField("rootFolder", p.config.RootFolder).Warn(notEmpty.Error())
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteEmptyFolders deletes a folder and its subfolders when they are
+// empty. Folders still holding resources are kept.
+func deleteEmptyFolders(sc grafana.GrafanaStackClient, folder *grafana.Folder) error {
+	children, err := sc.ListFolders(folder)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		err = deleteEmptyFolders(sc, child)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = sc.DeleteFolderIfEmpty(folder.UID)
+	var notEmpty *grafana.FolderNotEmptyError
+	if errors.As(err, &notEmpty) {
+		log.DefaultLogger.WithField("folder", folder.Title).Warn(notEmpty.Error())
+		return nil
+	}
+	return err
+}
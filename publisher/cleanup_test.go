@@ -0,0 +1,342 @@
+package publisher
+
+import (
+	"os"
+	"testing"
+
+	grafana "github.com/adevinta/go-grafana-toolkit/client"
+	system "github.com/adevinta/go-system-toolkit"
+	testutils "github.com/adevinta/go-testutils-toolkit"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCleanup(t *testing.T) {
+	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+
+	t.Run("should delete the resources and folders of a pull request", func(t *testing.T) {
+		system.DefaultFileSystem = afero.NewMemMapFs()
+		defer func() { system.DefaultFileSystem = afero.NewOsFs() }()
+
+		require.NoError(t, system.DefaultFileSystem.MkdirAll("/local_folder_1", 0777))
+		testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/dashboard.json", `{"dashboard": {"uid": "dash-1", "title": "Dashboard"}}`)
+		testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/long.json", `{"dashboard": {"uid": "a-dashboard-uid-close-to-the-limit", "title": "Long"}}`)
+		hashedUID := GenerateUniqueID("a-dashboard-uid-close-to-the-limit-pr-1234")
+		require.NoError(t, system.DefaultFileSystem.MkdirAll("/alert_rules", 0777))
+		testutils.EnsureFileContent(t, system.DefaultFileSystem, "/alert_rules/errors.yaml", `
+title: errors
+rules:
+- title: Error budget burn
+`)
+		hashedRuleUID := GenerateUniqueID(GenerateUniqueID("Alerts/errors/Error budget burn") + "-pr-1234")
+
+		previewsFolder := &grafana.Folder{UID: "previews-uid", Title: "previews"}
+		prFolder := &grafana.Folder{UID: "pr-uid", Title: "pr-1234"}
+		prCommonFolder := &grafana.Folder{UID: "pr-common-uid", Title: "Common"}
+		prTeamFolder := &grafana.Folder{UID: "pr-team-uid", Title: "team-a"}
+		prAlertsFolder := &grafana.Folder{UID: "pr-alerts-uid", Title: "Alerts"}
+
+		cloudClient := new(MockCloudClient)
+		testStackClient := new(MockStackClient)
+
+		cloudClient.
+			On("ListStacks").
+			Return(grafana.Stacks{testStack}, nil).
+			Once()
+		cloudClient.
+			On("NewStackClient", &testStack).
+			Return(testStackClient, nil)
+
+		testStackClient.
+			On("ListDashboardIDsInFolder", "pr-uid").
+			Return([]string{}, nil).
+			Once()
+		testStackClient.
+			On("ListDashboardIDsInFolder", "pr-common-uid").
+			Return([]string{"dash-1-pr-1234", "other-pr-999", hashedUID}, nil).
+			Once()
+		testStackClient.
+			On("ListDashboardIDsInFolder", "pr-team-uid").
+			Return([]string{}, nil).
+			Once()
+		testStackClient.
+			On("ListDashboardIDsInFolder", "pr-alerts-uid").
+			Return([]string{}, nil).
+			Once()
+		testStackClient.
+			On("ListAlertRuleGroups", "pr-uid").
+			Return([]*grafana.AlertRuleGroup{}, nil).
+			Once()
+		testStackClient.
+			On("ListAlertRuleGroups", "pr-common-uid").
+			Return([]*grafana.AlertRuleGroup{
+				{Title: "latency", FolderUID: "pr-common-uid", Rules: []*grafana.AlertRule{{UID: "latency-pr-1234"}}},
+				{Title: "manual", FolderUID: "pr-common-uid", Rules: []*grafana.AlertRule{{UID: "manual"}}},
+			}, nil).
+			Once()
+		testStackClient.
+			On("ListAlertRuleGroups", "pr-team-uid").
+			Return([]*grafana.AlertRuleGroup{
+				{Title: "errors", FolderUID: "pr-team-uid", Rules: []*grafana.AlertRule{{UID: hashedRuleUID}}},
+			}, nil).
+			Once()
+		testStackClient.
+			On("ListAlertRuleGroups", "pr-alerts-uid").
+			Return([]*grafana.AlertRuleGroup{}, nil).
+			Once()
+		testStackClient.
+			On("DeleteAlertRuleGroup", "pr-common-uid", "latency").
+			Return(nil).
+			Once()
+		testStackClient.
+			On("DeleteAlertRuleGroup", "pr-team-uid", "errors").
+			Return(nil).
+			Once()
+		testStackClient.
+			On("ListLibraryPanels", "pr-uid").
+			Return([]*grafana.LibraryPanel{}, nil).
+			Once()
+		testStackClient.
+			On("ListLibraryPanels", "pr-common-uid").
+			Return([]*grafana.LibraryPanel{{UID: "errors-pr-1234"}, {UID: "shared"}}, nil).
+			Once()
+		testStackClient.
+			On("ListLibraryPanels", "pr-team-uid").
+			Return([]*grafana.LibraryPanel{}, nil).
+			Once()
+		testStackClient.
+			On("ListLibraryPanels", "pr-alerts-uid").
+			Return([]*grafana.LibraryPanel{}, nil).
+			Once()
+		testStackClient.
+			On("DeleteLibraryPanel", "errors-pr-1234").
+			Return(nil).
+			Once()
+		testStackClient.
+			On("DeleteDashboard", "dash-1-pr-1234").
+			Return(nil).
+			Once()
+		testStackClient.
+			On("DeleteDashboard", hashedUID).
+			Return(nil).
+			Once()
+		testStackClient.
+			On("GetFolder", nilFolder, "previews").
+			Return(previewsFolder, nil)
+		testStackClient.
+			On("GetFolder", previewsFolder, "pr-1234").
+			Return(prFolder, nil)
+		testStackClient.
+			On("GetFolder", prFolder, "Common").
+			Return(prCommonFolder, nil)
+		// The folders of the alert rule references are deleted as well.
+		testStackClient.
+			On("GetFolder", prFolder, "Alerts").
+			Return(prAlertsFolder, nil)
+		testStackClient.
+			On("ListFolders", prFolder).
+			Return([]*grafana.Folder{prCommonFolder, prAlertsFolder}, nil)
+		testStackClient.
+			On("ListFolders", prAlertsFolder).
+			Return([]*grafana.Folder{}, nil)
+		testStackClient.
+			On("DeleteFolderIfEmpty", "pr-alerts-uid").
+			Return(nil).
+			Once()
+		testStackClient.
+			On("ListFolders", prCommonFolder).
+			Return([]*grafana.Folder{prTeamFolder}, nil)
+		testStackClient.
+			On("ListFolders", prTeamFolder).
+			Return([]*grafana.Folder{}, nil)
+		testStackClient.
+			On("DeleteFolderIfEmpty", "pr-team-uid").
+			Return(nil).
+			Once()
+		testStackClient.
+			On("DeleteFolderIfEmpty", "pr-common-uid").
+			Return(nil).
+			Once()
+		testStackClient.
+			On("DeleteFolderIfEmpty", "pr-uid").
+			Return(nil).
+			Once()
+		testStackClient.
+			On("DeleteFolderIfEmpty", "previews-uid").
+			Return(&grafana.FolderNotEmptyError{UID: "previews-uid", Counts: map[string]int64{"folder": 3}}).
+			Once()
+		testStackClient.On("Cleanup").Return(nil)
+
+		pub, err := NewPublisher(
+			WithCloudClient(cloudClient),
+			WithConfig(&PublisherConfig{
+				CommonDashboards: DashboardReferences{{
+					LocalFolder:   "/local_folder_1",
+					GrafanaFolder: "Common",
+				}},
+				AlertRules: DashboardReferences{{
+					LocalFolder:   "/alert_rules",
+					GrafanaFolder: "Alerts",
+				}},
+				TestStack:  "test-stack",
+				RootFolder: "previews/pr-1234",
+				IDSuffix:   "-pr-1234",
+			}),
+		)
+		require.NoError(t, err)
+
+		err = pub.Cleanup(false, CleanupTarget{})
+		assert.NoError(t, err)
+
+		cloudClient.AssertExpectations(t)
+		testStackClient.AssertExpectations(t)
+	})
+
+	t.Run("should delete the dashboards holding a tag", func(t *testing.T) {
+		cloudClient := new(MockCloudClient)
+		testStackClient := new(MockStackClient)
+
+		cloudClient.
+			On("ListStacks").
+			Return(grafana.Stacks{testStack}, nil).
+			Once()
+		cloudClient.
+			On("NewStackClient", &testStack).
+			Return(testStackClient, nil)
+
+		testStackClient.
+			On("ListDashboardIDs", "pr-1234").
+			Return([]string{"dash-1", "dash-2"}, nil).
+			Once()
+		testStackClient.
+			On("DeleteDashboard", "dash-1").
+			Return(nil).
+			Once()
+		testStackClient.
+			On("DeleteDashboard", "dash-2").
+			Return(nil).
+			Once()
+		testStackClient.On("Cleanup").Return(nil)
+
+		pub, err := NewPublisher(
+			WithCloudClient(cloudClient),
+			WithConfig(&PublisherConfig{TestStack: "test-stack"}),
+		)
+		require.NoError(t, err)
+
+		err = pub.Cleanup(false, CleanupTarget{Tag: "pr-1234"})
+		assert.NoError(t, err)
+
+		cloudClient.AssertExpectations(t)
+		testStackClient.AssertExpectations(t)
+	})
+
+	t.Run("should only delete the dashboards holding a tag under the root folder", func(t *testing.T) {
+		system.DefaultFileSystem = afero.NewMemMapFs()
+		defer func() { system.DefaultFileSystem = afero.NewOsFs() }()
+
+		prFolder := &grafana.Folder{UID: "pr-uid", Title: "pr-1234"}
+
+		cloudClient := new(MockCloudClient)
+		testStackClient := new(MockStackClient)
+
+		cloudClient.
+			On("ListStacks").
+			Return(grafana.Stacks{testStack}, nil).
+			Once()
+		// Cleanup shares the client of the stack with Publish.
+		cloudClient.
+			On("NewStackClientWithRole", &testStack, grafana.RoleAdmin).
+			Return(testStackClient, nil).
+			Once()
+
+		testStackClient.
+			On("GetFolder", nilFolder, "pr-1234").
+			Return(prFolder, nil)
+		testStackClient.
+			On("ListFolders", prFolder).
+			Return([]*grafana.Folder{}, nil)
+		testStackClient.
+			On("ListDashboardIDsInFolder", "pr-uid").
+			Return([]string{"dash-1"}, nil).
+			Once()
+		testStackClient.
+			On("ListDashboardIDs", "team").
+			Return([]string{"dash-1", "outside"}, nil).
+			Once()
+		testStackClient.
+			On("DeleteDashboard", "dash-1").
+			Return(nil).
+			Once()
+		testStackClient.
+			On("DeleteFolderIfEmpty", "pr-uid").
+			Return(nil).
+			Once()
+		testStackClient.On("Cleanup").Return(nil)
+
+		pub, err := NewPublisher(
+			WithCloudClient(cloudClient),
+			WithConfig(&PublisherConfig{
+				TestStack:             "test-stack",
+				RootFolder:            "pr-1234",
+				RootFolderPermissions: []*grafana.FolderPermission{{Role: "Viewer", Permission: grafana.PermissionView}},
+				Tags:                  []string{"team"},
+			}),
+		)
+		require.NoError(t, err)
+
+		err = pub.Cleanup(false, CleanupTarget{Tag: "team"})
+		assert.NoError(t, err)
+
+		cloudClient.AssertExpectations(t)
+		testStackClient.AssertExpectations(t)
+		testStackClient.AssertNotCalled(t, "DeleteDashboard", "outside")
+	})
+
+	t.Run("should refuse to clean up by a configured tag without a root folder", func(t *testing.T) {
+		cloudClient := new(MockCloudClient)
+
+		pub, err := NewPublisher(
+			WithCloudClient(cloudClient),
+			WithConfig(&PublisherConfig{TestStack: "test-stack", Tags: []string{"team"}}),
+		)
+		require.NoError(t, err)
+
+		err = pub.Cleanup(false, CleanupTarget{Tag: "team"})
+		assert.Error(t, err)
+
+		cloudClient.AssertExpectations(t)
+	})
+
+	t.Run("should refuse to clean up by suffix without a root folder", func(t *testing.T) {
+		cloudClient := new(MockCloudClient)
+
+		pub, err := NewPublisher(
+			WithCloudClient(cloudClient),
+			WithConfig(&PublisherConfig{TestStack: "test-stack", IDSuffix: "-pr-1234"}),
+		)
+		require.NoError(t, err)
+
+		err = pub.Cleanup(false, CleanupTarget{})
+		assert.Error(t, err)
+
+		cloudClient.AssertExpectations(t)
+	})
+
+	t.Run("should refuse to clean up without a suffix or a tag", func(t *testing.T) {
+		cloudClient := new(MockCloudClient)
+
+		pub, err := NewPublisher(
+			WithCloudClient(cloudClient),
+			WithConfig(&PublisherConfig{TestStack: "test-stack"}),
+		)
+		require.NoError(t, err)
+
+		err = pub.Cleanup(false, CleanupTarget{})
+		assert.Error(t, err)
+
+		cloudClient.AssertExpectations(t)
+	})
+}
@@ -3,6 +3,9 @@ package publisher
 import (
 	"fmt"
 
+	grafana "github.com/adevinta/go-grafana-toolkit/client"
+	system "github.com/adevinta/go-system-toolkit"
+	"github.com/spf13/afero"
 	"gopkg.in/yaml.v3"
 )
 
@@ -11,6 +14,69 @@ type DashboardReferences []DashboardReference
 type DashboardReference struct {
 	LocalFolder   string `yaml:"localFolder"`
 	GrafanaFolder string `yaml:"grafanaFolder"`
+
+	// NestedFolders mirrors the subdirectories of LocalFolder as nested
+	// folders under GrafanaFolder instead of flattening them.
+	NestedFolders bool `yaml:"nestedFolders,omitempty"`
+
+	// Include and Exclude select, with gitignore-like patterns relative to
+	// LocalFolder, the files to publish. When Include is empty all files are
+	// included. Files listed in the .publisherignore file of LocalFolder are
+	// always excluded.
+	Include []string `yaml:"include,omitempty"`
+	Exclude []string `yaml:"exclude,omitempty"`
+
+	// PreviousFolders are the slash separated paths, from the top level and
+	// including the root folder, GrafanaFolder was previously published to.
+	// The dashboards published from LocalFolder, or holding all the Tags, are
+	// moved to GrafanaFolder, and the previous folders deleted once empty.
+	PreviousFolders []string `yaml:"previousFolders,omitempty"`
+
+	// Permissions replace, on every stack, the permissions of GrafanaFolder,
+	// which otherwise inherits the default ones.
+	Permissions []*grafana.FolderPermission `yaml:"permissions,omitempty"`
+
+	// Deleted lists the dashboards to delete from GrafanaFolder, as the
+	// .deleted tombstones of LocalFolder do.
+	Deleted []DeletedDashboard `yaml:"deleted,omitempty"`
+
+	// FS is the filesystem LocalFolder is read from, such as an embed.FS
+	// wrapped with afero.FromIOFS. It defaults to system.DefaultFileSystem.
+	FS afero.Fs `yaml:"-"`
+}
+
+// fileSystem returns the filesystem the local folder of the reference is
+// read from.
+func (r DashboardReference) fileSystem() afero.Fs {
+	if r.FS != nil {
+		return r.FS
+	}
+	return system.DefaultFileSystem
+}
+
+// DeletedDashboard identifies a dashboard to delete by its local UID, or by
+// its title when it has none. Its published UID is derived as when
+// publishing the dashboard.
+type DeletedDashboard struct {
+	UID   string `yaml:"uid,omitempty" json:"uid,omitempty"`
+	Title string `yaml:"title,omitempty" json:"title,omitempty"`
+}
+
+// UnmarshalYAML implements custom unmarshaling for DeletedDashboard to
+// support a plain UID as well as an object with a uid or a title.
+func (d *DeletedDashboard) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		d.UID = value.Value
+		return nil
+	}
+
+	type plain DeletedDashboard
+	var deleted plain
+	if err := value.Decode(&deleted); err != nil {
+		return fmt.Errorf("failed to unmarshal deleted dashboard: %w", err)
+	}
+	*d = DeletedDashboard(deleted)
+	return nil
 }
 
 // UnmarshalYAML implements custom unmarshaling for DashboardReferences
@@ -56,11 +122,77 @@ type PublisherConfig struct {
 
 	CustomDashboards DashboardReferences `yaml:"customDashboards"`
 
+	// Datasources are the datasources ensured on every stack dashboards are
+	// published to, before the dashboards.
+	Datasources []DatasourceConfig `yaml:"datasources,omitempty"`
+
+	// PruneDatasources deletes the datasources previously created by the
+	// publisher which are no longer declared in Datasources.
+	PruneDatasources bool `yaml:"pruneDatasources,omitempty"`
+
+	// LibraryPanels are the library panels published to every stack
+	// dashboards are published to, before the dashboards.
+	LibraryPanels DashboardReferences `yaml:"libraryPanels,omitempty"`
+
+	// AlertRules are the alert rule groups published to every stack
+	// dashboards are published to, after the dashboards.
+	AlertRules DashboardReferences `yaml:"alertRules,omitempty"`
+
+	// Notifications are the contact points, notification templates, mute
+	// timings and notification policy tree published to every stack
+	// dashboards are published to, before the alert rules.
+	Notifications NotificationsConfig `yaml:"notifications,omitempty"`
+
 	CustomStack string   `yaml:"customStack"`
 	TestStack   string   `yaml:"testStack"`
 	Tags        []string `yaml:"tags,omitempty"`
 	RootFolder  string   `yaml:"rootFolder,omitempty"`
 	IDSuffix    string   `yaml:"idSuffix,omitempty"`
+
+	// RootFolderPermissions replace, on every stack, the permissions of the
+	// innermost folder of RootFolder.
+	RootFolderPermissions []*grafana.FolderPermission `yaml:"rootFolderPermissions,omitempty"`
+
+	// DependencyCheck controls whether the datasources and plugins used by
+	// the dashboards are verified on each stack before uploading them.
+	DependencyCheck DependencyCheckMode `yaml:"dependencyCheck,omitempty"`
+
+	// UnknownFiles controls how files which are neither dashboards nor
+	// tombstones are handled.
+	UnknownFiles UnknownFilesMode `yaml:"unknownFiles,omitempty"`
+
+	// DashboardFormat is the format of the dashboard files written by Export
+	// and Normalise. Dashboards are read in any format.
+	DashboardFormat DashboardFormat `yaml:"dashboardFormat,omitempty"`
+
+	// TemplateSuffix enables rendering the dashboard files ending with this
+	// suffix, e.g. ".tmpl" for dashboard.json.tmpl, with Go text/template for
+	// each stack before decoding them.
+	TemplateSuffix string `yaml:"templateSuffix,omitempty"`
+
+	// StackVariables are the variables, by stack slug, dashboard templates
+	// are rendered with. The variables under "*" apply to every stack.
+	StackVariables map[string]map[string]interface{} `yaml:"stackVariables,omitempty"`
+
+	// Inputs resolves the __inputs of dashboards exported for sharing
+	// externally.
+	Inputs InputsConfig `yaml:"inputs,omitempty"`
+}
+
+// requiresAdmin reports whether publishing manages datasources or enforces
+// permissions on any folder, which editors are not allowed to.
+func (c *PublisherConfig) requiresAdmin() bool {
+	if len(c.Datasources) > 0 || c.PruneDatasources || len(c.RootFolderPermissions) > 0 {
+		return true
+	}
+	for _, references := range []DashboardReferences{c.CommonDashboards, c.CustomDashboards, c.LibraryPanels, c.AlertRules} {
+		for _, reference := range references {
+			if len(reference.Permissions) > 0 {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 func (c *PublisherConfig) initExclusionsMap() {
@@ -3,6 +3,7 @@ package publisher
 import (
 	"testing"
 
+	grafana "github.com/adevinta/go-grafana-toolkit/client"
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/yaml.v3"
 )
@@ -45,4 +46,46 @@ commonDashboards:
 			},
 		}, config.CommonDashboards)
 	})
+
+	t.Run("when folder permissions are provided", func(t *testing.T) {
+		var config PublisherConfig
+		err := yaml.Unmarshal([]byte(`
+rootFolder: root
+rootFolderPermissions:
+- role: Viewer
+  permission: View
+commonDashboards:
+  localFolder: /local_folder_1
+  grafanaFolder: Common
+  permissions:
+  - team: SRE
+    permission: Edit
+  - serviceAccount: publisher
+    permission: Admin
+`), &config)
+		assert.NoError(t, err)
+		assert.Equal(t, []*grafana.FolderPermission{{Role: "Viewer", Permission: grafana.PermissionView}}, config.RootFolderPermissions)
+		assert.Equal(t, []*grafana.FolderPermission{
+			{Team: "SRE", Permission: grafana.PermissionEdit},
+			{ServiceAccount: "publisher", Permission: grafana.PermissionAdmin},
+		}, config.CommonDashboards[0].Permissions)
+	})
+	t.Run("when deleted dashboards are provided", func(t *testing.T) {
+		var config PublisherConfig
+		err := yaml.Unmarshal([]byte(`
+commonDashboards:
+  localFolder: /local_folder_1
+  grafanaFolder: Common
+  deleted:
+  - dash-1
+  - uid: dash-2
+  - title: Old Dashboard
+`), &config)
+		assert.NoError(t, err)
+		assert.Equal(t, []DeletedDashboard{
+			{UID: "dash-1"},
+			{UID: "dash-2"},
+			{Title: "Old Dashboard"},
+		}, config.CommonDashboards[0].Deleted)
+	})
 }
@@ -0,0 +1,277 @@
+package publisher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"text/template"
+
+	grafana "github.com/adevinta/go-grafana-toolkit/client"
+	log "github.com/adevinta/go-log-toolkit"
+	"github.com/grafana/grafana-openapi-client-go/models"
+)
+
+// managedDatasourceKey is the jsonData field marking the datasources created
+// by the publisher, which are the only ones PruneDatasources deletes.
+const managedDatasourceKey = "managedByPublisher"
+
+// DatasourceConfig declares a datasource ensured on every selected stack.
+type DatasourceConfig struct {
+	// UID identifies the datasource. Datasources without UID are matched by
+	// name.
+	UID  string `yaml:"uid,omitempty"`
+	Name string `yaml:"name"`
+	// Type is the plugin ID of the datasource, e.g. prometheus or loki.
+	Type string `yaml:"type"`
+	// Access defaults to proxy.
+	Access    string `yaml:"access,omitempty"`
+	IsDefault bool   `yaml:"isDefault,omitempty"`
+
+	// URL and BasicAuthUser are rendered with Go text/template for each
+	// stack, e.g. {{ .PromURL }} or {{ .MetricsInstanceID }}.
+	URL           string `yaml:"url,omitempty"`
+	BasicAuth     bool   `yaml:"basicAuth,omitempty"`
+	BasicAuthUser string `yaml:"basicAuthUser,omitempty"`
+
+	JSONData map[string]interface{} `yaml:"jsonData,omitempty"`
+
+	// SecureJSONData are the secret fields of the datasource, such as
+	// basicAuthPassword. $__env{NAME} references are replaced by the value
+	// of the NAME environment variable.
+	SecureJSONData map[string]string `yaml:"secureJsonData,omitempty"`
+}
+
+// desiredDatasource returns the datasource declared by a configuration for a
+// stack, and its secure fields.
+func (p Publisher) desiredDatasource(config DatasourceConfig, stack *grafana.Stack) (*grafana.Datasource, map[string]string, error) {
+	if config.Name == "" || config.Type == "" {
+		return nil, nil, fmt.Errorf("datasources require a name and a type")
+	}
+
+	url, err := p.renderDatasourceField(config.Name, "url", config.URL, stack)
+	if err != nil {
+		return nil, nil, err
+	}
+	basicAuthUser, err := p.renderDatasourceField(config.Name, "basic auth user", config.BasicAuthUser, stack)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Round trip the json data to compare it with the one of the stack. Only
+	// the configured fields are compared, as Grafana fills in defaults.
+	jsonData := map[string]interface{}{}
+	data, err := json.Marshal(config.JSONData)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid json data for datasource %s: %w", config.Name, err)
+	}
+	err = json.Unmarshal(data, &jsonData)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid json data for datasource %s: %w", config.Name, err)
+	}
+	if jsonData == nil {
+		jsonData = map[string]interface{}{}
+	}
+
+	secureJSONData := map[string]string{}
+	for field, value := range config.SecureJSONData {
+		expanded, err := expandEnv(value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w in secure field %s of datasource %s", err, field, config.Name)
+		}
+		expandedValue, ok := expanded.(string)
+		if !ok {
+			return nil, nil, fmt.Errorf("unexpected value of secure field %s of datasource %s", field, config.Name)
+		}
+		secureJSONData[field] = expandedValue
+	}
+
+	access := models.DsAccess(config.Access)
+	if access == "" {
+		access = "proxy"
+	}
+
+	return &grafana.Datasource{
+		UID:           config.UID,
+		Name:          config.Name,
+		Type:          config.Type,
+		Access:        access,
+		IsDefault:     config.IsDefault,
+		URL:           url,
+		BasicAuth:     config.BasicAuth,
+		BasicAuthUser: basicAuthUser,
+		JSONData:      jsonData,
+	}, secureJSONData, nil
+}
+
+// renderDatasourceField renders a templated setting of a datasource for a
+// stack, with the data of dashboard templates.
+func (p Publisher) renderDatasourceField(name, field, value string, stack *grafana.Stack) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(templateFuncs).Parse(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %s of datasource %s: %w", field, name, err)
+	}
+
+	buf := &bytes.Buffer{}
+	err = tmpl.Execute(buf, p.templateData(stack))
+	if err != nil {
+		return "", fmt.Errorf("failed to render %s of datasource %s for stack %s: %w", field, name, stack.Slug, err)
+	}
+	return buf.String(), nil
+}
+
+// datasourceDrifted reports whether the settings of a stack datasource differ
+// from the declared ones. Only the declared json data fields are compared.
+func datasourceDrifted(existing, desired *grafana.Datasource) bool {
+	if existing.Name != desired.Name ||
+		existing.Type != desired.Type ||
+		existing.Access != desired.Access ||
+		existing.IsDefault != desired.IsDefault ||
+		existing.URL != desired.URL ||
+		existing.BasicAuth != desired.BasicAuth ||
+		existing.BasicAuthUser != desired.BasicAuthUser {
+		return true
+	}
+
+	existingJSONData, _ := existing.JSONData.(map[string]interface{})
+	desiredJSONData, _ := desired.JSONData.(map[string]interface{})
+	for field, value := range desiredJSONData {
+		if !reflect.DeepEqual(existingJSONData[field], value) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeJSONData returns the json data of a datasource with the declared
+// fields applied.
+func mergeJSONData(jsonData interface{}, declared interface{}) map[string]interface{} {
+	merged := map[string]interface{}{}
+	if existing, ok := jsonData.(map[string]interface{}); ok {
+		for field, value := range existing {
+			merged[field] = value
+		}
+	}
+	if declared, ok := declared.(map[string]interface{}); ok {
+		for field, value := range declared {
+			merged[field] = value
+		}
+	}
+	return merged
+}
+
+// isManagedDatasource reports whether a datasource was created by the publisher.
+func isManagedDatasource(datasource *grafana.Datasource) bool {
+	jsonData, ok := datasource.JSONData.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	managed, _ := jsonData[managedDatasourceKey].(bool)
+	return managed
+}
+
+// syncDatasources ensures the declared datasources on the given stacks.
+func (p Publisher) syncDatasources(grafanaStacks grafana.Stacks) error {
+	log.DefaultLogger.Println("Syncing datasources...")
+
+	for _, stack := range grafanaStacks {
+		err := p.syncDatasourcesForStack(&stack)
+		if err != nil {
+			return fmt.Errorf("failed to sync datasources for stack %s: %w", stack.Slug, err)
+		}
+	}
+	return nil
+}
+
+// syncDatasourcesForStack creates the missing declared datasources of a
+// stack and corrects the ones whose settings drifted. When PruneDatasources
+// is set, the datasources created by the publisher which are no longer
+// declared are deleted.
+func (p Publisher) syncDatasourcesForStack(stack *grafana.Stack) error {
+	sc, err := p.stackClient(stack)
+	if err != nil {
+		return fmt.Errorf("failed to get grafana stack client for stack %v, error: %w", stack.Slug, err)
+	}
+
+	existing, err := sc.ListDataSources("")
+	if err != nil {
+		return err
+	}
+
+	declared := map[string]struct{}{}
+	for _, config := range p.config.Datasources {
+		desired, secureJSONData, err := p.desiredDatasource(config, stack)
+		if err != nil {
+			return err
+		}
+
+		var current *grafana.Datasource
+		for _, candidate := range existing {
+			if (desired.UID != "" && candidate.UID == desired.UID) || (desired.UID == "" && candidate.Name == desired.Name) {
+				current = candidate
+				break
+			}
+		}
+
+		logger := log.DefaultLogger.WithField("datasource", desired.Name).WithField("destination", stack.Slug)
+
+		if current == nil {
+			logger.Println("Creating datasource")
+			// Only the datasources created by the publisher can be pruned.
+			desired.JSONData = mergeJSONData(desired.JSONData, map[string]interface{}{managedDatasourceKey: true})
+			created, err := sc.CreateDataSource(desired, secureJSONData)
+			if err != nil {
+				return err
+			}
+			declared[created.UID] = struct{}{}
+			continue
+		}
+		declared[current.UID] = struct{}{}
+
+		// The list does not hold every setting of the datasources.
+		current, err = sc.GetDataSourceByUID(current.UID)
+		if err != nil {
+			return err
+		}
+		if current == nil {
+			return fmt.Errorf("datasource %s disappeared while syncing", desired.Name)
+		}
+
+		// Secure fields cannot be read back, so datasources declaring them
+		// are always updated.
+		if !datasourceDrifted(current, desired) && len(secureJSONData) == 0 {
+			continue
+		}
+
+		logger.Println("Updating datasource")
+		desired.UID = current.UID
+		desired.Version = current.Version
+		// The fields which are not declared, including the managed marker of
+		// the datasources created by the publisher, are kept as is.
+		desired.JSONData = mergeJSONData(current.JSONData, desired.JSONData)
+		_, err = sc.UpdateDataSource(desired, secureJSONData)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !p.config.PruneDatasources {
+		return nil
+	}
+
+	for _, datasource := range existing {
+		if _, ok := declared[datasource.UID]; ok {
+			continue
+		}
+		if !isManagedDatasource(datasource) {
+			continue
+		}
+		log.DefaultLogger.WithField("datasource", datasource.Name).WithField("destination", stack.Slug).Println("Deleting datasource")
+		err = sc.DeleteDataSource(datasource.UID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
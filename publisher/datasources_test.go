@@ -0,0 +1,188 @@
+package publisher
+
+import (
+	"os"
+	"testing"
+
+	grafana "github.com/adevinta/go-grafana-toolkit/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublishDatasources(t *testing.T) {
+	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+	os.Setenv("LOKI_TOKEN", "secret")
+	defer os.Unsetenv("LOKI_TOKEN")
+
+	cloudClient := new(MockCloudClient)
+	testStackClient := new(MockStackClient)
+
+	cloudClient.
+		On("ListStacks").
+		Return(grafana.Stacks{testStack}, nil).
+		Once()
+	cloudClient.
+		On("NewStackClientWithRole", &testStack, grafana.RoleAdmin).
+		Return(testStackClient, nil)
+
+	drifted := &grafana.Datasource{
+		UID:       "prom",
+		Name:      "Prometheus",
+		Type:      "prometheus",
+		Access:    "proxy",
+		URL:       "https://old.example.com",
+		JSONData:  map[string]interface{}{managedDatasourceKey: true, "timeout": float64(30)},
+		Version:   3,
+		IsDefault: true,
+	}
+	testStackClient.
+		On("ListDataSources", "").
+		Return([]*grafana.Datasource{
+			drifted,
+			{UID: "stale", Name: "Stale", Type: "loki", JSONData: map[string]interface{}{managedDatasourceKey: true}},
+			{UID: "manual", Name: "Manual", Type: "loki", JSONData: map[string]interface{}{}},
+		}, nil).
+		Once()
+	testStackClient.
+		On("GetDataSourceByUID", "manual").
+		Return(&grafana.Datasource{
+			UID:      "manual",
+			Name:     "Manual",
+			Type:     "loki",
+			Access:   "proxy",
+			URL:      "https://old-manual.example.com",
+			JSONData: map[string]interface{}{"maxLines": float64(500)},
+			Version:  7,
+		}, nil).
+		Once()
+	testStackClient.
+		On("UpdateDataSource", &grafana.Datasource{
+			UID:      "manual",
+			Name:     "Manual",
+			Type:     "loki",
+			Access:   "proxy",
+			URL:      "https://manual.example.com",
+			JSONData: map[string]interface{}{"maxLines": float64(500)},
+			Version:  7,
+		}, map[string]string{}).
+		Return(&grafana.Datasource{UID: "manual"}, nil).
+		Once()
+	testStackClient.
+		On("GetDataSourceByUID", "prom").
+		Return(drifted, nil).
+		Once()
+	testStackClient.
+		On("UpdateDataSource", &grafana.Datasource{
+			UID:       "prom",
+			Name:      "Prometheus",
+			Type:      "prometheus",
+			Access:    "proxy",
+			IsDefault: true,
+			URL:       "https://test-stack.grafana.net/prometheus",
+			JSONData:  map[string]interface{}{"httpMethod": "POST", managedDatasourceKey: true, "timeout": float64(30)},
+			Version:   3,
+		}, map[string]string{}).
+		Return(&grafana.Datasource{UID: "prom"}, nil).
+		Once()
+	testStackClient.
+		On("CreateDataSource", &grafana.Datasource{
+			Name:          "Logs",
+			Type:          "loki",
+			Access:        "proxy",
+			URL:           "https://logs.example.com",
+			BasicAuth:     true,
+			BasicAuthUser: "1",
+			JSONData:      map[string]interface{}{"maxLines": float64(1000), managedDatasourceKey: true},
+		}, map[string]string{"basicAuthPassword": "secret"}).
+		Return(&grafana.Datasource{UID: "logs", Name: "Logs"}, nil).
+		Once()
+	testStackClient.
+		On("DeleteDataSource", "stale").
+		Return(nil).
+		Once()
+	testStackClient.On("Cleanup").Return(nil)
+
+	pub, err := NewPublisher(
+		WithCloudClient(cloudClient),
+		WithConfig(&PublisherConfig{
+			Datasources: []DatasourceConfig{
+				{
+					UID:       "prom",
+					Name:      "Prometheus",
+					Type:      "prometheus",
+					IsDefault: true,
+					URL:       "{{ .StackURL }}/prometheus",
+					JSONData:  map[string]interface{}{"httpMethod": "POST"},
+				},
+				{
+					Name:           "Logs",
+					Type:           "loki",
+					URL:            "https://logs.example.com",
+					BasicAuth:      true,
+					BasicAuthUser:  "{{ .StackID }}",
+					JSONData:       map[string]interface{}{"maxLines": 1000},
+					SecureJSONData: map[string]string{"basicAuthPassword": "$__env{LOKI_TOKEN}"},
+				},
+				{
+					Name: "Manual",
+					Type: "loki",
+					URL:  "https://manual.example.com",
+				},
+			},
+			PruneDatasources: true,
+			TestStack:        "test-stack",
+		}),
+	)
+	require.NoError(t, err)
+
+	err = pub.Publish(false)
+	assert.NoError(t, err)
+
+	cloudClient.AssertExpectations(t)
+	testStackClient.AssertExpectations(t)
+}
+
+func TestDatasourceDrift(t *testing.T) {
+	pub := Publisher{config: &PublisherConfig{}}
+
+	desired, secureJSONData, err := pub.desiredDatasource(DatasourceConfig{
+		UID:  "prom",
+		Name: "Prometheus",
+		Type: "prometheus",
+		URL:  "{{ .StackURL }}/prometheus",
+	}, &testStack)
+	require.NoError(t, err)
+	assert.Empty(t, secureJSONData)
+
+	existing := &grafana.Datasource{
+		UID:      "prom",
+		Name:     "Prometheus",
+		Type:     "prometheus",
+		Access:   "proxy",
+		URL:      "https://test-stack.grafana.net/prometheus",
+		JSONData: map[string]interface{}{managedDatasourceKey: true},
+	}
+	assert.False(t, datasourceDrifted(existing, desired))
+
+	existing.JSONData = map[string]interface{}{managedDatasourceKey: true, "httpMethod": "GET"}
+	assert.False(t, datasourceDrifted(existing, desired), "undeclared json data fields must not be compared")
+
+	desired.JSONData = map[string]interface{}{"httpMethod": "POST"}
+	assert.True(t, datasourceDrifted(existing, desired))
+
+	_, _, err = pub.desiredDatasource(DatasourceConfig{Name: "Missing type"}, &testStack)
+	assert.Error(t, err)
+}
+
+func TestDesiredDatasourceTemplateErrors(t *testing.T) {
+	pub := Publisher{config: &PublisherConfig{}}
+
+	_, _, err := pub.desiredDatasource(DatasourceConfig{Name: "Prometheus", Type: "prometheus", URL: "{{ .Missing }}"}, &testStack)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to render url of datasource Prometheus for stack test-stack")
+
+	_, _, err = pub.desiredDatasource(DatasourceConfig{Name: "Prometheus", Type: "prometheus", BasicAuthUser: "{{ .StackID"}, &testStack)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to parse basic auth user of datasource Prometheus")
+}
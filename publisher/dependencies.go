@@ -0,0 +1,216 @@
+package publisher
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	grafana "github.com/adevinta/go-grafana-toolkit/client"
+	log "github.com/adevinta/go-log-toolkit"
+	"github.com/go-openapi/runtime"
+)
+
+// DependencyCheckMode defines how dashboards depending on datasources or
+// plugins missing from a stack are handled.
+type DependencyCheckMode string
+
+const (
+	// DependencyCheckIgnore skips the verification. This is the default.
+	DependencyCheckIgnore DependencyCheckMode = "ignore"
+	// DependencyCheckWarn logs the missing dependencies and uploads the dashboards anyway.
+	DependencyCheckWarn DependencyCheckMode = "warn"
+	// DependencyCheckFail aborts the synchronization of the stack.
+	DependencyCheckFail DependencyCheckMode = "fail"
+)
+
+// MissingDependenciesError is returned when dashboards depend on datasources
+// or plugins which are not available in a stack.
+type MissingDependenciesError struct {
+	Stack   string
+	Missing []string
+}
+
+func (e *MissingDependenciesError) Error() string {
+	return fmt.Sprintf("missing dependencies in stack %s: %s", e.Stack, strings.Join(e.Missing, ", "))
+}
+
+// checkDependencies verifies that the datasources referenced by name or UID and the
+// panel and datasource plugins listed in __requires by the dashboards are
+// available in the stack.
+func (p Publisher) checkDependencies(sc grafana.GrafanaStackClient, stack *grafana.Stack, dashboards []*grafana.Dashboard) error {
+	mode := p.config.DependencyCheck
+	if mode == "" || mode == DependencyCheckIgnore || len(dashboards) == 0 {
+		return nil
+	}
+
+	plugins, err := sc.ListPlugins()
+	if err != nil {
+		return err
+	}
+
+	installed := map[string]struct{}{}
+	for _, plugin := range plugins {
+		installed[plugin.ID] = struct{}{}
+	}
+
+	checked := map[string]bool{}
+	checkedUIDs := map[string]bool{}
+	missing := []string{}
+
+	for _, dashboard := range dashboards {
+		dash, ok := dashboard.Dashboard.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		names, uids := referencedDatasources(dash)
+		for _, name := range names {
+			found, ok := checked[name]
+			if !ok {
+				found, err = datasourceExists(sc, name)
+				if err != nil {
+					return err
+				}
+				checked[name] = found
+			}
+			if !found {
+				missing = append(missing, fmt.Sprintf("datasource %s used by dashboard %s", name, dashboard.UID))
+			}
+		}
+
+		for _, uid := range uids {
+			found, ok := checkedUIDs[uid]
+			if !ok {
+				datasource, err := sc.GetDataSourceByUID(uid)
+				if err != nil {
+					return err
+				}
+				found = datasource != nil
+				checkedUIDs[uid] = found
+			}
+			if !found {
+				missing = append(missing, fmt.Sprintf("datasource with uid %s used by dashboard %s", uid, dashboard.UID))
+			}
+		}
+
+		requires, _ := dash["__requires"].([]interface{})
+		for _, item := range requires {
+			require, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if require["type"] != "panel" && require["type"] != "datasource" {
+				continue
+			}
+			id, ok := require["id"].(string)
+			if !ok {
+				continue
+			}
+			if _, ok := installed[id]; !ok {
+				missing = append(missing, fmt.Sprintf("%s plugin %s required by dashboard %s", require["type"], id, dashboard.UID))
+			}
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	if mode == DependencyCheckWarn {
+		for _, dependency := range missing {
+			log.DefaultLogger.WithField("stack", stack.Slug).Warnf("missing %s", dependency)
+		}
+		return nil
+	}
+
+	return &MissingDependenciesError{Stack: stack.Slug, Missing: missing}
+}
+
+// datasourceExists reports whether a datasource with the given name exists in
+// a stack. Errors other than a missing datasource are returned.
+func datasourceExists(sc grafana.GrafanaStackClient, name string) (bool, error) {
+	_, err := sc.GetDataSource(name)
+	// The API does not declare a typed response for missing datasources.
+	var apiErr *runtime.APIError
+	if errors.As(err, &apiErr) && apiErr.IsCode(http.StatusNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// referencedDatasources returns the names of the datasources selected in
+// the datasource variables and referenced by name in the panels, and the
+// UIDs of the datasources referenced by UID.
+func referencedDatasources(dash map[string]interface{}) ([]string, []string) {
+	names := map[string]struct{}{}
+	uids := map[string]struct{}{}
+
+	if templating, ok := dash["templating"].(map[string]interface{}); ok {
+		parameters, _ := templating["list"].([]interface{})
+		for _, param := range parameters {
+			parameter, ok := param.(map[string]interface{})
+			if !ok || parameter["type"] != "datasource" {
+				continue
+			}
+			// The value is the datasource name, the text may be a display
+			// name, as for LOGUSAGE.
+			current, _ := parameter["current"].(map[string]interface{})
+			switch value := current["value"].(type) {
+			case string:
+				addDatasourceName(names, value)
+			case []interface{}:
+				for _, item := range value {
+					if name, ok := item.(string); ok {
+						addDatasourceName(names, name)
+					}
+				}
+			}
+		}
+	}
+
+	for _, key := range []string{"panels", "rows", "annotations", "templating"} {
+		collectDatasourceReferences(dash[key], names, uids)
+	}
+
+	return sortedKeys(names), sortedKeys(uids)
+}
+
+// collectDatasourceReferences walks a dashboard section and collects the
+// datasources referenced by name and by UID.
+func collectDatasourceReferences(value interface{}, names, uids map[string]struct{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if key != "datasource" {
+				collectDatasourceReferences(item, names, uids)
+				continue
+			}
+			switch datasource := item.(type) {
+			case string:
+				addDatasourceName(names, datasource)
+			case map[string]interface{}:
+				if uid, ok := datasource["uid"].(string); ok {
+					addDatasourceName(uids, uid)
+				}
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			collectDatasourceReferences(item, names, uids)
+		}
+	}
+}
+
+func addDatasourceName(names map[string]struct{}, name string) {
+	if name == "" || name == "default" || strings.HasPrefix(name, "$") {
+		return
+	}
+	if _, ok := builtinDatasources[name]; ok {
+		return
+	}
+	names[name] = struct{}{}
+}
@@ -0,0 +1,147 @@
+package publisher
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+
+	grafana "github.com/adevinta/go-grafana-toolkit/client"
+	system "github.com/adevinta/go-system-toolkit"
+	testutils "github.com/adevinta/go-testutils-toolkit"
+	"github.com/go-openapi/runtime"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublishChecksDependencies(t *testing.T) {
+	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+
+	system.DefaultFileSystem = afero.NewMemMapFs()
+	defer func() { system.DefaultFileSystem = afero.NewOsFs() }()
+
+	require.NoError(t, system.DefaultFileSystem.MkdirAll("/local_folder_1", 0777))
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/dashboard1.json", `{
+		"dashboard": {
+			"uid": "dash-1",
+			"title": "Dashboard 1",
+			"__requires": [
+				{"type": "grafana", "id": "grafana", "version": "11.0.0"},
+				{"type": "panel", "id": "timeseries"},
+				{"type": "panel", "id": "marcusolsson-treemap-panel"},
+				{"type": "datasource", "id": "prometheus"}
+			],
+			"templating": {"list": [
+				{"type": "datasource", "name": "PROMPRO"},
+				{"type": "datasource", "name": "LOGUSAGE"}
+			]},
+			"panels": [
+				{"datasource": "legacy-datasource"},
+				{"datasource": "$PROMPRO"},
+				{"datasource": {"type": "prometheus", "uid": "prom-uid"}},
+				{"datasource": {"type": "loki", "uid": "missing-uid"}},
+				{"targets": [{"datasource": {"type": "__expr__", "uid": "__expr__"}}]}
+			]
+		}
+	}`)
+
+	setup := func(mode DependencyCheckMode) (*Publisher, *MockCloudClient, *MockStackClient) {
+		cloudClient := new(MockCloudClient)
+		testStackClient := new(MockStackClient)
+
+		cloudClient.
+			On("ListStacks").
+			Return(grafana.Stacks{testStack}, nil).
+			Once()
+		cloudClient.
+			On("NewStackClient", &testStack).
+			Return(testStackClient, nil)
+
+		testStackClient.
+			On("ListPlugins").
+			Return([]grafana.Plugin{
+				{ID: "timeseries", Type: "panel"},
+				{ID: "prometheus", Type: "datasource"},
+			}, nil).
+			Once()
+		testStackClient.
+			On("GetDataSource", "grafanacloud-test-stack-prom").
+			Return(&grafana.Datasource{Name: "grafanacloud-test-stack-prom"}, nil).
+			Once()
+		testStackClient.
+			On("GetDataSource", "grafanacloud-usage-insights").
+			Return(&grafana.Datasource{Name: "grafanacloud-usage-insights"}, nil).
+			Once()
+		testStackClient.
+			On("GetDataSource", "legacy-datasource").
+			Return((*grafana.Datasource)(nil), fmt.Errorf("failed to get datasource for legacy-datasource: %w", runtime.NewAPIError("getDataSourceByName", nil, http.StatusNotFound))).
+			Once()
+		testStackClient.
+			On("GetDataSourceByUID", "prom-uid").
+			Return(&grafana.Datasource{UID: "prom-uid"}, nil).
+			Once()
+		testStackClient.
+			On("GetDataSourceByUID", "missing-uid").
+			Return((*grafana.Datasource)(nil), nil).
+			Once()
+		testStackClient.On("Cleanup").Return(nil)
+
+		pub, err := NewPublisher(
+			WithCloudClient(cloudClient),
+			WithConfig(&PublisherConfig{
+				CommonDashboards: DashboardReferences{{LocalFolder: "/local_folder_1", GrafanaFolder: "Common"}},
+				TestStack:        "test-stack",
+				DependencyCheck:  mode,
+			}),
+		)
+		require.NoError(t, err)
+
+		return pub, cloudClient, testStackClient
+	}
+
+	t.Run("fails without uploading when dependencies are missing", func(t *testing.T) {
+		pub, cloudClient, testStackClient := setup(DependencyCheckFail)
+
+		err := pub.Publish(true)
+		require.Error(t, err)
+
+		var missing *MissingDependenciesError
+		require.True(t, errors.As(err, &missing))
+		assert.Equal(t, &MissingDependenciesError{
+			Stack: "test-stack",
+			Missing: []string{
+				"datasource legacy-datasource used by dashboard dash-1",
+				"datasource with uid missing-uid used by dashboard dash-1",
+				"panel plugin marcusolsson-treemap-panel required by dashboard dash-1",
+			},
+		}, missing)
+
+		cloudClient.AssertExpectations(t)
+		testStackClient.AssertExpectations(t)
+		// Nothing is written to the stack.
+		testStackClient.AssertNotCalled(t, "EnsureFolder", mock.Anything, mock.Anything)
+		testStackClient.AssertNotCalled(t, "UploadDashboard", mock.Anything)
+	})
+
+	t.Run("uploads dashboards when only warning", func(t *testing.T) {
+		pub, cloudClient, testStackClient := setup(DependencyCheckWarn)
+
+		testStackClient.
+			On("EnsureFolder", nilFolder, "Common").
+			Return(commonFolder, nil)
+		testStackClient.
+			On("UploadDashboard", mock.AnythingOfType("*client.Dashboard")).
+			Return(nil).
+			Once()
+
+		err := pub.Publish(true)
+		assert.NoError(t, err)
+
+		cloudClient.AssertExpectations(t)
+		testStackClient.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,462 @@
+package publisher
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	grafana "github.com/adevinta/go-grafana-toolkit/client"
+	log "github.com/adevinta/go-log-toolkit"
+	"github.com/spf13/afero"
+)
+
+// localDashboard identifies a dashboard file present in a local folder.
+type localDashboard struct {
+	path string
+	// uid is the UID as written in the file, empty when derived from the title.
+	uid string
+	// tags are the tags declared in the file.
+	tags    []string
+	deleted bool
+	// generated is set for dashboards rendered from a template or patched by
+	// an overlay for the stack, which cannot be exported back.
+	generated bool
+}
+
+// Export downloads the dashboards published in the configured Grafana folders
+// of the given stack and writes them back to their local folders.
+// The transformations applied by Publish are reverted, so that publishing and
+// exporting a dashboard again produces the same file.
+// Custom dashboards are only exported from the custom and test stacks.
+// References read from an io/fs filesystem, such as the ones given with
+// WithLocalFolderFS, are read-only and cannot be exported to.
+func (p Publisher) Export(stackSlug string) error {
+	p.mode = PublishModeExport
+
+	if p.gcc == nil {
+		cloudClient, err := grafana.NewCloudClient()
+		if err != nil {
+			return fmt.Errorf("failed to create Grafana Cloud client: %w", err)
+		}
+		p.gcc = cloudClient
+	}
+
+	stack, err := p.gcc.GetStack(stackSlug)
+	if err != nil {
+		return fmt.Errorf("failed to get stack %s: %w", stackSlug, err)
+	}
+
+	sc, err := p.gcc.NewStackClient(stack)
+	if err != nil {
+		return fmt.Errorf("failed to get grafana stack client for stack %v, error: %w", stack.Slug, err)
+	}
+
+	defer sc.Cleanup()
+
+	// Exporting must not modify the stack: missing folders have nothing to export.
+	var parentFolder *grafana.Folder
+	if p.config.RootFolder != "" {
+		rootFolders, err := lookupFolderPath(sc, p.config.RootFolder)
+		if err != nil {
+			return fmt.Errorf("could not look up root folder %s: %w", p.config.RootFolder, err)
+		}
+		if len(rootFolders) == 0 {
+			log.DefaultLogger.WithField("stack", stack.Slug).WithField("rootFolder", p.config.RootFolder).Println("Root folder not found, nothing to export")
+			return nil
+		}
+		parentFolder = rootFolders[len(rootFolders)-1]
+	}
+
+	p.localLibraryPanels, err = p.indexLocalLibraryPanels(stack)
+	if err != nil {
+		return err
+	}
+
+	references := DashboardReferences{}
+	if stackSlug == p.config.CustomStack || stackSlug == p.config.TestStack {
+		references = append(references, p.config.CustomDashboards...)
+	}
+	references = append(references, p.config.CommonDashboards...)
+
+	for _, reference := range references {
+		if reference.LocalFolder == "" || reference.GrafanaFolder == "" {
+			continue
+		}
+		err := p.exportDashboards(sc, stack, parentFolder, reference)
+		if err != nil {
+			return fmt.Errorf("export failed (%s -> %s): %w", reference.GrafanaFolder, reference.LocalFolder, err)
+		}
+	}
+
+	return nil
+}
+
+// exportDashboards writes the dashboards of a Grafana folder to the local
+// folder of the reference. Dashboards already present locally are written to
+// their existing file, new ones are named after their UID, in the
+// subdirectory of their folder with NestedFolders.
+// Dashboards with a local tombstone are skipped.
+func (p Publisher) exportDashboards(sc grafana.GrafanaStackClient, stack *grafana.Stack, parentFolder *grafana.Folder, reference DashboardReference) error {
+	log.DefaultLogger.WithField("stack", stack.Slug).WithField("localFolder", reference.LocalFolder).WithField("grafanaFolder", reference.GrafanaFolder).Println("Exporting dashboards...")
+
+	folder, err := sc.GetFolder(parentFolder, reference.GrafanaFolder)
+	if err != nil {
+		return fmt.Errorf("could not get folder %s: %w", reference.GrafanaFolder, err)
+	}
+	if folder == nil {
+		log.DefaultLogger.WithField("stack", stack.Slug).WithField("grafanaFolder", reference.GrafanaFolder).Println("Folder not found, skipping")
+		return nil
+	}
+
+	localDashboards, err := p.indexLocalDashboards(stack, reference)
+	if err != nil {
+		return err
+	}
+
+	return p.exportFolderDashboards(sc, stack, folder, reference, localDashboards, ".")
+}
+
+// exportFolderDashboards writes the dashboards of a Grafana folder to the
+// directory dir, relative to the local folder of a reference. With
+// NestedFolders, the subfolders created by the publisher are exported to the
+// subdirectories they mirror.
+func (p Publisher) exportFolderDashboards(sc grafana.GrafanaStackClient, stack *grafana.Stack, folder *grafana.Folder, reference DashboardReference, localDashboards map[string]localDashboard, dir string) error {
+	uids, err := sc.ListDashboardIDsInFolder(folder.UID)
+	if err != nil {
+		return err
+	}
+
+	for _, uid := range uids {
+		local, ok := localDashboards[uid]
+		if ok && local.deleted {
+			log.DefaultLogger.WithField("dashboard", local.path).WithField("source", stack.Slug).Println("Skipping deleted dashboard")
+			continue
+		}
+		if ok && local.generated {
+			log.DefaultLogger.WithField("dashboard", local.path).WithField("source", stack.Slug).Println("Skipping generated dashboard")
+			continue
+		}
+
+		dashboard, err := sc.GetDashboard(uid)
+		if err != nil {
+			return err
+		}
+
+		model, err := grafana.DecodeDashboardModel(dashboard.Dashboard)
+		if err != nil {
+			return fmt.Errorf("unexpected content for dashboard %s: %w", uid, err)
+		}
+
+		publishedTags := model.Tags
+		p.RevertDashboard(stack, model)
+
+		path := local.path
+		if ok {
+			model.UID = local.uid
+			if local.uid == "" {
+				model.Delete("uid")
+			}
+			model.Tags = keepDeclaredTags(model.Tags, publishedTags, local.tags)
+		} else {
+			name := uid
+			if model.UID != "" {
+				name = model.UID
+			}
+			path = filepath.Join(reference.LocalFolder, dir, name+p.config.DashboardFormat.extension())
+		}
+
+		dash, err := model.JSON()
+		if err != nil {
+			return fmt.Errorf("failed to encode dashboard %s: %w", uid, err)
+		}
+
+		log.DefaultLogger.WithField("dashboard", path).WithField("source", stack.Slug).Println("Exporting dashboard")
+
+		err = writeDashboardFile(reference.fileSystem(), path, dash)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !reference.NestedFolders {
+		return nil
+	}
+
+	children, err := sc.ListFolders(folder)
+	if err != nil {
+		return err
+	}
+
+	for _, child := range children {
+		if child.UID != subfolderUID(folder, child.Title) {
+			continue
+		}
+
+		err = p.exportFolderDashboards(sc, stack, child, reference, localDashboards, filepath.Join(dir, child.Title))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// indexLocalDashboards lists the dashboards of a local folder by the UID
+// they are published with on the stack.
+func (p Publisher) indexLocalDashboards(stack *grafana.Stack, reference DashboardReference) (map[string]localDashboard, error) {
+	localDashboards := map[string]localDashboard{}
+
+	_, err := reference.fileSystem().Stat(reference.LocalFolder)
+	if os.IsNotExist(err) {
+		return localDashboards, nil
+	}
+
+	for _, deleted := range reference.Deleted {
+		uid, err := p.deletedDashboardUID(deleted)
+		if err != nil {
+			return nil, err
+		}
+		localDashboards[uid] = localDashboard{path: resolveConfigFilePath(p.configPath), uid: deleted.UID, deleted: true}
+	}
+
+	err = walkDashboardFiles(reference, func(path string, info os.FileInfo) error {
+		ext := filepath.Ext(path)
+		if !isDashboardFile(p.renderedPath(path)) && ext != ".deleted" {
+			return nil
+		}
+
+		data, err := p.readStackDashboardSource(reference.fileSystem(), path, stack)
+		if err != nil {
+			return err
+		}
+
+		var dash map[string]interface{}
+		if ext == ".deleted" {
+			dash, err = decodeTombstoneFile(path, data)
+		} else {
+			dash, err = decodeDashboardFile(path, data)
+		}
+		if err != nil {
+			return err
+		}
+
+		uid, _ := dash["uid"].(string)
+		publishedUID, err := p.dashboardUID(dash)
+		if err != nil {
+			return fmt.Errorf("%w in %s", err, path)
+		}
+
+		if ext == ".deleted" {
+			localDashboards[publishedUID] = localDashboard{path: path, uid: uid, deleted: true}
+			return nil
+		}
+
+		overlaid, err := hasOverlays(reference.fileSystem(), path, stack)
+		if err != nil {
+			return err
+		}
+		tags := []string{}
+		if declared, ok := dash["tags"].([]interface{}); ok {
+			for _, tag := range declared {
+				if tag, ok := tag.(string); ok {
+					tags = append(tags, tag)
+				}
+			}
+		}
+		localDashboards[publishedUID] = localDashboard{path: path, uid: uid, tags: tags, generated: p.isTemplate(path) || overlaid}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return localDashboards, nil
+}
+
+// RevertDashboard undoes the transformations Publish applies to a dashboard
+// when uploading it to the given stack.
+// Datasource variables and the datasource references bound to the stack
+// through a variable the dashboard declares are reset to their placeholders,
+// the stack ID variable is emptied, the configured tags
+// are removed and the IDSuffix is stripped from the UID and from the library
+// panel references. During an Export, the references to local library panels
+// whose UID was hashed are reverted to their local UID as well.
+func (p Publisher) RevertDashboard(stack *grafana.Stack, dash *grafana.DashboardModel) {
+	dash.ID = nil
+	dash.Delete("id")
+	dash.Delete("folderUid")
+
+	declared := map[string]struct{}{}
+	for _, parameter := range dash.Variables() {
+		if parameter.Type == "datasource" {
+			if variable, ok := lookupDatasourceVariable(parameter.Name); ok {
+				declared[variable.name] = struct{}{}
+				parameter.Current = nil
+				parameter.Delete("current")
+			}
+		}
+
+		if parameter.Type == "custom" && parameter.Name == stackIDVariable {
+			parameter.Current = nil
+			parameter.Options = nil
+			parameter.Query = nil
+			parameter.Delete("current")
+			parameter.Delete("options")
+			parameter.Delete("query")
+		}
+	}
+
+	for _, panel := range dash.AllPanels() {
+		if panel.LibraryPanel != nil && panel.LibraryPanel.UID != "" {
+			if localUID, ok := p.localLibraryPanels[panel.LibraryPanel.UID]; ok {
+				panel.LibraryPanel.UID = localUID
+			} else if p.config.RootFolder != "" && p.config.IDSuffix != "" {
+				panel.LibraryPanel.UID = strings.TrimSuffix(panel.LibraryPanel.UID, p.config.IDSuffix)
+			}
+		}
+		revertDatasourceReference(stack, declared, panel.Datasource)
+		for _, target := range panel.Targets {
+			if target != nil {
+				revertDatasourceReference(stack, declared, target.Datasource)
+			}
+		}
+	}
+	if dash.Annotations != nil {
+		for _, annotation := range dash.Annotations.List {
+			if annotation != nil {
+				revertDatasourceReference(stack, declared, annotation.Datasource)
+			}
+		}
+	}
+
+	if p.config.Tags != nil && dash.Tags != nil {
+		managedTags := map[string]struct{}{}
+		for _, tag := range p.config.Tags {
+			managedTags[tag] = struct{}{}
+		}
+		remaining := []string{}
+		for _, tag := range dash.Tags {
+			if _, managed := managedTags[tag]; !managed {
+				remaining = append(remaining, tag)
+			}
+		}
+		if len(remaining) == 0 {
+			dash.Tags = nil
+			dash.Delete("tags")
+		} else {
+			dash.Tags = remaining
+		}
+	}
+
+	if dash.UID != "" {
+		uid := dash.UID
+		if p.config.RootFolder != "" && p.config.IDSuffix != "" {
+			uid = strings.TrimSuffix(uid, p.config.IDSuffix)
+		}
+		if dash.Title != "" && uid == GenerateUniqueID(dash.Title) {
+			dash.UID = ""
+			dash.Delete("uid")
+		} else {
+			dash.UID = uid
+		}
+	}
+}
+
+// keepDeclaredTags returns the tags of a reverted dashboard with the
+// published tags the local file declares, which RevertDashboard removed when
+// they are configured tags.
+func keepDeclaredTags(tags, publishedTags, declaredTags []string) []string {
+	kept := map[string]struct{}{}
+	for _, tag := range tags {
+		kept[tag] = struct{}{}
+	}
+
+	published := map[string]struct{}{}
+	for _, tag := range publishedTags {
+		published[tag] = struct{}{}
+	}
+
+	for _, tag := range declaredTags {
+		if _, ok := kept[tag]; ok {
+			continue
+		}
+		if _, ok := published[tag]; !ok {
+			continue
+		}
+		tags = append(tags, tag)
+		kept[tag] = struct{}{}
+	}
+	return tags
+}
+
+// revertDatasourceReference replaces the name or UID of a stack datasource
+// bound to one of the declared datasource variables with a reference to that
+// variable.
+func revertDatasourceReference(stack *grafana.Stack, declared map[string]struct{}, datasource *grafana.DatasourceRef) {
+	if datasource == nil {
+		return
+	}
+	variable, ok := datasourceVariableByName(stack, declared, datasource.Reference())
+	if !ok {
+		return
+	}
+	if datasource.Name != "" {
+		datasource.Name = variable.reference()
+	} else {
+		datasource.UID = variable.reference()
+	}
+}
+
+// datasourceVariableByName returns the declared datasource variable bound to
+// the stack datasource with the given name or value.
+func datasourceVariableByName(stack *grafana.Stack, declared map[string]struct{}, name string) (datasourceVariable, bool) {
+	for _, variable := range datasourceVariables {
+		if _, ok := declared[variable.name]; !ok {
+			continue
+		}
+		if name == variable.datasourceName(stack) || name == variable.datasourceValue(stack) {
+			return variable, true
+		}
+	}
+	return datasourceVariable{}, false
+}
+
+// decodeDashboardFile decodes the JSON content of a local dashboard file and
+// returns its dashboard content.
+func decodeDashboardFile(path string, data []byte) (map[string]interface{}, error) {
+	dashboard := map[string]interface{}{}
+	err := json.Unmarshal(data, &dashboard)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+
+	dash, ok := dashboard["dashboard"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unable to find dashboard in %s", path)
+	}
+	return dash, nil
+}
+
+// writeDashboardFile writes a dashboard to a local file in its canonical
+// form, wrapped as expected by Publish, as YAML or JSON depending on the file
+// extension.
+func writeDashboardFile(fsys afero.Fs, path string, dash map[string]interface{}) error {
+	data, err := encodeDashboardFile(path, map[string]interface{}{"dashboard": NormaliseDashboard(dash)})
+	if err != nil {
+		return fmt.Errorf("failed to encode dashboard %s: %w", path, err)
+	}
+
+	err = fsys.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create folder for %s: %w", path, err)
+	}
+
+	err = afero.WriteFile(fsys, path, data, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write dashboard %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,373 @@
+package publisher
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	grafana "github.com/adevinta/go-grafana-toolkit/client"
+	system "github.com/adevinta/go-system-toolkit"
+	testutils "github.com/adevinta/go-testutils-toolkit"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func revertTestDashboard(t *testing.T, pub *Publisher, stack *grafana.Stack, dash map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	model, err := grafana.DecodeDashboardModel(dash)
+	require.NoError(t, err)
+	pub.RevertDashboard(stack, model)
+	reverted, err := model.JSON()
+	require.NoError(t, err)
+	return reverted
+}
+
+func TestRevertDashboard(t *testing.T) {
+	pub, err := NewPublisher(WithConfig(&PublisherConfig{
+		Tags:       []string{"automated"},
+		RootFolder: "root",
+		IDSuffix:   "-pr-1",
+	}))
+	require.NoError(t, err)
+	// Set by Export from the local library panels.
+	pub.localLibraryPanels = map[string]string{"hashed-library-panel-uid": "a-library-panel-uid-close-to-the-limit"}
+
+	dash := revertTestDashboard(t, pub, &testStack, map[string]interface{}{
+		"id":        12,
+		"uid":       "dash-1-pr-1",
+		"folderUid": "common-folder-uid",
+		"title":     "Dashboard",
+		"tags":      []interface{}{"team", "automated"},
+		"templating": map[string]interface{}{
+			"list": []interface{}{
+				map[string]interface{}{
+					"type": "datasource",
+					"name": "PROMPRO",
+					"current": map[string]interface{}{
+						"selected": false,
+						"text":     "grafanacloud-test-stack-prom",
+						"value":    "grafanacloud-test-stack-prom",
+					},
+				},
+				map[string]interface{}{
+					"type": "datasource",
+					"name": "LOGSPRO",
+					"current": map[string]interface{}{
+						"text":  "grafanacloud-test-stack-logs",
+						"value": "grafanacloud-test-stack-logs",
+					},
+				},
+				map[string]interface{}{
+					"type": "datasource",
+					"name": "OTHER",
+					"current": map[string]interface{}{
+						"text":  "other",
+						"value": "other",
+					},
+				},
+				map[string]interface{}{
+					"type":    "custom",
+					"name":    "STACKID",
+					"current": map[string]interface{}{"text": "123456", "value": "123456"},
+					"options": []interface{}{map[string]interface{}{"text": "123456", "value": "123456"}},
+					"query":   "123456",
+				},
+			},
+		},
+		"panels": []interface{}{
+			map[string]interface{}{
+				"datasource": map[string]interface{}{"type": "loki", "uid": "grafanacloud-test-stack-logs"},
+				"targets": []interface{}{
+					map[string]interface{}{"datasource": "grafanacloud-usage-insights"},
+					map[string]interface{}{"datasource": "grafanacloud-prom"},
+				},
+			},
+			map[string]interface{}{"libraryPanel": map[string]interface{}{"uid": "errors-pr-1", "name": "Errors"}},
+			map[string]interface{}{"libraryPanel": map[string]interface{}{"uid": "hashed-library-panel-uid", "name": "Long"}},
+		},
+	})
+
+	assert.Equal(t, map[string]interface{}{
+		"uid":   "dash-1",
+		"title": "Dashboard",
+		"tags":  []interface{}{"team"},
+		"templating": map[string]interface{}{
+			"list": []interface{}{
+				map[string]interface{}{
+					"type": "datasource",
+					"name": "PROMPRO",
+				},
+				map[string]interface{}{
+					"type": "datasource",
+					"name": "LOGSPRO",
+				},
+				map[string]interface{}{
+					"type": "datasource",
+					"name": "OTHER",
+					"current": map[string]interface{}{
+						"text":  "other",
+						"value": "other",
+					},
+				},
+				map[string]interface{}{
+					"type": "custom",
+					"name": "STACKID",
+				},
+			},
+		},
+		"panels": []interface{}{
+			map[string]interface{}{
+				"datasource": map[string]interface{}{"type": "loki", "uid": "${LOGSPRO}"},
+				"targets": []interface{}{
+					// LOGUSAGE is not declared by the dashboard.
+					map[string]interface{}{"datasource": "grafanacloud-usage-insights"},
+					map[string]interface{}{"datasource": "grafanacloud-prom"},
+				},
+			},
+			map[string]interface{}{"libraryPanel": map[string]interface{}{"uid": "errors", "name": "Errors"}},
+			map[string]interface{}{"libraryPanel": map[string]interface{}{"uid": "a-library-panel-uid-close-to-the-limit", "name": "Long"}},
+		},
+	}, dash)
+}
+
+func TestRevertDashboardRemovesTitleDerivedUID(t *testing.T) {
+	pub, err := NewPublisher(WithConfig(&PublisherConfig{
+		Tags: []string{"automated"},
+	}))
+	require.NoError(t, err)
+
+	dash := revertTestDashboard(t, pub, &testStack, map[string]interface{}{
+		"uid":   GenerateUniqueID("Dashboard"),
+		"title": "Dashboard",
+		"tags":  []interface{}{"automated"},
+	})
+
+	assert.Equal(t, map[string]interface{}{"title": "Dashboard"}, dash)
+}
+
+func TestExport(t *testing.T) {
+	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+
+	system.DefaultFileSystem = afero.NewMemMapFs()
+	defer func() { system.DefaultFileSystem = afero.NewOsFs() }()
+
+	require.NoError(t, system.DefaultFileSystem.MkdirAll("/local_folder_1", 0777))
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/existing.json", `{
+		"dashboard": {
+			"uid": "a-very-long-dashboard-uid-that-gets-hashed",
+			"title": "Existing Dashboard",
+			"tags": ["tag1", "team"]
+		}
+	}`)
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/removed.json.deleted", `{"dashboard": {"uid": "removed-uid"}}`)
+
+	pub, err := NewPublisher(
+		WithConfig(&PublisherConfig{
+			CommonDashboards: DashboardReferences{{LocalFolder: "/local_folder_1", GrafanaFolder: "Common"}},
+			CustomDashboards: DashboardReferences{{LocalFolder: "/local_folder_2", GrafanaFolder: "Custom"}},
+			CustomStack:      "custom-stack",
+			Tags:             []string{"tag1"},
+			RootFolder:       "root",
+			IDSuffix:         "-suffix",
+		}),
+	)
+	require.NoError(t, err)
+
+	existingUID := GenerateUniqueID("a-very-long-dashboard-uid-that-gets-hashed-suffix")
+
+	cloudClient := new(MockCloudClient)
+	testStackClient := new(MockStackClient)
+	pub.gcc = cloudClient
+
+	cloudClient.
+		On("GetStack", "test-stack").
+		Return(&testStack, nil)
+	cloudClient.
+		On("NewStackClient", &testStack).
+		Return(testStackClient, nil)
+
+	testStackClient.
+		On("GetFolder", nilFolder, "root").
+		Return(rootFolder, nil)
+	testStackClient.
+		On("GetFolder", rootFolder, "Common").
+		Return(commonFolder, nil)
+	testStackClient.
+		On("ListDashboardIDsInFolder", "common-folder-uid").
+		Return([]string{existingUID, "new-uid-suffix", "removed-uid-suffix"}, nil)
+	testStackClient.
+		On("GetDashboard", existingUID).
+		Return(&grafana.Dashboard{
+			UID: existingUID,
+			Dashboard: map[string]interface{}{
+				"id":        1,
+				"uid":       existingUID,
+				"folderUid": "common-folder-uid",
+				"title":     "Existing Dashboard",
+				"tags":      []interface{}{"tag1", "team", "tag1"},
+			},
+		}, nil)
+	testStackClient.
+		On("GetDashboard", "new-uid-suffix").
+		Return(&grafana.Dashboard{
+			UID: "new-uid-suffix",
+			Dashboard: map[string]interface{}{
+				"id":        2,
+				"uid":       "new-uid-suffix",
+				"folderUid": "common-folder-uid",
+				"title":     "New Dashboard",
+				"tags":      []interface{}{"tag1"},
+			},
+		}, nil)
+	testStackClient.On("Cleanup").Return(nil)
+
+	err = pub.Export("test-stack")
+	require.NoError(t, err)
+
+	cloudClient.AssertExpectations(t)
+	testStackClient.AssertExpectations(t)
+
+	// Configured tags are only kept when the local file declares them.
+	assertDashboardFile(t, "/local_folder_1/existing.json", map[string]interface{}{
+		"uid":   "a-very-long-dashboard-uid-that-gets-hashed",
+		"title": "Existing Dashboard",
+		"tags":  []interface{}{"tag1", "team"},
+	})
+	assertDashboardFile(t, "/local_folder_1/new-uid.json", map[string]interface{}{
+		"uid":   "new-uid",
+		"title": "New Dashboard",
+	})
+
+	_, err = system.DefaultFileSystem.Stat("/local_folder_1/removed-uid.json")
+	assert.True(t, os.IsNotExist(err), "deleted dashboards should not be exported")
+}
+
+func TestExportSkipsMissingFolders(t *testing.T) {
+	system.DefaultFileSystem = afero.NewMemMapFs()
+	defer func() { system.DefaultFileSystem = afero.NewOsFs() }()
+
+	pub, err := NewPublisher(
+		WithConfig(&PublisherConfig{
+			CommonDashboards: DashboardReferences{
+				{LocalFolder: "/local_folder_1", GrafanaFolder: "Common"},
+				{LocalFolder: "/local_folder_2", GrafanaFolder: "Missing"},
+			},
+		}),
+	)
+	require.NoError(t, err)
+
+	cloudClient := new(MockCloudClient)
+	testStackClient := new(MockStackClient)
+	pub.gcc = cloudClient
+
+	cloudClient.
+		On("GetStack", "test-stack").
+		Return(&testStack, nil)
+	cloudClient.
+		On("NewStackClient", &testStack).
+		Return(testStackClient, nil)
+
+	testStackClient.
+		On("GetFolder", nilFolder, "Common").
+		Return(commonFolder, nil)
+	testStackClient.
+		On("GetFolder", nilFolder, "Missing").
+		Return(nilFolder, nil)
+	testStackClient.
+		On("ListDashboardIDsInFolder", "common-folder-uid").
+		Return([]string{}, nil)
+	testStackClient.On("Cleanup").Return(nil)
+
+	err = pub.Export("test-stack")
+	require.NoError(t, err)
+
+	cloudClient.AssertExpectations(t)
+	testStackClient.AssertExpectations(t)
+	testStackClient.AssertNotCalled(t, "EnsureFolder", nilFolder, "Missing")
+}
+
+func TestExportNestedFolders(t *testing.T) {
+	system.DefaultFileSystem = afero.NewMemMapFs()
+	defer func() { system.DefaultFileSystem = afero.NewOsFs() }()
+
+	require.NoError(t, system.DefaultFileSystem.MkdirAll("/local_folder_1/team-a", 0777))
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/team-a/existing.json", `{"dashboard": {"uid": "existing", "title": "Existing"}}`)
+
+	pub, err := NewPublisher(
+		WithConfig(&PublisherConfig{
+			CommonDashboards: DashboardReferences{{LocalFolder: "/local_folder_1", GrafanaFolder: "Common", NestedFolders: true}},
+		}),
+	)
+	require.NoError(t, err)
+
+	teamAFolder := &grafana.Folder{UID: subfolderUID(commonFolder, "team-a"), Title: "team-a"}
+	subFolder := &grafana.Folder{UID: subfolderUID(teamAFolder, "sub"), Title: "sub"}
+	manualFolder := &grafana.Folder{UID: "manual-uid", Title: "manual"}
+
+	cloudClient := new(MockCloudClient)
+	testStackClient := new(MockStackClient)
+	pub.gcc = cloudClient
+
+	cloudClient.
+		On("GetStack", "test-stack").
+		Return(&testStack, nil)
+	cloudClient.
+		On("NewStackClient", &testStack).
+		Return(testStackClient, nil)
+
+	testStackClient.
+		On("GetFolder", nilFolder, "Common").
+		Return(commonFolder, nil)
+	testStackClient.
+		On("ListDashboardIDsInFolder", "common-folder-uid").
+		Return([]string{"top"}, nil)
+	testStackClient.
+		On("ListDashboardIDsInFolder", teamAFolder.UID).
+		Return([]string{"existing"}, nil)
+	testStackClient.
+		On("ListDashboardIDsInFolder", subFolder.UID).
+		Return([]string{"nested"}, nil)
+	testStackClient.
+		On("ListFolders", commonFolder).
+		Return([]*grafana.Folder{teamAFolder, manualFolder}, nil)
+	testStackClient.
+		On("ListFolders", teamAFolder).
+		Return([]*grafana.Folder{subFolder}, nil)
+	testStackClient.
+		On("ListFolders", subFolder).
+		Return([]*grafana.Folder{}, nil)
+	for _, uid := range []string{"top", "existing", "nested"} {
+		testStackClient.
+			On("GetDashboard", uid).
+			Return(&grafana.Dashboard{
+				UID:       uid,
+				Dashboard: map[string]interface{}{"uid": uid, "title": uid},
+			}, nil)
+	}
+	testStackClient.On("Cleanup").Return(nil)
+
+	err = pub.Export("test-stack")
+	require.NoError(t, err)
+
+	cloudClient.AssertExpectations(t)
+	testStackClient.AssertExpectations(t)
+	// Folders not created by the publisher are not exported.
+	testStackClient.AssertNotCalled(t, "ListDashboardIDsInFolder", manualFolder.UID)
+
+	assertDashboardFile(t, "/local_folder_1/top.json", map[string]interface{}{"uid": "top", "title": "top"})
+	assertDashboardFile(t, "/local_folder_1/team-a/existing.json", map[string]interface{}{"uid": "existing", "title": "existing"})
+	assertDashboardFile(t, "/local_folder_1/team-a/sub/nested.json", map[string]interface{}{"uid": "nested", "title": "nested"})
+}
+
+func assertDashboardFile(t *testing.T, path string, expected map[string]interface{}) {
+	t.Helper()
+
+	data, err := afero.ReadFile(system.DefaultFileSystem, path)
+	require.NoError(t, err)
+
+	content := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(data, &content))
+	assert.Equal(t, map[string]interface{}{"dashboard": expected}, content)
+}
@@ -0,0 +1,249 @@
+package publisher
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	grafana "github.com/adevinta/go-grafana-toolkit/client"
+	log "github.com/adevinta/go-log-toolkit"
+)
+
+// subfolderUID returns the UID of the folder mirroring a directory, derived
+// from the UID of its parent folder and its title, so that the folders
+// created by the publisher are recognised when pruning.
+func subfolderUID(parentFolder *grafana.Folder, title string) string {
+	return GenerateUniqueID(parentFolder.UID + "/" + title)
+}
+
+// ensureSubfolder ensures the Grafana folders mirroring a directory, relative
+// to the local folder of a reference, exist.
+// Folders are cached by directory in subfolders, which must contain the
+// reference folder as ".".
+func ensureSubfolder(sc grafana.GrafanaStackClient, subfolders map[string]*grafana.Folder, dir string) (*grafana.Folder, error) {
+	if folder, ok := subfolders[dir]; ok {
+		return folder, nil
+	}
+
+	parentFolder, err := ensureSubfolder(sc, subfolders, filepath.Dir(dir))
+	if err != nil {
+		return nil, err
+	}
+
+	title := filepath.Base(dir)
+	folder, err := sc.EnsureFolderWithUID(parentFolder, title, subfolderUID(parentFolder, title))
+	if err != nil {
+		return nil, fmt.Errorf("could not ensure folder %s: %w", dir, err)
+	}
+
+	subfolders[dir] = folder
+	return folder, nil
+}
+
+// lookupSubfolderUID returns the UID of the folder mirroring a directory,
+// relative to the local folder of a reference, without creating it.
+// Folders are looked up in subfolders as by ensureSubfolder.
+func lookupSubfolderUID(subfolders map[string]*grafana.Folder, dir string) string {
+	if folder, ok := subfolders[dir]; ok {
+		return folder.UID
+	}
+	return GenerateUniqueID(lookupSubfolderUID(subfolders, filepath.Dir(dir)) + "/" + filepath.Base(dir))
+}
+
+// enforceFolderPermissions replaces the permissions of a folder with the
+// configured ones. Folders without configured permissions keep theirs.
+func enforceFolderPermissions(sc grafana.GrafanaStackClient, folder *grafana.Folder, permissions []*grafana.FolderPermission) error {
+	if len(permissions) == 0 {
+		return nil
+	}
+
+	log.DefaultLogger.WithField("folder", folder.Title).Println("Enforcing folder permissions")
+	return sc.SetFolderPermissions(folder.UID, permissions)
+}
+
+// pruneSubfolders deletes, under a folder mirroring a local directory, the
+// subfolders created by the publisher whose directory no longer exists
+// locally, once they are empty. Subfolders created otherwise are kept.
+func pruneSubfolders(sc grafana.GrafanaStackClient, folder *grafana.Folder, reference DashboardReference, dir string) error {
+	localFolder := reference.LocalFolder
+
+	children, err := sc.ListFolders(folder)
+	if err != nil {
+		return err
+	}
+
+	for _, child := range children {
+		if child.UID != subfolderUID(folder, child.Title) {
+			continue
+		}
+		childDir := filepath.Join(dir, child.Title)
+
+		err = pruneSubfolders(sc, child, reference, childDir)
+		if err != nil {
+			return err
+		}
+
+		info, err := reference.fileSystem().Stat(filepath.Join(localFolder, childDir))
+		if err == nil && info.IsDir() {
+			continue
+		}
+
+		err = sc.DeleteFolderIfEmpty(child.UID)
+		var notEmpty *grafana.FolderNotEmptyError
+		if errors.As(err, &notEmpty) {
+			log.DefaultLogger.WithField("folder", childDir).WithField("localFolder", localFolder).Warn(notEmpty.Error())
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		log.DefaultLogger.WithField("folder", childDir).WithField("localFolder", localFolder).Println("Deleted empty folder")
+	}
+
+	return nil
+}
+
+// lookupFolderPath returns the folders of a slash separated path from the
+// top level, or nil when one of them does not exist.
+func lookupFolderPath(sc grafana.GrafanaStackClient, path string) ([]*grafana.Folder, error) {
+	folders := []*grafana.Folder{}
+	var parentFolder *grafana.Folder
+	for _, name := range grafana.SplitFolderPath(path) {
+		folder, err := sc.GetFolder(parentFolder, name)
+		if err != nil {
+			return nil, err
+		}
+		if folder == nil {
+			return nil, nil
+		}
+		folders = append(folders, folder)
+		parentFolder = folder
+	}
+	return folders, nil
+}
+
+// migratePreviousFolders moves the dashboards published by a reference from
+// its previous folders into its folder, then deletes the previous folders
+// once empty. Other dashboards, and the parents of the previous folders, are
+// kept.
+func (p Publisher) migratePreviousFolders(sc grafana.GrafanaStackClient, stack *grafana.Stack, folder *grafana.Folder, reference DashboardReference) error {
+	if len(reference.PreviousFolders) == 0 {
+		return nil
+	}
+
+	uids, err := p.referenceDashboardUIDs(stack, reference)
+	if err != nil {
+		return err
+	}
+	local := map[string]struct{}{}
+	for _, uid := range uids {
+		local[uid] = struct{}{}
+	}
+
+	for _, previous := range reference.PreviousFolders {
+		folders, err := lookupFolderPath(sc, previous)
+		if err != nil {
+			return fmt.Errorf("could not look up previous folder %s: %w", previous, err)
+		}
+		if len(folders) == 0 || folders[len(folders)-1].UID == folder.UID {
+			continue
+		}
+		previousFolder := folders[len(folders)-1]
+
+		log.DefaultLogger.WithField("previousFolder", previous).WithField("folder", folder.Title).Println("Migrating previous folder")
+
+		err = p.migrateFolderContent(sc, previousFolder, folder, reference, local)
+		if err != nil {
+			return fmt.Errorf("could not migrate previous folder %s: %w", previous, err)
+		}
+
+		err = sc.DeleteFolderIfEmpty(previousFolder.UID)
+		var notEmpty *grafana.FolderNotEmptyError
+		if errors.As(err, &notEmpty) {
+			log.DefaultLogger.WithField("previousFolder", previous).Warn(notEmpty.Error())
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateFolderContent moves the dashboards of a folder published by the
+// publisher to another one. With nested folders, the subfolders created by
+// the publisher are migrated to the matching subfolders of the other one, and
+// deleted once empty.
+func (p Publisher) migrateFolderContent(sc grafana.GrafanaStackClient, from, to *grafana.Folder, reference DashboardReference, local map[string]struct{}) error {
+	uids, err := sc.ListDashboardIDsInFolder(from.UID)
+	if err != nil {
+		return err
+	}
+	for _, uid := range uids {
+		dashboard, err := sc.GetDashboard(uid)
+		if err != nil {
+			return err
+		}
+		if !p.isPublishedDashboard(dashboard, local) {
+			continue
+		}
+		dashboard.FolderUID = to.UID
+		err = sc.UploadDashboard(dashboard)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !reference.NestedFolders {
+		return nil
+	}
+
+	children, err := sc.ListFolders(from)
+	if err != nil {
+		return err
+	}
+	for _, child := range children {
+		if child.UID == to.UID || child.UID != subfolderUID(from, child.Title) {
+			continue
+		}
+		target, err := sc.EnsureFolderWithUID(to, child.Title, subfolderUID(to, child.Title))
+		if err != nil {
+			return fmt.Errorf("could not ensure folder %s: %w", child.Title, err)
+		}
+		err = p.migrateFolderContent(sc, child, target, reference, local)
+		if err != nil {
+			return err
+		}
+		err = sc.DeleteFolderIfEmpty(child.UID)
+		var notEmpty *grafana.FolderNotEmptyError
+		if err != nil && !errors.As(err, &notEmpty) {
+			return err
+		}
+	}
+	return nil
+}
+
+// isPublishedDashboard reports whether a dashboard was published from the
+// local folder, given the UIDs of its local dashboards, or holds all the
+// configured tags.
+func (p Publisher) isPublishedDashboard(dashboard *grafana.Dashboard, local map[string]struct{}) bool {
+	if _, ok := local[dashboard.UID]; ok {
+		return true
+	}
+	if len(p.config.Tags) == 0 {
+		return false
+	}
+
+	dash, _ := dashboard.Dashboard.(map[string]interface{})
+	tags, _ := dash["tags"].([]interface{})
+	held := map[interface{}]struct{}{}
+	for _, tag := range tags {
+		held[tag] = struct{}{}
+	}
+	for _, tag := range p.config.Tags {
+		if _, ok := held[tag]; !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,318 @@
+package publisher
+
+import (
+	"os"
+	"testing"
+
+	grafana "github.com/adevinta/go-grafana-toolkit/client"
+	system "github.com/adevinta/go-system-toolkit"
+	testutils "github.com/adevinta/go-testutils-toolkit"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublishNestedFolders(t *testing.T) {
+	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+
+	system.DefaultFileSystem = afero.NewMemMapFs()
+	defer func() { system.DefaultFileSystem = afero.NewOsFs() }()
+
+	require.NoError(t, system.DefaultFileSystem.MkdirAll("/local_folder_1/team-a/sub", 0777))
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/top.json", `{"dashboard": {"uid": "top", "title": "Top"}}`)
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/team-a/sub/nested.json", `{"dashboard": {"uid": "nested", "title": "Nested"}}`)
+	// Directories without dashboards to upload get no folder.
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/archive/old.json.deleted", `{"dashboard": {"uid": "old"}}`)
+
+	// Subfolders created by the publisher have UIDs derived from their parent.
+	teamAFolder := &grafana.Folder{UID: subfolderUID(commonFolder, "team-a"), Title: "team-a"}
+	subFolder := &grafana.Folder{UID: subfolderUID(teamAFolder, "sub"), Title: "sub"}
+	oldTeamFolder := &grafana.Folder{UID: subfolderUID(commonFolder, "old-team"), Title: "old-team"}
+	legacyFolder := &grafana.Folder{UID: subfolderUID(commonFolder, "legacy"), Title: "legacy"}
+	manualFolder := &grafana.Folder{UID: "manual-uid", Title: "manual"}
+
+	cloudClient := new(MockCloudClient)
+	testStackClient := new(MockStackClient)
+
+	uploadedFolders := map[string]string{}
+
+	cloudClient.
+		On("ListStacks").
+		Return(grafana.Stacks{testStack}, nil).
+		Once()
+	cloudClient.
+		On("NewStackClient", &testStack).
+		Return(testStackClient, nil)
+
+	testStackClient.
+		On("EnsureFolder", nilFolder, "Common").
+		Return(commonFolder, nil)
+	testStackClient.
+		On("EnsureFolderWithUID", commonFolder, "team-a", teamAFolder.UID).
+		Return(teamAFolder, nil).
+		Once()
+	testStackClient.
+		On("EnsureFolderWithUID", teamAFolder, "sub", subFolder.UID).
+		Return(subFolder, nil).
+		Once()
+	testStackClient.
+		On("UploadDashboard", mock.AnythingOfType("*client.Dashboard")).
+		Run(func(args mock.Arguments) {
+			dashboard := args.Get(0).(*grafana.Dashboard)
+			uploadedFolders[dashboard.UID] = dashboard.FolderUID
+		}).
+		Return(nil)
+	testStackClient.
+		On("GetDashboard", "old").
+		Return((*grafana.Dashboard)(nil), assert.AnError).
+		Once()
+
+	testStackClient.
+		On("ListFolders", commonFolder).
+		Return([]*grafana.Folder{teamAFolder, oldTeamFolder, legacyFolder, manualFolder}, nil)
+	testStackClient.
+		On("ListFolders", teamAFolder).
+		Return([]*grafana.Folder{subFolder}, nil)
+	testStackClient.
+		On("ListFolders", subFolder).
+		Return([]*grafana.Folder{}, nil)
+	testStackClient.
+		On("ListFolders", oldTeamFolder).
+		Return([]*grafana.Folder{}, nil)
+	testStackClient.
+		On("ListFolders", legacyFolder).
+		Return([]*grafana.Folder{}, nil)
+	testStackClient.
+		On("DeleteFolderIfEmpty", oldTeamFolder.UID).
+		Return(nil).
+		Once()
+	testStackClient.
+		On("DeleteFolderIfEmpty", legacyFolder.UID).
+		Return(&grafana.FolderNotEmptyError{UID: legacyFolder.UID, Counts: map[string]int64{"dashboard": 1}}).
+		Once()
+
+	testStackClient.On("Cleanup").Return(nil)
+
+	pub, err := NewPublisher(
+		WithCloudClient(cloudClient),
+		WithConfig(&PublisherConfig{
+			CommonDashboards: DashboardReferences{{LocalFolder: "/local_folder_1", GrafanaFolder: "Common", NestedFolders: true}},
+			TestStack:        "test-stack",
+		}),
+	)
+	require.NoError(t, err)
+
+	err = pub.Publish(true)
+	assert.NoError(t, err)
+
+	cloudClient.AssertExpectations(t)
+	testStackClient.AssertExpectations(t)
+	testStackClient.AssertNotCalled(t, "ListFolders", manualFolder)
+	testStackClient.AssertNotCalled(t, "DeleteFolderIfEmpty", manualFolder.UID)
+	testStackClient.AssertNotCalled(t, "EnsureFolderWithUID", commonFolder, "archive", mock.Anything)
+
+	assert.Equal(t, map[string]string{
+		"top":    "common-folder-uid",
+		"nested": subFolder.UID,
+	}, uploadedFolders)
+}
+
+func TestPublishEnforcesFolderPermissions(t *testing.T) {
+	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+
+	system.DefaultFileSystem = afero.NewMemMapFs()
+	defer func() { system.DefaultFileSystem = afero.NewOsFs() }()
+
+	require.NoError(t, system.DefaultFileSystem.MkdirAll("/local_folder_1", 0777))
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/dashboard.json", `{"dashboard": {"uid": "dash-1", "title": "Dashboard"}}`)
+
+	rootPermissions := []*grafana.FolderPermission{{Role: "Viewer", Permission: grafana.PermissionView}}
+	commonPermissions := []*grafana.FolderPermission{
+		{Team: "SRE", Permission: grafana.PermissionEdit},
+		{ServiceAccount: "grafana-sync", Permission: grafana.PermissionAdmin},
+	}
+
+	cloudClient := new(MockCloudClient)
+	testStackClient := new(MockStackClient)
+
+	cloudClient.
+		On("ListStacks").
+		Return(grafana.Stacks{testStack}, nil).
+		Once()
+	// The root folder and the dashboards share the client of the stack.
+	cloudClient.
+		On("NewStackClientWithRole", &testStack, grafana.RoleAdmin).
+		Return(testStackClient, nil).
+		Once()
+
+	permissionsSet := false
+	testStackClient.
+		On("EnsureFolderPath", "root").
+		Return(rootFolder, nil)
+	testStackClient.
+		On("SetFolderPermissions", rootFolder.UID, rootPermissions).
+		Return(nil).
+		Once()
+	testStackClient.
+		On("EnsureFolder", rootFolder, "Common").
+		Return(commonFolder, nil)
+	testStackClient.
+		On("SetFolderPermissions", commonFolder.UID, commonPermissions).
+		Run(func(mock.Arguments) { permissionsSet = true }).
+		Return(nil).
+		Once()
+	testStackClient.
+		On("UploadDashboard", mock.AnythingOfType("*client.Dashboard")).
+		Run(func(mock.Arguments) {
+			assert.True(t, permissionsSet, "folder permissions should be enforced before uploading dashboards")
+		}).
+		Return(nil).
+		Once()
+	testStackClient.On("Cleanup").Return(nil).Once()
+
+	pub, err := NewPublisher(
+		WithCloudClient(cloudClient),
+		WithConfig(&PublisherConfig{
+			CommonDashboards: DashboardReferences{{
+				LocalFolder:   "/local_folder_1",
+				GrafanaFolder: "Common",
+				Permissions:   commonPermissions,
+			}},
+			TestStack:             "test-stack",
+			RootFolder:            "root",
+			RootFolderPermissions: rootPermissions,
+		}),
+	)
+	require.NoError(t, err)
+
+	err = pub.Publish(false)
+	assert.NoError(t, err)
+
+	cloudClient.AssertExpectations(t)
+	testStackClient.AssertExpectations(t)
+}
+
+func TestPublishMigratesPreviousFolders(t *testing.T) {
+	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+
+	system.DefaultFileSystem = afero.NewMemMapFs()
+	defer func() { system.DefaultFileSystem = afero.NewOsFs() }()
+
+	require.NoError(t, system.DefaultFileSystem.MkdirAll("/local_folder_1/team-a", 0777))
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/dashboard.json", `{"dashboard": {"uid": "dash-1", "title": "Dashboard"}}`)
+
+	oldRootFolder := &grafana.Folder{UID: "old-root-uid", Title: "old-root"}
+	oldCommonFolder := &grafana.Folder{UID: "old-common-uid", Title: "Old Common"}
+	oldTeamFolder := &grafana.Folder{UID: subfolderUID(oldCommonFolder, "team-a"), Title: "team-a"}
+	manualFolder := &grafana.Folder{UID: "manual-folder-uid", Title: "manual"}
+	teamFolder := &grafana.Folder{UID: subfolderUID(commonFolder, "team-a"), Title: "team-a"}
+
+	cloudClient := new(MockCloudClient)
+	testStackClient := new(MockStackClient)
+
+	cloudClient.
+		On("ListStacks").
+		Return(grafana.Stacks{testStack}, nil).
+		Once()
+	cloudClient.
+		On("NewStackClient", &testStack).
+		Return(testStackClient, nil)
+
+	uploadedFolders := map[string]string{}
+	testStackClient.
+		On("EnsureFolderPath", "root").
+		Return(rootFolder, nil)
+	testStackClient.
+		On("EnsureFolder", rootFolder, "Common").
+		Return(commonFolder, nil)
+	testStackClient.
+		On("GetFolder", nilFolder, "old-root").
+		Return(oldRootFolder, nil)
+	testStackClient.
+		On("GetFolder", oldRootFolder, "Old Common").
+		Return(oldCommonFolder, nil)
+	testStackClient.
+		On("GetFolder", nilFolder, "never-published").
+		Return(nilFolder, nil)
+	testStackClient.
+		On("ListDashboardIDsInFolder", "old-common-uid").
+		Return([]string{"dash-1", "tagged", "manual"}, nil)
+	testStackClient.
+		On("GetDashboard", "dash-1").
+		Return(&grafana.Dashboard{UID: "dash-1", FolderUID: "old-common-uid", Dashboard: map[string]interface{}{"uid": "dash-1"}}, nil)
+	testStackClient.
+		On("GetDashboard", "tagged").
+		Return(&grafana.Dashboard{UID: "tagged", FolderUID: "old-common-uid", Dashboard: map[string]interface{}{"uid": "tagged", "tags": []interface{}{"automated"}}}, nil)
+	testStackClient.
+		On("GetDashboard", "manual").
+		Return(&grafana.Dashboard{UID: "manual", FolderUID: "old-common-uid", Dashboard: map[string]interface{}{"uid": "manual"}}, nil)
+	testStackClient.
+		On("ListDashboardIDsInFolder", oldTeamFolder.UID).
+		Return([]string{}, nil)
+	testStackClient.
+		On("UploadDashboard", mock.AnythingOfType("*client.Dashboard")).
+		Run(func(args mock.Arguments) {
+			dashboard := args.Get(0).(*grafana.Dashboard)
+			uploadedFolders[dashboard.UID] = dashboard.FolderUID
+		}).
+		Return(nil)
+	testStackClient.
+		On("ListFolders", oldCommonFolder).
+		Return([]*grafana.Folder{oldTeamFolder, manualFolder}, nil)
+	testStackClient.
+		On("ListFolders", oldTeamFolder).
+		Return([]*grafana.Folder{}, nil)
+	testStackClient.
+		On("EnsureFolderWithUID", commonFolder, "team-a", teamFolder.UID).
+		Return(teamFolder, nil).
+		Once()
+	testStackClient.
+		On("ListFolders", commonFolder).
+		Return([]*grafana.Folder{teamFolder}, nil)
+	testStackClient.
+		On("ListFolders", teamFolder).
+		Return([]*grafana.Folder{}, nil)
+	testStackClient.
+		On("DeleteFolderIfEmpty", oldTeamFolder.UID).
+		Return(nil).
+		Once()
+	// The manual dashboard and folder stay in the previous folder.
+	testStackClient.
+		On("DeleteFolderIfEmpty", "old-common-uid").
+		Return(&grafana.FolderNotEmptyError{UID: "old-common-uid", Counts: map[string]int64{"dashboard": 1, "folder": 1}}).
+		Once()
+	testStackClient.On("Cleanup").Return(nil)
+
+	pub, err := NewPublisher(
+		WithCloudClient(cloudClient),
+		WithConfig(&PublisherConfig{
+			CommonDashboards: DashboardReferences{{
+				LocalFolder:     "/local_folder_1",
+				GrafanaFolder:   "Common",
+				PreviousFolders: []string{"old-root/Old Common", "never-published"},
+				NestedFolders:   true,
+			}},
+			TestStack:  "test-stack",
+			RootFolder: "root",
+			Tags:       []string{"automated"},
+		}),
+	)
+	require.NoError(t, err)
+
+	err = pub.Publish(false)
+	assert.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"tagged": commonFolder.UID,
+		"dash-1": commonFolder.UID,
+	}, uploadedFolders)
+
+	cloudClient.AssertExpectations(t)
+	testStackClient.AssertExpectations(t)
+	testStackClient.AssertNotCalled(t, "ListFolders", manualFolder)
+	testStackClient.AssertNotCalled(t, "DeleteFolderIfEmpty", "old-root-uid")
+}
@@ -35,6 +35,11 @@ func (m *MockStackClient) EnsureFolder(rootFolder *grafana.Folder, folder string
 	return args.Get(0).(*grafana.Folder), args.Error(1)
 }
 
+func (m *MockStackClient) EnsureFolderWithUID(rootFolder *grafana.Folder, folder, uid string) (*grafana.Folder, error) {
+	args := m.Called(rootFolder, folder, uid)
+	return args.Get(0).(*grafana.Folder), args.Error(1)
+}
+
 func (m *MockStackClient) GetDataSource(name string) (*grafana.Datasource, error) {
 	args := m.Called(name)
 	return args.Get(0).(*grafana.Datasource), args.Error(1)
@@ -55,6 +60,11 @@ func (m *MockStackClient) ListDashboardIDsInFolder(folderUID string) ([]string,
 	return args.Get(0).([]string), args.Error(1)
 }
 
+func (m *MockStackClient) ListDashboardIDs(tag string) ([]string, error) {
+	args := m.Called(tag)
+	return args.Get(0).([]string), args.Error(1)
+}
+
 type MockCloudClient struct {
 	mock.Mock
 }
@@ -94,8 +104,244 @@ func (m *MockCloudClient) NewStackClient(stack *grafana.Stack) (grafana.GrafanaS
 	return args.Get(0).(grafana.GrafanaStackClient), args.Error(1)
 }
 
+func (m *MockCloudClient) NewStackClientWithRole(stack *grafana.Stack, role string) (grafana.GrafanaStackClient, error) {
+	args := m.Called(stack, role)
+	fmt.Println("called NewStackClientWithRole: ", stack, role)
+	return args.Get(0).(grafana.GrafanaStackClient), args.Error(1)
+}
+
 func (m *MockCloudClient) NewStackClientWithHttpClient(stack *grafana.Stack, httpClient *http.Client) (grafana.GrafanaStackClient, error) {
 	args := m.Called(stack)
 	fmt.Println("called NewStackClientWithHttpClient: ", stack)
 	return args.Get(0).(grafana.GrafanaStackClient), args.Error(1)
 }
+
+func (m *MockStackClient) ListPlugins() ([]grafana.Plugin, error) {
+	args := m.Called()
+	return args.Get(0).([]grafana.Plugin), args.Error(1)
+}
+
+func (m *MockStackClient) ListFolders(rootFolder *grafana.Folder) ([]*grafana.Folder, error) {
+	args := m.Called(rootFolder)
+	return args.Get(0).([]*grafana.Folder), args.Error(1)
+}
+
+func (m *MockStackClient) DeleteFolder(uid string) error {
+	args := m.Called(uid)
+	return args.Error(0)
+}
+
+func (m *MockStackClient) GetFolder(rootFolder *grafana.Folder, folderName string) (*grafana.Folder, error) {
+	args := m.Called(rootFolder, folderName)
+	return args.Get(0).(*grafana.Folder), args.Error(1)
+}
+
+func (m *MockStackClient) GetFolderByUID(uid string) (*grafana.Folder, error) {
+	args := m.Called(uid)
+	return args.Get(0).(*grafana.Folder), args.Error(1)
+}
+
+func (m *MockStackClient) ListFolderChildren(rootFolder *grafana.Folder, page, limit int64) ([]*grafana.Folder, error) {
+	args := m.Called(rootFolder, page, limit)
+	return args.Get(0).([]*grafana.Folder), args.Error(1)
+}
+
+func (m *MockStackClient) RenameFolder(uid, title string) (*grafana.Folder, error) {
+	args := m.Called(uid, title)
+	return args.Get(0).(*grafana.Folder), args.Error(1)
+}
+
+func (m *MockStackClient) MoveFolder(uid string, parentFolder *grafana.Folder) (*grafana.Folder, error) {
+	args := m.Called(uid, parentFolder)
+	return args.Get(0).(*grafana.Folder), args.Error(1)
+}
+
+func (m *MockStackClient) DeleteFolderIfEmpty(uid string) error {
+	args := m.Called(uid)
+	return args.Error(0)
+}
+
+func (m *MockStackClient) ListLibraryPanels(folderUID string) ([]*grafana.LibraryPanel, error) {
+	args := m.Called(folderUID)
+	return args.Get(0).([]*grafana.LibraryPanel), args.Error(1)
+}
+
+func (m *MockStackClient) GetLibraryPanel(uid string) (*grafana.LibraryPanel, error) {
+	args := m.Called(uid)
+	return args.Get(0).(*grafana.LibraryPanel), args.Error(1)
+}
+
+func (m *MockStackClient) UploadLibraryPanel(panel *grafana.LibraryPanel) error {
+	args := m.Called(panel)
+	return args.Error(0)
+}
+
+func (m *MockStackClient) DeleteLibraryPanel(uid string) error {
+	args := m.Called(uid)
+	return args.Error(0)
+}
+
+func (m *MockStackClient) ListAlertRuleGroups(folderUID string) ([]*grafana.AlertRuleGroup, error) {
+	args := m.Called(folderUID)
+	return args.Get(0).([]*grafana.AlertRuleGroup), args.Error(1)
+}
+
+func (m *MockStackClient) GetAlertRuleGroup(folderUID, group string) (*grafana.AlertRuleGroup, error) {
+	args := m.Called(folderUID, group)
+	return args.Get(0).(*grafana.AlertRuleGroup), args.Error(1)
+}
+
+func (m *MockStackClient) PutAlertRuleGroup(group *grafana.AlertRuleGroup) error {
+	args := m.Called(group)
+	return args.Error(0)
+}
+
+func (m *MockStackClient) DeleteAlertRuleGroup(folderUID, group string) error {
+	args := m.Called(folderUID, group)
+	return args.Error(0)
+}
+
+func (m *MockStackClient) ListContactPoints() ([]*grafana.ContactPoint, error) {
+	args := m.Called()
+	return args.Get(0).([]*grafana.ContactPoint), args.Error(1)
+}
+
+func (m *MockStackClient) UploadContactPoint(contactPoint *grafana.ContactPoint, existing []*grafana.ContactPoint) error {
+	args := m.Called(contactPoint, existing)
+	return args.Error(0)
+}
+
+func (m *MockStackClient) DeleteContactPoint(uid string) error {
+	args := m.Called(uid)
+	return args.Error(0)
+}
+
+func (m *MockStackClient) ListNotificationTemplates() ([]*grafana.NotificationTemplate, error) {
+	args := m.Called()
+	return args.Get(0).([]*grafana.NotificationTemplate), args.Error(1)
+}
+
+func (m *MockStackClient) PutNotificationTemplate(name, template string) error {
+	args := m.Called(name, template)
+	return args.Error(0)
+}
+
+func (m *MockStackClient) DeleteNotificationTemplate(name string) error {
+	args := m.Called(name)
+	return args.Error(0)
+}
+
+func (m *MockStackClient) ListMuteTimings() ([]*grafana.MuteTiming, error) {
+	args := m.Called()
+	return args.Get(0).([]*grafana.MuteTiming), args.Error(1)
+}
+
+func (m *MockStackClient) UploadMuteTiming(muteTiming *grafana.MuteTiming) error {
+	args := m.Called(muteTiming)
+	return args.Error(0)
+}
+
+func (m *MockStackClient) DeleteMuteTiming(name string) error {
+	args := m.Called(name)
+	return args.Error(0)
+}
+
+func (m *MockStackClient) GetNotificationPolicyTree() (*grafana.NotificationPolicy, error) {
+	args := m.Called()
+	return args.Get(0).(*grafana.NotificationPolicy), args.Error(1)
+}
+
+func (m *MockStackClient) SetNotificationPolicyTree(policy *grafana.NotificationPolicy) error {
+	args := m.Called(policy)
+	return args.Error(0)
+}
+
+func (m *MockStackClient) ListDataSources(dsType string) ([]*grafana.Datasource, error) {
+	args := m.Called(dsType)
+	return args.Get(0).([]*grafana.Datasource), args.Error(1)
+}
+
+func (m *MockStackClient) GetDataSourceByUID(uid string) (*grafana.Datasource, error) {
+	args := m.Called(uid)
+	return args.Get(0).(*grafana.Datasource), args.Error(1)
+}
+
+func (m *MockStackClient) CreateDataSource(datasource *grafana.Datasource, secureJSONData map[string]string) (*grafana.Datasource, error) {
+	args := m.Called(datasource, secureJSONData)
+	return args.Get(0).(*grafana.Datasource), args.Error(1)
+}
+
+func (m *MockStackClient) UpdateDataSource(datasource *grafana.Datasource, secureJSONData map[string]string) (*grafana.Datasource, error) {
+	args := m.Called(datasource, secureJSONData)
+	return args.Get(0).(*grafana.Datasource), args.Error(1)
+}
+
+func (m *MockStackClient) DeleteDataSource(uid string) error {
+	args := m.Called(uid)
+	return args.Error(0)
+}
+
+func (m *MockStackClient) CheckDataSourceHealth(uid string) (*grafana.DatasourceHealth, error) {
+	args := m.Called(uid)
+	return args.Get(0).(*grafana.DatasourceHealth), args.Error(1)
+}
+
+func (m *MockStackClient) GetFolderPermissions(folderUID string) ([]*grafana.FolderPermission, error) {
+	args := m.Called(folderUID)
+	return args.Get(0).([]*grafana.FolderPermission), args.Error(1)
+}
+
+func (m *MockStackClient) SetFolderPermissions(folderUID string, permissions []*grafana.FolderPermission) error {
+	args := m.Called(folderUID, permissions)
+	return args.Error(0)
+}
+
+func (m *MockStackClient) ListTeams() ([]*grafana.Team, error) {
+	args := m.Called()
+	return args.Get(0).([]*grafana.Team), args.Error(1)
+}
+
+func (m *MockStackClient) GetTeamByName(name string) (*grafana.Team, error) {
+	args := m.Called(name)
+	return args.Get(0).(*grafana.Team), args.Error(1)
+}
+
+func (m *MockStackClient) CreateTeam(name, email string) (*grafana.Team, error) {
+	args := m.Called(name, email)
+	return args.Get(0).(*grafana.Team), args.Error(1)
+}
+
+func (m *MockStackClient) UpdateTeam(team *grafana.Team) error {
+	args := m.Called(team)
+	return args.Error(0)
+}
+
+func (m *MockStackClient) DeleteTeam(teamID int64) error {
+	args := m.Called(teamID)
+	return args.Error(0)
+}
+
+func (m *MockStackClient) ListTeamMembers(teamID int64) ([]*grafana.TeamMember, error) {
+	args := m.Called(teamID)
+	return args.Get(0).([]*grafana.TeamMember), args.Error(1)
+}
+
+func (m *MockStackClient) AddTeamMember(teamID int64, loginOrEmail string) error {
+	args := m.Called(teamID, loginOrEmail)
+	return args.Error(0)
+}
+
+func (m *MockStackClient) RemoveTeamMember(teamID int64, loginOrEmail string) error {
+	args := m.Called(teamID, loginOrEmail)
+	return args.Error(0)
+}
+
+func (m *MockStackClient) ListUsers() ([]*grafana.User, error) {
+	args := m.Called()
+	return args.Get(0).([]*grafana.User), args.Error(1)
+}
+
+func (m *MockStackClient) EnsureFolderPath(path string) (*grafana.Folder, error) {
+	args := m.Called(path)
+	return args.Get(0).(*grafana.Folder), args.Error(1)
+}
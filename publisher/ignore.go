@@ -0,0 +1,233 @@
+package publisher
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// ignoreFileName is the name of the file listing, with the gitignore syntax,
+// the files of a local folder the publisher must not process.
+const ignoreFileName = ".publisherignore"
+
+// UnknownFilesMode defines how files which are neither dashboards nor
+// tombstones are handled when synchronizing a local folder.
+type UnknownFilesMode string
+
+const (
+	// UnknownFilesFail aborts the synchronization. This is the default.
+	UnknownFilesFail UnknownFilesMode = "fail"
+	// UnknownFilesWarn logs the unknown files and skips them.
+	UnknownFilesWarn UnknownFilesMode = "warn"
+	// UnknownFilesIgnore silently skips the unknown files.
+	UnknownFilesIgnore UnknownFilesMode = "ignore"
+)
+
+// pathPattern is a compiled gitignore-like pattern.
+type pathPattern struct {
+	regexp  *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// match reports whether the pattern matches a slash separated path, or one
+// of its parent directories.
+func (p pathPattern) match(path string, isDir bool) bool {
+	submatches := p.regexp.FindStringSubmatch(path)
+	if submatches == nil {
+		return false
+	}
+	// The last group captures the part of the path below the matched directory.
+	below := submatches[len(submatches)-1]
+	return below != "" || isDir || !p.dirOnly
+}
+
+// compilePathPattern converts a gitignore pattern to a pathPattern.
+// Patterns containing a slash are anchored to the local folder, others match
+// at any depth. A trailing slash only matches directories.
+func compilePathPattern(pattern string) (pathPattern, error) {
+	result := pathPattern{}
+
+	if strings.HasPrefix(pattern, "!") {
+		result.negate = true
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		result.dirOnly = true
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+
+	prefix := "^(?:.*/)?"
+	if strings.Contains(pattern, "/") {
+		prefix = "^"
+		pattern = strings.TrimPrefix(pattern, "/")
+	}
+
+	expr := &strings.Builder{}
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "/**") && i+3 == len(pattern):
+			expr.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				expr.WriteString(regexp.QuoteMeta(string(c)))
+				continue
+			}
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + class + "]")
+			i += end
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			expr.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	compiled, err := regexp.Compile(prefix + expr.String() + "(/.*)?$")
+	if err != nil {
+		return result, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+	}
+	result.regexp = compiled
+	return result, nil
+}
+
+// pathPatterns is an ordered list of patterns where the last matching one wins.
+type pathPatterns []pathPattern
+
+func compilePathPatterns(patterns []string) (pathPatterns, error) {
+	compiled := pathPatterns{}
+	for _, pattern := range patterns {
+		p, err := compilePathPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, p)
+	}
+	return compiled, nil
+}
+
+// matches reports whether the path is selected by the patterns.
+func (patterns pathPatterns) matches(path string, isDir bool) bool {
+	matched := false
+	for _, pattern := range patterns {
+		if pattern.match(path, isDir) {
+			matched = !pattern.negate
+		}
+	}
+	return matched
+}
+
+// readIgnoreFile parses the .publisherignore file of a local folder, if any.
+func readIgnoreFile(fsys afero.Fs, localFolder string) (pathPatterns, error) {
+	path := filepath.Join(localFolder, ignoreFileName)
+
+	data, err := afero.ReadFile(fsys, path)
+	if os.IsNotExist(err) {
+		return pathPatterns{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	lines := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	patterns, err := compilePathPatterns(lines)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return patterns, nil
+}
+
+// walkDashboardFiles walks the files of the local folder of a reference,
+// skipping the ones ignored by its .publisherignore file or not selected by
+// its Include and Exclude patterns.
+func walkDashboardFiles(reference DashboardReference, fn func(path string, info os.FileInfo) error) error {
+	ignored, err := readIgnoreFile(reference.fileSystem(), reference.LocalFolder)
+	if err != nil {
+		return err
+	}
+
+	excluded, err := compilePathPatterns(reference.Exclude)
+	if err != nil {
+		return fmt.Errorf("invalid exclude patterns: %w", err)
+	}
+
+	included, err := compilePathPatterns(reference.Include)
+	if err != nil {
+		return fmt.Errorf("invalid include patterns: %w", err)
+	}
+
+	return afero.Walk(reference.fileSystem(), reference.LocalFolder, func(path string, info os.FileInfo, err error) error {
+
+		if err != nil {
+			return err
+		}
+
+		if info == nil {
+			return errors.New("nil info handler for path: " + path)
+		}
+
+		rel, err := filepath.Rel(reference.LocalFolder, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if rel == "." {
+			return nil
+		}
+
+		if ignored.matches(rel, info.IsDir()) || excluded.matches(rel, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		if rel == ignoreFileName {
+			return nil
+		}
+
+		if len(included) > 0 && !included.matches(rel, false) {
+			return nil
+		}
+
+		return fn(path, info)
+	})
+}
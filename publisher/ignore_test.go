@@ -0,0 +1,122 @@
+package publisher
+
+import (
+	"os"
+	"testing"
+
+	grafana "github.com/adevinta/go-grafana-toolkit/client"
+	system "github.com/adevinta/go-system-toolkit"
+	testutils "github.com/adevinta/go-testutils-toolkit"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathPatterns(t *testing.T) {
+	for _, tc := range []struct {
+		patterns []string
+		path     string
+		isDir    bool
+		expected bool
+	}{
+		{patterns: []string{"*.md"}, path: "README.md", expected: true},
+		{patterns: []string{"*.md"}, path: "team/README.md", expected: true},
+		{patterns: []string{"/*.md"}, path: "team/README.md", expected: false},
+		{patterns: []string{"team/*.json"}, path: "team/dash.json", expected: true},
+		{patterns: []string{"team/*.json"}, path: "other/team/dash.json", expected: false},
+		{patterns: []string{"**/drafts/*.json"}, path: "a/b/drafts/dash.json", expected: true},
+		{patterns: []string{"drafts/**"}, path: "drafts/a/dash.json", expected: true},
+		{patterns: []string{"drafts/"}, path: "drafts", isDir: true, expected: true},
+		{patterns: []string{"drafts/"}, path: "drafts", isDir: false, expected: false},
+		{patterns: []string{"drafts/"}, path: "drafts/dash.json", expected: true},
+		{patterns: []string{"dash-?.json"}, path: "dash-1.json", expected: true},
+		{patterns: []string{"dash-[!0-9].json"}, path: "dash-1.json", expected: false},
+		{patterns: []string{"*.patch", "!keep.patch"}, path: "keep.patch", expected: false},
+		{patterns: []string{"*.patch", "!keep.patch"}, path: "drop.patch", expected: true},
+	} {
+		patterns, err := compilePathPatterns(tc.patterns)
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, patterns.matches(tc.path, tc.isDir), "%v matching %s", tc.patterns, tc.path)
+	}
+}
+
+func TestPublishSkipsIgnoredFiles(t *testing.T) {
+	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+
+	system.DefaultFileSystem = afero.NewMemMapFs()
+	defer func() { system.DefaultFileSystem = afero.NewOsFs() }()
+
+	require.NoError(t, system.DefaultFileSystem.MkdirAll("/local_folder_1/drafts", 0777))
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/.publisherignore", "# documentation\n*.md\n\ndrafts/\n")
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/README.md", "not a dashboard")
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/drafts/draft.json", `{"dashboard": {"uid": "draft", "title": "Draft"}}`)
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/dashboard.json", `{"dashboard": {"uid": "dash-1", "title": "Dashboard"}}`)
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/excluded.json", `{"dashboard": {"uid": "excluded", "title": "Excluded"}}`)
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/dashboard.patch", `not a dashboard`)
+
+	setup := func(unknownFiles UnknownFilesMode) (*Publisher, *MockCloudClient, *MockStackClient) {
+		cloudClient := new(MockCloudClient)
+		testStackClient := new(MockStackClient)
+
+		cloudClient.
+			On("ListStacks").
+			Return(grafana.Stacks{testStack}, nil).
+			Once()
+		cloudClient.
+			On("NewStackClient", &testStack).
+			Return(testStackClient, nil)
+
+		testStackClient.
+			On("EnsureFolder", nilFolder, "Common").
+			Return(commonFolder, nil)
+		testStackClient.On("Cleanup").Return(nil)
+
+		pub, err := NewPublisher(
+			WithCloudClient(cloudClient),
+			WithConfig(&PublisherConfig{
+				CommonDashboards: DashboardReferences{{
+					LocalFolder:   "/local_folder_1",
+					GrafanaFolder: "Common",
+					Exclude:       []string{"excluded.json"},
+				}},
+				TestStack:    "test-stack",
+				UnknownFiles: unknownFiles,
+			}),
+		)
+		require.NoError(t, err)
+
+		return pub, cloudClient, testStackClient
+	}
+
+	t.Run("skips ignored and excluded files and warns about unknown ones", func(t *testing.T) {
+		pub, cloudClient, testStackClient := setup(UnknownFilesWarn)
+
+		uploaded := []string{}
+		testStackClient.
+			On("UploadDashboard", mock.AnythingOfType("*client.Dashboard")).
+			Run(func(args mock.Arguments) {
+				uploaded = append(uploaded, args.Get(0).(*grafana.Dashboard).UID)
+			}).
+			Return(nil)
+
+		err := pub.Publish(true)
+		assert.NoError(t, err)
+
+		cloudClient.AssertExpectations(t)
+		testStackClient.AssertExpectations(t)
+
+		assert.Equal(t, []string{"dash-1"}, uploaded)
+	})
+
+	t.Run("fails on unknown files by default", func(t *testing.T) {
+		pub, _, _ := setup("")
+
+		// Retrying on a persistent error takes too long for a test, only
+		// check a single stack synchronization.
+		err := pub.syncDashboardsForStack(&testStack, nil, pub.config.CommonDashboards[0])
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "unsupported file extension .patch")
+	})
+}
@@ -0,0 +1,175 @@
+package publisher
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	grafana "github.com/adevinta/go-grafana-toolkit/client"
+)
+
+// InputsConfig resolves the __inputs of the dashboards exported with the
+// Grafana "Export for sharing externally" option.
+type InputsConfig struct {
+	// Datasources maps the plugin ID of datasource inputs, or the input name
+	// for a specific input, to a text/template rendering the name of the
+	// stack datasource to use, e.g. "grafanacloud-{{ .Slug }}-prom".
+	// The template data is the one of dashboard templates.
+	Datasources map[string]string `yaml:"datasources,omitempty"`
+
+	// Constants maps the name of constant inputs to their value. Constants
+	// which are not configured keep the value they were exported with.
+	Constants map[string]string `yaml:"constants,omitempty"`
+}
+
+// defaultInputDatasources binds the datasource inputs to the Grafana Cloud
+// provisioned datasources, as the supported datasource variables do.
+var defaultInputDatasources = map[string]string{
+	"prometheus": "grafanacloud-{{ .Slug }}-prom",
+	"loki":       "grafanacloud-{{ .Slug }}-logs",
+}
+
+// dashboardInput is an entry of the __inputs of a shared dashboard.
+type dashboardInput struct {
+	name     string
+	kind     string
+	pluginID string
+	value    string
+}
+
+// dashboardInputs returns the __inputs declared by a dashboard.
+func dashboardInputs(dash map[string]interface{}) []dashboardInput {
+	inputs := []dashboardInput{}
+	items, _ := dash["__inputs"].([]interface{})
+	for _, item := range items {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		input := dashboardInput{}
+		input.name, _ = entry["name"].(string)
+		input.kind, _ = entry["type"].(string)
+		input.pluginID, _ = entry["pluginId"].(string)
+		input.value, _ = entry["value"].(string)
+		if input.name != "" {
+			inputs = append(inputs, input)
+		}
+	}
+	return inputs
+}
+
+// inputDatasourceTemplate returns the datasource name template configured
+// for a datasource input.
+func (p Publisher) inputDatasourceTemplate(input dashboardInput) (string, bool) {
+	for _, key := range []string{input.name, input.pluginID} {
+		if tmpl, ok := p.config.Inputs.Datasources[key]; ok {
+			return tmpl, true
+		}
+	}
+	tmpl, ok := defaultInputDatasources[input.pluginID]
+	return tmpl, ok
+}
+
+// resolvedInput is the replacement of an input placeholder.
+type resolvedInput struct {
+	// value replaces the placeholder in strings.
+	value string
+	// uid replaces the placeholder in datasource uid fields.
+	uid string
+}
+
+// resolveInputs replaces the ${NAME} placeholders of the __inputs of a shared
+// dashboard: datasource inputs by the stack datasource their plugin maps to,
+// constants by their configured value. The __inputs are then removed, as
+// Grafana only expects them when importing a dashboard.
+func (p Publisher) resolveInputs(sc grafana.GrafanaStackClient, stack *grafana.Stack, dash map[string]interface{}) error {
+	inputs := dashboardInputs(dash)
+	delete(dash, "__inputs")
+	if len(inputs) == 0 {
+		return nil
+	}
+
+	resolved := map[string]resolvedInput{}
+	for _, input := range inputs {
+		switch input.kind {
+		case "datasource":
+			tmpl, ok := p.inputDatasourceTemplate(input)
+			if !ok {
+				return fmt.Errorf("no datasource configured for input %s of plugin %s", input.name, input.pluginID)
+			}
+			name, err := p.renderInputTemplate(input, tmpl, stack)
+			if err != nil {
+				return err
+			}
+			datasource, err := sc.GetDataSource(name)
+			if err != nil {
+				return fmt.Errorf("failed to get datasource %s for input %s: %w", name, input.name, err)
+			}
+			resolved[input.name] = resolvedInput{value: name, uid: datasource.UID}
+
+		case "constant":
+			value, ok := p.config.Inputs.Constants[input.name]
+			if !ok {
+				value = input.value
+			}
+			resolved[input.name] = resolvedInput{value: value, uid: value}
+
+		default:
+			return fmt.Errorf("unsupported input %s of type %s", input.name, input.kind)
+		}
+	}
+
+	for key, value := range dash {
+		dash[key] = replaceInputs(value, key, resolved)
+	}
+	return nil
+}
+
+func (p Publisher) renderInputTemplate(input dashboardInput, text string, stack *grafana.Stack) (string, error) {
+	tmpl, err := template.New(input.name).Option("missingkey=error").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid datasource template for input %s: %w", input.name, err)
+	}
+	buf := &bytes.Buffer{}
+	err = tmpl.Execute(buf, p.templateData(stack))
+	if err != nil {
+		return "", fmt.Errorf("failed to render datasource template for input %s: %w", input.name, err)
+	}
+	return buf.String(), nil
+}
+
+// replaceInputs replaces the input placeholders in a dashboard value.
+// Datasource references by uid get the datasource UID, other occurrences
+// the datasource name.
+func replaceInputs(value interface{}, key string, resolved map[string]resolvedInput) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			v[k] = replaceInputs(item, k, resolved)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = replaceInputs(item, key, resolved)
+		}
+	case string:
+		if !strings.Contains(v, "${") {
+			return v
+		}
+		names := make([]string, 0, len(resolved))
+		for name := range resolved {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			replacement := resolved[name].value
+			if key == "uid" {
+				replacement = resolved[name].uid
+			}
+			v = strings.ReplaceAll(v, "${"+name+"}", replacement)
+		}
+		return v
+	}
+	return value
+}
@@ -0,0 +1,154 @@
+package publisher
+
+import (
+	"os"
+	"testing"
+
+	grafana "github.com/adevinta/go-grafana-toolkit/client"
+	system "github.com/adevinta/go-system-toolkit"
+	testutils "github.com/adevinta/go-testutils-toolkit"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const sharedDashboard = `{
+	"dashboard": {
+		"__inputs": [
+			{"name": "DS_PROMETHEUS", "label": "Prometheus", "type": "datasource", "pluginId": "prometheus", "pluginName": "Prometheus"},
+			{"name": "DS_LOGS", "label": "Logs", "type": "datasource", "pluginId": "loki", "pluginName": "Loki"},
+			{"name": "VAR_ENV", "label": "Environment", "type": "constant", "value": "dev"},
+			{"name": "VAR_TEAM", "label": "Team", "type": "constant", "value": "platform"}
+		],
+		"__requires": [
+			{"type": "datasource", "id": "prometheus", "name": "Prometheus", "version": "1.0.0"}
+		],
+		"uid": "shared",
+		"title": "Shared Dashboard",
+		"panels": [
+			{
+				"title": "Requests in ${VAR_ENV}",
+				"datasource": {"type": "prometheus", "uid": "${DS_PROMETHEUS}"},
+				"targets": [{"datasource": {"type": "prometheus", "uid": "${DS_PROMETHEUS}"}, "expr": "sum(rate(requests_total{team=\"${VAR_TEAM}\"}[5m]))"}]
+			},
+			{
+				"title": "Logs",
+				"datasource": "${DS_LOGS}"
+			}
+		]
+	}
+}`
+
+func TestPublishResolvesSharedDashboardInputs(t *testing.T) {
+	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+
+	system.DefaultFileSystem = afero.NewMemMapFs()
+	defer func() { system.DefaultFileSystem = afero.NewOsFs() }()
+
+	require.NoError(t, system.DefaultFileSystem.MkdirAll("/local_folder_1", 0777))
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/shared.json", sharedDashboard)
+
+	cloudClient := new(MockCloudClient)
+	testStackClient := new(MockStackClient)
+
+	cloudClient.
+		On("ListStacks").
+		Return(grafana.Stacks{testStack}, nil).
+		Once()
+	cloudClient.
+		On("NewStackClient", &testStack).
+		Return(testStackClient, nil)
+
+	testStackClient.
+		On("EnsureFolder", nilFolder, "Common").
+		Return(commonFolder, nil)
+	testStackClient.
+		On("GetDataSource", "grafanacloud-test-stack-prom").
+		Return(&grafana.Datasource{Name: "grafanacloud-test-stack-prom", UID: "prom-uid"}, nil)
+	testStackClient.
+		On("GetDataSource", "test-stack-eu-west-1-logs").
+		Return(&grafana.Datasource{Name: "test-stack-eu-west-1-logs", UID: "logs-uid"}, nil)
+	testStackClient.
+		On("UploadDashboard", mock.AnythingOfType("*client.Dashboard")).
+		Run(func(args mock.Arguments) {
+			dashboard := args.Get(0).(*grafana.Dashboard)
+			assert.Equal(t, map[string]interface{}{
+				"uid":       "shared",
+				"title":     "Shared Dashboard",
+				"folderUid": "common-folder-uid",
+				"panels": []interface{}{
+					map[string]interface{}{
+						"title":      "Requests in production",
+						"datasource": map[string]interface{}{"type": "prometheus", "uid": "prom-uid"},
+						"targets": []interface{}{
+							map[string]interface{}{
+								"datasource": map[string]interface{}{"type": "prometheus", "uid": "prom-uid"},
+								"expr":       "sum(rate(requests_total{team=\"platform\"}[5m]))",
+							},
+						},
+					},
+					map[string]interface{}{
+						"title":      "Logs",
+						"datasource": "test-stack-eu-west-1-logs",
+					},
+				},
+			}, dashboard.Dashboard)
+		}).
+		Return(nil).
+		Once()
+	testStackClient.On("Cleanup").Return(nil)
+
+	pub, err := NewPublisher(
+		WithCloudClient(cloudClient),
+		WithConfig(&PublisherConfig{
+			CommonDashboards: DashboardReferences{{LocalFolder: "/local_folder_1", GrafanaFolder: "Common"}},
+			TestStack:        "test-stack",
+			StackVariables: map[string]map[string]interface{}{
+				"test-stack": {"region": "eu-west-1"},
+			},
+			Inputs: InputsConfig{
+				Datasources: map[string]string{
+					"DS_LOGS": "{{ .Slug }}-{{ .Vars.region }}-logs",
+				},
+				Constants: map[string]string{
+					"VAR_ENV": "production",
+				},
+			},
+		}),
+	)
+	require.NoError(t, err)
+
+	err = pub.Publish(true)
+	assert.NoError(t, err)
+
+	cloudClient.AssertExpectations(t)
+	testStackClient.AssertExpectations(t)
+}
+
+func TestLintReportsUnmappedDatasourceInputs(t *testing.T) {
+	system.DefaultFileSystem = afero.NewMemMapFs()
+	defer func() { system.DefaultFileSystem = afero.NewOsFs() }()
+
+	require.NoError(t, system.DefaultFileSystem.MkdirAll("/local_folder_1", 0777))
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/shared.json", `{
+		"dashboard": {
+			"__inputs": [{"name": "DS_TEMPO", "type": "datasource", "pluginId": "tempo"}],
+			"uid": "shared",
+			"title": "Shared Dashboard",
+			"panels": [{"datasource": {"uid": "${DS_TEMPO}"}, "title": "Traces"}]
+		}
+	}`)
+
+	pub, err := NewPublisher(WithConfig(&PublisherConfig{
+		CommonDashboards: DashboardReferences{{LocalFolder: "/local_folder_1", GrafanaFolder: "Common"}},
+	}))
+	require.NoError(t, err)
+
+	issues, err := pub.Lint()
+	require.NoError(t, err)
+	assert.Equal(t, LintIssues{
+		{Path: "/local_folder_1/shared.json", Severity: LintError, Message: "no datasource configured for input DS_TEMPO of plugin tempo"},
+	}, issues)
+}
@@ -0,0 +1,209 @@
+package publisher
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	grafana "github.com/adevinta/go-grafana-toolkit/client"
+	log "github.com/adevinta/go-log-toolkit"
+	"github.com/spf13/afero"
+)
+
+// libraryPanelFile is the content of a library panel file, as returned by
+// the Grafana library elements API.
+type libraryPanelFile struct {
+	UID   string                 `json:"uid"`
+	Name  string                 `json:"name"`
+	Model map[string]interface{} `json:"model"`
+	// Title identifies the library panel a tombstone deletes when it has
+	// neither uid nor name, as the title of dashboard tombstones does.
+	Title string `json:"title,omitempty"`
+}
+
+// readLibraryPanelFile reads a library panel, or the tombstone of a deleted
+// library panel, rendered for the given stack.
+// The name of the library panel defaults to the title of its model, or to
+// the title of a tombstone.
+func (p Publisher) readLibraryPanelFile(fsys afero.Fs, path string, stack *grafana.Stack) (*libraryPanelFile, error) {
+	data, err := p.readStackDashboardSource(fsys, path, stack)
+	if err != nil {
+		return nil, err
+	}
+
+	panel := &libraryPanelFile{}
+	err = json.Unmarshal(data, panel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode library panel %s: %w", path, err)
+	}
+
+	if panel.Name == "" {
+		panel.Name, _ = panel.Model["title"].(string)
+	}
+	if panel.Name == "" {
+		panel.Name = panel.Title
+	}
+	return panel, nil
+}
+
+// syncLibraryPanels publishes the library panels of a reference to the given
+// stacks, so that the dashboards referencing them can be uploaded.
+// The UIDs of the published library panels are recorded in
+// p.libraryPanelUIDs so that dashboard references follow the IDSuffix.
+func (p Publisher) syncLibraryPanels(grafanaStacks grafana.Stacks, parentFolders map[string]*grafana.Folder, reference DashboardReference) error {
+	log.DefaultLogger.WithField("localFolder", reference.LocalFolder).WithField("grafanaFolder", reference.GrafanaFolder).Println("Syncing library panels...")
+
+	_, err := reference.fileSystem().Stat(reference.LocalFolder)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("Failed to discover %s: %w", reference.LocalFolder, err)
+		}
+		log.DefaultLogger.WithField("localFolder", reference.LocalFolder).Info("Local folder not present, skipping sync.")
+		return nil
+	}
+
+	for _, stack := range grafanaStacks {
+		err := p.syncLibraryPanelsForStack(&stack, parentFolders[stack.Slug], reference)
+		if err != nil {
+			return fmt.Errorf("failed to sync library panels for stack %s: %w", stack.Slug, err)
+		}
+	}
+	return nil
+}
+
+// syncLibraryPanelsForStack creates or updates the library panels of a
+// reference in a single stack, and deletes the ones with a tombstone.
+func (p Publisher) syncLibraryPanelsForStack(stack *grafana.Stack, parentFolder *grafana.Folder, reference DashboardReference) error {
+	sc, err := p.stackClient(stack)
+	if err != nil {
+		return fmt.Errorf("failed to get grafana stack client for stack %v, error: %w", stack.Slug, err)
+	}
+
+	folder, err := sc.EnsureFolder(parentFolder, reference.GrafanaFolder)
+	if err != nil {
+		return fmt.Errorf("could not ensure folder %s: %w", reference.GrafanaFolder, err)
+	}
+
+	err = enforceFolderPermissions(sc, folder, reference.Permissions)
+	if err != nil {
+		return err
+	}
+
+	subfolders := map[string]*grafana.Folder{".": folder}
+
+	return walkDashboardFiles(reference, func(path string, info os.FileInfo) error {
+		switch filepath.Ext(p.renderedPath(path)) {
+		case ".json", ".yaml", ".yml":
+			log.DefaultLogger.WithField("libraryPanel", path).WithField("destination", stack.Slug).Println("Syncing library panel")
+
+			panel, err := p.readLibraryPanelFile(reference.fileSystem(), path, stack)
+			if err != nil {
+				return err
+			}
+			if panel.Model == nil {
+				return fmt.Errorf("unable to find library panel model in %s", path)
+			}
+
+			uid, err := p.publishedUID(panel.UID, panel.Name)
+			if err != nil {
+				return fmt.Errorf("unable to find library panel name in %s", path)
+			}
+			if panel.UID != "" {
+				p.libraryPanelUIDs[panel.UID] = struct{}{}
+			}
+
+			folder := folder
+			if reference.NestedFolders {
+				dir, err := filepath.Rel(reference.LocalFolder, filepath.Dir(path))
+				if err != nil {
+					return err
+				}
+				folder, err = ensureSubfolder(sc, subfolders, dir)
+				if err != nil {
+					return err
+				}
+			}
+
+			return sc.UploadLibraryPanel(&grafana.LibraryPanel{
+				UID:       uid,
+				Name:      panel.Name,
+				FolderUID: folder.UID,
+				Model:     panel.Model,
+			})
+
+		case ".deleted":
+			log.DefaultLogger.WithField("libraryPanel", path).WithField("destination", stack.Slug).Println("Deleting library panel")
+
+			panel, err := p.readLibraryPanelFile(reference.fileSystem(), path, stack)
+			if err != nil {
+				return err
+			}
+			uid, err := p.publishedUID(panel.UID, panel.Name)
+			if err != nil {
+				return fmt.Errorf("unable to find library panel uid or title in %s", path)
+			}
+
+			existing, err := sc.GetLibraryPanel(uid)
+			if err != nil {
+				return err
+			}
+			if existing != nil {
+				return sc.DeleteLibraryPanel(uid)
+			}
+			return nil
+
+		default:
+			switch p.config.UnknownFiles {
+			case UnknownFilesIgnore:
+			case UnknownFilesWarn:
+				log.DefaultLogger.WithField("file", path).WithField("destination", stack.Slug).Warn("Skipping file with unsupported extension")
+			default:
+				return fmt.Errorf("unsupported file extension %s for path %v", filepath.Ext(path), path)
+			}
+		}
+		return nil
+	})
+}
+
+// indexLocalLibraryPanels returns the local UIDs of the library panels by
+// the UID they are published with on a stack.
+func (p Publisher) indexLocalLibraryPanels(stack *grafana.Stack) (map[string]string, error) {
+	localUIDs := map[string]string{}
+	err := p.walkLocalFiles(p.config.LibraryPanels, func(reference DashboardReference, path string) error {
+		panel, err := p.readLibraryPanelFile(reference.fileSystem(), path, stack)
+		if err != nil {
+			return err
+		}
+		// Only the library panels with a uid are bound by dashboards.
+		if panel.UID == "" {
+			return nil
+		}
+		uid, err := p.publishedUID(panel.UID, panel.Name)
+		if err != nil {
+			return err
+		}
+		localUIDs[uid] = panel.UID
+		return nil
+	})
+	return localUIDs, err
+}
+
+// bindLibraryPanels points the library panel instances of a dashboard to the
+// UIDs the local library panels are published with.
+func (p Publisher) bindLibraryPanels(dash *grafana.DashboardModel) error {
+	for _, panel := range dash.AllPanels() {
+		if panel.LibraryPanel == nil {
+			continue
+		}
+		if _, ok := p.libraryPanelUIDs[panel.LibraryPanel.UID]; !ok {
+			continue
+		}
+		uid, err := p.publishedUID(panel.LibraryPanel.UID, panel.LibraryPanel.Name)
+		if err != nil {
+			return err
+		}
+		panel.LibraryPanel.UID = uid
+	}
+	return nil
+}
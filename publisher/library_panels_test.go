@@ -0,0 +1,125 @@
+package publisher
+
+import (
+	"os"
+	"testing"
+
+	grafana "github.com/adevinta/go-grafana-toolkit/client"
+	system "github.com/adevinta/go-system-toolkit"
+	testutils "github.com/adevinta/go-testutils-toolkit"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublishLibraryPanelsBeforeDashboards(t *testing.T) {
+	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+
+	system.DefaultFileSystem = afero.NewMemMapFs()
+	defer func() { system.DefaultFileSystem = afero.NewOsFs() }()
+
+	require.NoError(t, system.DefaultFileSystem.MkdirAll("/library_panels", 0777))
+	require.NoError(t, system.DefaultFileSystem.MkdirAll("/local_folder_1", 0777))
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/library_panels/errors.yaml", `
+uid: errors
+model:
+  title: Errors
+  type: timeseries
+  datasource: ${PROMPRO}
+`)
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/library_panels/removed.json.deleted", `{"uid": "removed"}`)
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/library_panels/legacy.json.deleted", `{"title": "Legacy"}`)
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/dashboard.json", `{
+		"dashboard": {
+			"uid": "dash-1",
+			"title": "Dashboard",
+			"panels": [
+				{"id": 1, "libraryPanel": {"uid": "errors", "name": "Errors"}},
+				{"id": 2, "libraryPanel": {"uid": "external", "name": "External"}}
+			]
+		}
+	}`)
+
+	cloudClient := new(MockCloudClient)
+	testStackClient := new(MockStackClient)
+	libraryPanelsFolder := &grafana.Folder{UID: "library-panels-folder-uid", Title: "Library Panels"}
+
+	cloudClient.
+		On("ListStacks").
+		Return(grafana.Stacks{testStack}, nil).
+		Once()
+	cloudClient.
+		On("NewStackClient", &testStack).
+		Return(testStackClient, nil)
+
+	uploaded := false
+	testStackClient.
+		On("EnsureFolderPath", "root").
+		Return(rootFolder, nil)
+	testStackClient.
+		On("EnsureFolder", rootFolder, "Library Panels").
+		Return(libraryPanelsFolder, nil)
+	testStackClient.
+		On("EnsureFolder", rootFolder, "Common").
+		Return(commonFolder, nil)
+	testStackClient.
+		On("UploadLibraryPanel", &grafana.LibraryPanel{
+			UID:       "errors-pr-1",
+			Name:      "Errors",
+			FolderUID: "library-panels-folder-uid",
+			Model:     map[string]interface{}{"title": "Errors", "type": "timeseries", "datasource": "${PROMPRO}"},
+		}).
+		Run(func(mock.Arguments) { uploaded = true }).
+		Return(nil).
+		Once()
+	testStackClient.
+		On("GetLibraryPanel", "removed-pr-1").
+		Return(&grafana.LibraryPanel{UID: "removed-pr-1"}, nil)
+	testStackClient.
+		On("DeleteLibraryPanel", "removed-pr-1").
+		Return(nil).
+		Once()
+	// Tombstones with a title only delete the library panel whose UID is
+	// derived from it.
+	legacyUID := GenerateUniqueID(GenerateUniqueID("Legacy") + "-pr-1")
+	testStackClient.
+		On("GetLibraryPanel", legacyUID).
+		Return(&grafana.LibraryPanel{UID: legacyUID}, nil)
+	testStackClient.
+		On("DeleteLibraryPanel", legacyUID).
+		Return(nil).
+		Once()
+	testStackClient.
+		On("UploadDashboard", mock.AnythingOfType("*client.Dashboard")).
+		Run(func(args mock.Arguments) {
+			assert.True(t, uploaded, "library panels should be published before dashboards")
+			dashboard := args.Get(0).(*grafana.Dashboard)
+			assert.Equal(t, []interface{}{
+				map[string]interface{}{"id": float64(1), "libraryPanel": map[string]interface{}{"uid": "errors-pr-1", "name": "Errors"}},
+				map[string]interface{}{"id": float64(2), "libraryPanel": map[string]interface{}{"uid": "external", "name": "External"}},
+			}, dashboard.Dashboard.(map[string]interface{})["panels"])
+		}).
+		Return(nil).
+		Once()
+	testStackClient.On("Cleanup").Return(nil)
+
+	pub, err := NewPublisher(
+		WithCloudClient(cloudClient),
+		WithConfig(&PublisherConfig{
+			LibraryPanels:    DashboardReferences{{LocalFolder: "/library_panels", GrafanaFolder: "Library Panels"}},
+			CommonDashboards: DashboardReferences{{LocalFolder: "/local_folder_1", GrafanaFolder: "Common"}},
+			TestStack:        "test-stack",
+			RootFolder:       "root",
+			IDSuffix:         "-pr-1",
+		}),
+	)
+	require.NoError(t, err)
+
+	err = pub.Publish(false)
+	assert.NoError(t, err)
+
+	cloudClient.AssertExpectations(t)
+	testStackClient.AssertExpectations(t)
+}
@@ -0,0 +1,352 @@
+package publisher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// LintSeverity qualifies how a lint issue affects publishing.
+type LintSeverity string
+
+const (
+	// LintError issues abort publishing.
+	LintError LintSeverity = "error"
+	// LintWarning issues are reported but do not prevent publishing.
+	LintWarning LintSeverity = "warning"
+)
+
+// LintIssue describes a problem found in a local dashboard file.
+type LintIssue struct {
+	Path     string
+	Severity LintSeverity
+	Message  string
+}
+
+func (i LintIssue) Error() string {
+	return fmt.Sprintf("%s: %s", i.Path, i.Message)
+}
+
+// LintIssues is a collection of LintIssue.
+type LintIssues []LintIssue
+
+// Errors returns the issues which abort publishing.
+func (issues LintIssues) Errors() LintIssues {
+	return issues.withSeverity(LintError)
+}
+
+// Warnings returns the issues which are only reported.
+func (issues LintIssues) Warnings() LintIssues {
+	return issues.withSeverity(LintWarning)
+}
+
+func (issues LintIssues) withSeverity(severity LintSeverity) LintIssues {
+	filtered := LintIssues{}
+	for _, issue := range issues {
+		if issue.Severity == severity {
+			filtered = append(filtered, issue)
+		}
+	}
+	return filtered
+}
+
+// Err joins the issues as a single error, or returns nil when there is no issue.
+func (issues LintIssues) Err() error {
+	errs := make([]error, 0, len(issues))
+	for _, issue := range issues {
+		errs = append(errs, issue)
+	}
+	return errors.Join(errs...)
+}
+
+// builtinDatasources are the datasources shared by every Grafana instance,
+// which can safely be referenced by UID.
+var builtinDatasources = map[string]struct{}{
+	"grafana":         {},
+	"-- Grafana --":   {},
+	"-- Mixed --":     {},
+	"-- Dashboard --": {},
+	"dashboard":       {},
+	"__expr__":        {},
+}
+
+// builtinVariables are the global variables provided by Grafana, on top of
+// the ones prefixed with a double underscore.
+var builtinVariables = map[string]struct{}{
+	"interval":   {},
+	"timeFilter": {},
+}
+
+var variableReference = regexp.MustCompile(`\$\{([A-Za-z_]\w*)[^}]*\}|\[\[([A-Za-z_]\w*)[^\]]*\]\]|\$([A-Za-z_]\w*)`)
+
+// lintedDashboard keeps the details of a dashboard needed to compare it
+// with the other local dashboards.
+type lintedDashboard struct {
+	path          string
+	grafanaFolder string
+	// uid is the published UID, for dashboards and tombstones alike.
+	uid   string
+	title string
+}
+
+// Lint validates the local dashboard files of every configured reference
+// without calling any Grafana API.
+// It reports malformed dashboards, duplicated UIDs and titles, hard-coded
+// datasources, references to undefined template variables and tombstones of
+// dashboards still present.
+func (p Publisher) Lint() (LintIssues, error) {
+	issues := LintIssues{}
+	dashboards := []lintedDashboard{}
+	tombstones := []lintedDashboard{}
+
+	for _, reference := range append(append(DashboardReferences{}, p.config.CustomDashboards...), p.config.CommonDashboards...) {
+		if reference.LocalFolder == "" || reference.GrafanaFolder == "" {
+			continue
+		}
+
+		_, err := reference.fileSystem().Stat(reference.LocalFolder)
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		configPath := resolveConfigFilePath(p.configPath)
+		for _, deleted := range reference.Deleted {
+			uid, err := p.deletedDashboardUID(deleted)
+			if err != nil {
+				issues = append(issues, LintIssue{Path: configPath, Severity: LintError, Message: err.Error()})
+				continue
+			}
+			tombstones = append(tombstones, lintedDashboard{path: configPath, grafanaFolder: reference.GrafanaFolder, uid: uid})
+		}
+
+		err = walkDashboardFiles(reference, func(path string, info os.FileInfo) error {
+			ext := filepath.Ext(path)
+			if !isDashboardFile(path) && ext != ".deleted" {
+				return nil
+			}
+
+			data, err := afero.ReadFile(reference.fileSystem(), path)
+			if err != nil {
+				return err
+			}
+
+			data, err = dashboardSourceToJSON(path, data)
+			if err != nil {
+				issues = append(issues, LintIssue{Path: path, Severity: LintError, Message: err.Error()})
+				return nil
+			}
+
+			dashboard := map[string]interface{}{}
+			err = json.Unmarshal(data, &dashboard)
+			if err != nil {
+				issues = append(issues, LintIssue{Path: path, Severity: LintError, Message: fmt.Sprintf("invalid JSON: %v", err)})
+				return nil
+			}
+
+			if ext == ".deleted" {
+				dash, ok := tombstoneDashboard(dashboard)
+				if !ok {
+					issues = append(issues, LintIssue{Path: path, Severity: LintError, Message: "missing dashboard wrapper"})
+					return nil
+				}
+				uid, err := p.dashboardUID(dash)
+				if err != nil {
+					issues = append(issues, LintIssue{Path: path, Severity: LintError, Message: "missing dashboard uid or title"})
+					return nil
+				}
+				tombstones = append(tombstones, lintedDashboard{path: path, grafanaFolder: reference.GrafanaFolder, uid: uid})
+				return nil
+			}
+
+			dash, ok := dashboard["dashboard"].(map[string]interface{})
+			if !ok {
+				issues = append(issues, LintIssue{Path: path, Severity: LintError, Message: "missing dashboard wrapper"})
+				return nil
+			}
+
+			issues = append(issues, p.lintDashboard(path, dash)...)
+
+			title, _ := dash["title"].(string)
+			uid, err := p.dashboardUID(dash)
+			if err != nil {
+				return nil
+			}
+			dashboards = append(dashboards, lintedDashboard{path: path, grafanaFolder: reference.GrafanaFolder, uid: uid, title: title})
+			return nil
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	issues = append(issues, lintDuplicates(dashboards, tombstones)...)
+
+	return issues, nil
+}
+
+// lintDashboard validates the content of a single dashboard.
+func (p Publisher) lintDashboard(path string, dash map[string]interface{}) LintIssues {
+	issues := LintIssues{}
+
+	if title, ok := dash["title"].(string); !ok || title == "" {
+		issues = append(issues, LintIssue{Path: path, Severity: LintError, Message: "missing dashboard title"})
+	}
+
+	if uid, ok := dash["uid"].(string); ok && len(uid) > 40 {
+		issues = append(issues, LintIssue{Path: path, Severity: LintWarning, Message: fmt.Sprintf("uid %s is longer than 40 characters and will be hashed", uid)})
+	}
+
+	variables := map[string]struct{}{}
+	if templating, ok := dash["templating"].(map[string]interface{}); ok {
+		parameters, _ := templating["list"].([]interface{})
+		for _, param := range parameters {
+			if parameter, ok := param.(map[string]interface{}); ok {
+				if name, ok := parameter["name"].(string); ok {
+					variables[name] = struct{}{}
+				}
+			}
+		}
+	}
+
+	for _, input := range dashboardInputs(dash) {
+		variables[input.name] = struct{}{}
+		if _, ok := p.inputDatasourceTemplate(input); input.kind == "datasource" && !ok {
+			issues = append(issues, LintIssue{Path: path, Severity: LintError, Message: fmt.Sprintf("no datasource configured for input %s of plugin %s", input.name, input.pluginID)})
+		}
+	}
+
+	hardcoded := map[string]struct{}{}
+	undefined := map[string]struct{}{}
+	for _, key := range []string{"panels", "rows", "annotations", "templating"} {
+		collectHardcodedDatasources(dash[key], hardcoded)
+	}
+	for _, key := range []string{"panels", "rows"} {
+		collectUndefinedVariables(dash[key], variables, undefined)
+	}
+
+	for _, datasource := range sortedKeys(hardcoded) {
+		issues = append(issues, LintIssue{Path: path, Severity: LintWarning, Message: fmt.Sprintf("hard-coded datasource %s, use one of the supported datasource variables instead", datasource)})
+	}
+	for _, variable := range sortedKeys(undefined) {
+		issues = append(issues, LintIssue{Path: path, Severity: LintWarning, Message: fmt.Sprintf("reference to undefined template variable %s", variable)})
+	}
+
+	return issues
+}
+
+// lintDuplicates reports dashboards sharing a UID or a title, and tombstones
+// of dashboards which are still present.
+func lintDuplicates(dashboards, tombstones []lintedDashboard) LintIssues {
+	issues := LintIssues{}
+	byUID := map[string]lintedDashboard{}
+	byTitle := map[string]lintedDashboard{}
+
+	for _, dashboard := range dashboards {
+		if other, ok := byUID[dashboard.uid]; ok {
+			issues = append(issues, LintIssue{Path: dashboard.path, Severity: LintError, Message: fmt.Sprintf("duplicate uid %s, also used by %s", dashboard.uid, other.path)})
+		} else {
+			byUID[dashboard.uid] = dashboard
+		}
+
+		if dashboard.title == "" {
+			continue
+		}
+		if other, ok := byTitle[dashboard.title]; ok {
+			// Grafana refuses dashboards with the same title in a folder.
+			severity := LintWarning
+			if other.grafanaFolder == dashboard.grafanaFolder {
+				severity = LintError
+			}
+			issues = append(issues, LintIssue{Path: dashboard.path, Severity: severity, Message: fmt.Sprintf("duplicate title %s, also used by %s", dashboard.title, other.path)})
+		} else {
+			byTitle[dashboard.title] = dashboard
+		}
+	}
+
+	for _, tombstone := range tombstones {
+		for _, dashboard := range dashboards {
+			if dashboard.uid == tombstone.uid {
+				issues = append(issues, LintIssue{Path: tombstone.path, Severity: LintError, Message: fmt.Sprintf("deleted dashboard %s is still present in %s", tombstone.uid, dashboard.path)})
+			}
+		}
+	}
+
+	return issues
+}
+
+// collectHardcodedDatasources walks a dashboard section and collects the
+// datasources referenced without a template variable.
+func collectHardcodedDatasources(value interface{}, hardcoded map[string]struct{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if key != "datasource" {
+				collectHardcodedDatasources(item, hardcoded)
+				continue
+			}
+			var reference string
+			switch datasource := item.(type) {
+			case string:
+				reference = datasource
+			case map[string]interface{}:
+				reference, _ = datasource["uid"].(string)
+			}
+			if reference == "" || strings.HasPrefix(reference, "$") {
+				continue
+			}
+			if _, ok := builtinDatasources[reference]; ok {
+				continue
+			}
+			hardcoded[reference] = struct{}{}
+		}
+	case []interface{}:
+		for _, item := range v {
+			collectHardcodedDatasources(item, hardcoded)
+		}
+	}
+}
+
+// collectUndefinedVariables walks a dashboard section and collects the
+// template variables referenced but not defined.
+func collectUndefinedVariables(value interface{}, variables, undefined map[string]struct{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, item := range v {
+			collectUndefinedVariables(item, variables, undefined)
+		}
+	case []interface{}:
+		for _, item := range v {
+			collectUndefinedVariables(item, variables, undefined)
+		}
+	case string:
+		for _, match := range variableReference.FindAllStringSubmatch(v, -1) {
+			name := match[1] + match[2] + match[3]
+			if strings.HasPrefix(name, "__") {
+				continue
+			}
+			if _, ok := builtinVariables[name]; ok {
+				continue
+			}
+			if _, ok := variables[name]; !ok {
+				undefined[name] = struct{}{}
+			}
+		}
+	}
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
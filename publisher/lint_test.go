@@ -0,0 +1,118 @@
+package publisher
+
+import (
+	"os"
+	"testing"
+
+	system "github.com/adevinta/go-system-toolkit"
+	testutils "github.com/adevinta/go-testutils-toolkit"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLint(t *testing.T) {
+	system.DefaultFileSystem = afero.NewMemMapFs()
+	defer func() { system.DefaultFileSystem = afero.NewOsFs() }()
+
+	require.NoError(t, system.DefaultFileSystem.MkdirAll("/local_folder_1", 0777))
+	require.NoError(t, system.DefaultFileSystem.MkdirAll("/local_folder_2", 0777))
+
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/valid.json", `{
+		"dashboard": {
+			"uid": "valid",
+			"title": "Valid",
+			"templating": {"list": [
+				{"type": "datasource", "name": "PROMPRO"},
+				{"type": "query", "name": "cluster", "datasource": {"type": "prometheus", "uid": "${PROMPRO}"}}
+			]},
+			"panels": [{
+				"title": "Requests in $cluster",
+				"datasource": {"type": "prometheus", "uid": "${PROMPRO}"},
+				"targets": [
+					{"expr": "rate(requests{cluster=\"$cluster\"}[$__rate_interval])", "legendFormat": "$1"},
+					{"datasource": {"type": "__expr__", "uid": "__expr__"}, "type": "reduce"}
+				]
+			}, {
+				"datasource": {"type": "datasource", "uid": "-- Dashboard --"}
+			}]
+		}
+	}`)
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/unwrapped.json", `{"uid": "unwrapped", "title": "Unwrapped"}`)
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/untitled.json", `{"dashboard": {"uid": "untitled"}}`)
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/long.json", `{"dashboard": {"uid": "a-very-long-dashboard-uid-that-gets-hashed", "title": "Long"}}`)
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/hardcoded.json", `{
+		"dashboard": {
+			"uid": "hardcoded",
+			"title": "Hardcoded",
+			"templating": {"list": [{"type": "query", "name": "namespace", "datasource": {"type": "loki", "uid": "grafanacloud-logs"}}]},
+			"panels": [{
+				"datasource": {"type": "prometheus", "uid": "grafanacloud-prom"},
+				"targets": [{"expr": "up{job=\"${job:regex}\"}"}]
+			}]
+		}
+	}`)
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/valid.json.deleted", `{"dashboard": {"uid": "valid"}}`)
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/anonymous.json.deleted", `{"dashboard": {}}`)
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/gone.deleted", `{"uid": "gone"}`)
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/README.md", `not a dashboard`)
+
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_2/duplicate.json", `{"dashboard": {"uid": "valid", "title": "Valid"}}`)
+
+	pub, err := NewPublisher(WithConfig(&PublisherConfig{
+		CommonDashboards: DashboardReferences{{LocalFolder: "/local_folder_1", GrafanaFolder: "Common"}},
+		CustomDashboards: DashboardReferences{{LocalFolder: "/local_folder_2", GrafanaFolder: "Custom", Deleted: []DeletedDashboard{{UID: "valid"}, {}}}},
+	}))
+	require.NoError(t, err)
+
+	issues, err := pub.Lint()
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, LintIssues{
+		{Path: "/local_folder_1/unwrapped.json", Severity: LintError, Message: "missing dashboard wrapper"},
+		{Path: "/local_folder_1/untitled.json", Severity: LintError, Message: "missing dashboard title"},
+		{Path: "/local_folder_1/valid.json", Severity: LintError, Message: "duplicate uid valid, also used by /local_folder_2/duplicate.json"},
+		{Path: "/local_folder_1/valid.json.deleted", Severity: LintError, Message: "deleted dashboard valid is still present in /local_folder_2/duplicate.json"},
+		{Path: "/local_folder_1/valid.json.deleted", Severity: LintError, Message: "deleted dashboard valid is still present in /local_folder_1/valid.json"},
+		{Path: "/local_folder_1/anonymous.json.deleted", Severity: LintError, Message: "missing dashboard uid or title"},
+		{Path: "publisher-config.yaml", Severity: LintError, Message: "deleted dashboard valid is still present in /local_folder_2/duplicate.json"},
+		{Path: "publisher-config.yaml", Severity: LintError, Message: "deleted dashboard valid is still present in /local_folder_1/valid.json"},
+		{Path: "publisher-config.yaml", Severity: LintError, Message: "unable to find dashboard uid or title in the deleted dashboards"},
+	}, issues.Errors())
+
+	assert.ElementsMatch(t, LintIssues{
+		{Path: "/local_folder_1/long.json", Severity: LintWarning, Message: "uid a-very-long-dashboard-uid-that-gets-hashed is longer than 40 characters and will be hashed"},
+		{Path: "/local_folder_1/hardcoded.json", Severity: LintWarning, Message: "hard-coded datasource grafanacloud-prom, use one of the supported datasource variables instead"},
+		{Path: "/local_folder_1/hardcoded.json", Severity: LintWarning, Message: "hard-coded datasource grafanacloud-logs, use one of the supported datasource variables instead"},
+		{Path: "/local_folder_1/hardcoded.json", Severity: LintWarning, Message: "reference to undefined template variable job"},
+		{Path: "/local_folder_1/valid.json", Severity: LintWarning, Message: "duplicate title Valid, also used by /local_folder_2/duplicate.json"},
+	}, issues.Warnings())
+}
+
+func TestPublishAbortsOnLintErrors(t *testing.T) {
+	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+
+	system.DefaultFileSystem = afero.NewMemMapFs()
+	defer func() { system.DefaultFileSystem = afero.NewOsFs() }()
+
+	require.NoError(t, system.DefaultFileSystem.MkdirAll("/local_folder_1", 0777))
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/untitled.json", `{"dashboard": {"uid": "untitled"}}`)
+
+	cloudClient := new(MockCloudClient)
+
+	pub, err := NewPublisher(
+		WithCloudClient(cloudClient),
+		WithConfig(&PublisherConfig{
+			CommonDashboards: DashboardReferences{{LocalFolder: "/local_folder_1", GrafanaFolder: "Common"}},
+			TestStack:        "test-stack",
+		}),
+	)
+	require.NoError(t, err)
+
+	err = pub.Publish(false)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "missing dashboard title")
+
+	cloudClient.AssertExpectations(t)
+}
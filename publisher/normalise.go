@@ -0,0 +1,277 @@
+package publisher
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/adevinta/go-log-toolkit"
+	"github.com/spf13/afero"
+)
+
+// volatileDashboardFields are the dashboard fields Grafana updates on every
+// save, which only add noise to the dashboard sources.
+var volatileDashboardFields = []string{"id", "version", "iteration"}
+
+// NormaliseDashboard canonicalises a dashboard content in place: volatile
+// fields are removed, tags are sorted and panel IDs are renumbered so that
+// they are unique, see assignPanelIDs.
+func NormaliseDashboard(dash map[string]interface{}) map[string]interface{} {
+	for _, field := range volatileDashboardFields {
+		delete(dash, field)
+	}
+
+	if tags, ok := dash["tags"].([]interface{}); ok {
+		sort.SliceStable(tags, func(i, j int) bool {
+			return fmt.Sprint(tags[i]) < fmt.Sprint(tags[j])
+		})
+	}
+
+	panels := []map[string]interface{}{}
+	if items, ok := dash["panels"].([]interface{}); ok {
+		panels = collectPanels(items, panels)
+	}
+	if rows, ok := dash["rows"].([]interface{}); ok {
+		for _, row := range rows {
+			if row, ok := row.(map[string]interface{}); ok {
+				if items, ok := row["panels"].([]interface{}); ok {
+					panels = collectPanels(items, panels)
+				}
+			}
+		}
+	}
+	assignPanelIDs(panels)
+
+	return dash
+}
+
+// collectPanels appends the panels, and the panels nested in collapsed rows,
+// in order.
+func collectPanels(items []interface{}, panels []map[string]interface{}) []map[string]interface{} {
+	for _, item := range items {
+		panel, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		panels = append(panels, panel)
+		if nested, ok := panel["panels"].([]interface{}); ok {
+			panels = collectPanels(nested, panels)
+		}
+	}
+	return panels
+}
+
+// assignPanelIDs renumbers the panels without an ID, and the panels reusing
+// the ID of a previous panel, with the next IDs after the highest existing
+// one. The first panel using an ID keeps it, as overlays, panel links and the
+// queries of the Dashboard datasource reference panels by ID.
+func assignPanelIDs(panels []map[string]interface{}) {
+	nextID := 1
+	for _, panel := range panels {
+		if id, ok := panel["id"]; ok && toFloat(id) >= float64(nextID) {
+			nextID = int(toFloat(id)) + 1
+		}
+	}
+
+	used := map[float64]struct{}{}
+	for _, panel := range panels {
+		if id, ok := panel["id"]; ok && toFloat(id) > 0 {
+			if _, duplicate := used[toFloat(id)]; !duplicate {
+				used[toFloat(id)] = struct{}{}
+				continue
+			}
+		}
+		panel["id"] = nextID
+		nextID++
+	}
+}
+
+func toFloat(value interface{}) float64 {
+	switch v := value.(type) {
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	}
+	return 0
+}
+
+// FormatDashboardFile returns the canonical form of a dashboard file content:
+// the dashboard is normalised and encoded with sorted keys and a two spaces
+// indentation.
+func FormatDashboardFile(data []byte) ([]byte, error) {
+	dashboard, err := normaliseDashboardFile(data)
+	if err != nil {
+		return nil, err
+	}
+	return encodeJSON(dashboard)
+}
+
+// FormatDashboardYAMLFile returns the canonical form of a YAML dashboard file
+// content, normalised as FormatDashboardFile does.
+func FormatDashboardYAMLFile(data []byte) ([]byte, error) {
+	data, err := yamlToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	dashboard, err := normaliseDashboardFile(data)
+	if err != nil {
+		return nil, err
+	}
+	return encodeYAML(dashboard)
+}
+
+// normaliseDashboardFile decodes a JSON dashboard file content, preserving
+// numbers as they are written, and normalises its dashboard.
+func normaliseDashboardFile(data []byte) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	dashboard := map[string]interface{}{}
+	err := decoder.Decode(&dashboard)
+	if err != nil {
+		return nil, err
+	}
+
+	dash, ok := dashboard["dashboard"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("unable to find dashboard")
+	}
+	dashboard["dashboard"] = NormaliseDashboard(dash)
+
+	return dashboard, nil
+}
+
+// encodeJSON encodes a value with sorted keys, a two spaces indentation and
+// without escaping HTML characters, as Grafana does.
+func encodeJSON(value interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	err := encoder.Encode(value)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// NormaliseFolder formats the dashboard files of a local folder and returns
+// the paths of the files that were not in their canonical form.
+// When write is false the files are only checked, which allows failing CI
+// pipelines on unformatted dashboards.
+func NormaliseFolder(localFolder string, write bool) ([]string, error) {
+	return normaliseReference(DashboardReference{LocalFolder: localFolder}, "", write)
+}
+
+// normaliseReference formats the dashboard files of the local folder of a
+// reference which are not ignored.
+// When a format is given, dashboards written in another format are converted
+// and renamed accordingly.
+func normaliseReference(reference DashboardReference, format DashboardFormat, write bool) ([]string, error) {
+	unformatted := []string{}
+	fsys := reference.fileSystem()
+
+	err := walkDashboardFiles(reference, func(path string, info os.FileInfo) error {
+		if !isDashboardFile(path) {
+			return nil
+		}
+
+		data, err := afero.ReadFile(fsys, path)
+		if err != nil {
+			return err
+		}
+
+		target := path
+		if format != "" && isYAMLFile(path) != (format == DashboardFormatYAML) {
+			target = strings.TrimSuffix(path, filepath.Ext(path)) + format.extension()
+		}
+
+		converted, err := dashboardSourceToJSON(path, data)
+		if err != nil {
+			return fmt.Errorf("failed to format %s: %w", path, err)
+		}
+
+		dashboard, err := normaliseDashboardFile(converted)
+		if err != nil {
+			return fmt.Errorf("failed to format %s: %w", path, err)
+		}
+
+		formatted, err := encodeDashboardFile(target, dashboard)
+		if err != nil {
+			return fmt.Errorf("failed to format %s: %w", path, err)
+		}
+
+		if target == path && bytes.Equal(data, formatted) {
+			return nil
+		}
+
+		unformatted = append(unformatted, path)
+
+		if write {
+			if target != path {
+				_, err = fsys.Stat(target)
+				if err == nil {
+					return fmt.Errorf("failed to convert %s: %s already exists", path, target)
+				}
+				log.DefaultLogger.WithField("dashboard", path).WithField("destination", target).Println("Converting dashboard")
+			} else {
+				log.DefaultLogger.WithField("dashboard", path).Println("Formatting dashboard")
+			}
+			err = afero.WriteFile(fsys, target, formatted, info.Mode())
+			if err != nil {
+				return fmt.Errorf("failed to write %s: %w", target, err)
+			}
+			if target != path {
+				err = fsys.Remove(path)
+				if err != nil {
+					return fmt.Errorf("failed to remove %s: %w", path, err)
+				}
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return unformatted, nil
+}
+
+// Normalise formats the dashboard files of every configured local folder and
+// returns the paths of the files that were not in their canonical form.
+// When a DashboardFormat is configured, dashboards are converted to it.
+// When write is false the files are only checked, which is the only mode
+// supported by references read from an io/fs filesystem, such as the ones
+// given with WithLocalFolderFS.
+func (p Publisher) Normalise(write bool) ([]string, error) {
+	unformatted := []string{}
+
+	for _, reference := range append(append(DashboardReferences{}, p.config.CommonDashboards...), p.config.CustomDashboards...) {
+		if reference.LocalFolder == "" {
+			continue
+		}
+
+		_, err := reference.fileSystem().Stat(reference.LocalFolder)
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		files, err := normaliseReference(reference, p.config.DashboardFormat, write)
+		if err != nil {
+			return nil, err
+		}
+		unformatted = append(unformatted, files...)
+	}
+
+	return unformatted, nil
+}
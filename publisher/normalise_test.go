@@ -0,0 +1,123 @@
+package publisher
+
+import (
+	"testing"
+
+	system "github.com/adevinta/go-system-toolkit"
+	testutils "github.com/adevinta/go-testutils-toolkit"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormaliseDashboard(t *testing.T) {
+	dash := NormaliseDashboard(map[string]interface{}{
+		"id":        12,
+		"version":   4,
+		"iteration": 1700000000,
+		"uid":       "dash-1",
+		"tags":      []interface{}{"b", "a"},
+		"panels": []interface{}{
+			map[string]interface{}{"id": 8, "gridPos": map[string]interface{}{"x": 12, "y": 0}},
+			map[string]interface{}{
+				"id":      3,
+				"type":    "row",
+				"gridPos": map[string]interface{}{"x": 0, "y": 8},
+				"panels": []interface{}{
+					map[string]interface{}{"gridPos": map[string]interface{}{"x": 0, "y": 9}},
+				},
+			},
+			map[string]interface{}{
+				"id":      5,
+				"gridPos": map[string]interface{}{"x": 0, "y": 0},
+				"targets": []interface{}{map[string]interface{}{"panelId": 8}},
+			},
+			map[string]interface{}{"id": 3, "gridPos": map[string]interface{}{"x": 12, "y": 9}},
+		},
+	})
+
+	// Panels keep their order and IDs, and the missing or duplicate IDs
+	// follow the highest one.
+	assert.Equal(t, map[string]interface{}{
+		"uid":  "dash-1",
+		"tags": []interface{}{"a", "b"},
+		"panels": []interface{}{
+			map[string]interface{}{"id": 8, "gridPos": map[string]interface{}{"x": 12, "y": 0}},
+			map[string]interface{}{
+				"id":      3,
+				"type":    "row",
+				"gridPos": map[string]interface{}{"x": 0, "y": 8},
+				"panels": []interface{}{
+					map[string]interface{}{"id": 9, "gridPos": map[string]interface{}{"x": 0, "y": 9}},
+				},
+			},
+			map[string]interface{}{
+				"id":      5,
+				"gridPos": map[string]interface{}{"x": 0, "y": 0},
+				"targets": []interface{}{map[string]interface{}{"panelId": 8}},
+			},
+			map[string]interface{}{"id": 10, "gridPos": map[string]interface{}{"x": 12, "y": 9}},
+		},
+	}, dash)
+}
+
+func TestFormatDashboardFile(t *testing.T) {
+	t.Run("formats dashboards with sorted keys", func(t *testing.T) {
+		formatted, err := FormatDashboardFile([]byte(`{"dashboard": {"version": 3, "title": "<b>Dashboard</b>", "uid": "dash-1", "schemaVersion": 39}, "overwrite": true}`))
+		require.NoError(t, err)
+		assert.Equal(t, `{
+  "dashboard": {
+    "schemaVersion": 39,
+    "title": "<b>Dashboard</b>",
+    "uid": "dash-1"
+  },
+  "overwrite": true
+}
+`, string(formatted))
+	})
+
+	t.Run("fails when the dashboard is missing", func(t *testing.T) {
+		_, err := FormatDashboardFile([]byte(`{"title": "Dashboard"}`))
+		assert.Error(t, err)
+	})
+}
+
+func TestNormalise(t *testing.T) {
+	system.DefaultFileSystem = afero.NewMemMapFs()
+	defer func() { system.DefaultFileSystem = afero.NewOsFs() }()
+
+	require.NoError(t, system.DefaultFileSystem.MkdirAll("/local_folder_1", 0777))
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/formatted.json", "{\n  \"dashboard\": {\n    \"uid\": \"dash-1\"\n  }\n}\n")
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/unformatted.json", `{"dashboard": {"uid": "dash-2", "version": 2}}`)
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/removed.json.deleted", `{"dashboard": {"uid": "dash-3", "version": 2}}`)
+
+	pub, err := NewPublisher(WithConfig(&PublisherConfig{
+		CommonDashboards: DashboardReferences{{LocalFolder: "/local_folder_1", GrafanaFolder: "Common"}},
+		CustomDashboards: DashboardReferences{{LocalFolder: "/local_folder_2", GrafanaFolder: "Custom"}},
+	}))
+	require.NoError(t, err)
+
+	t.Run("check reports unformatted files without changing them", func(t *testing.T) {
+		unformatted, err := pub.Normalise(false)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"/local_folder_1/unformatted.json"}, unformatted)
+
+		data, err := afero.ReadFile(system.DefaultFileSystem, "/local_folder_1/unformatted.json")
+		require.NoError(t, err)
+		assert.Equal(t, `{"dashboard": {"uid": "dash-2", "version": 2}}`, string(data))
+	})
+
+	t.Run("write rewrites unformatted files", func(t *testing.T) {
+		unformatted, err := pub.Normalise(true)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"/local_folder_1/unformatted.json"}, unformatted)
+
+		data, err := afero.ReadFile(system.DefaultFileSystem, "/local_folder_1/unformatted.json")
+		require.NoError(t, err)
+		assert.Equal(t, "{\n  \"dashboard\": {\n    \"uid\": \"dash-2\"\n  }\n}\n", string(data))
+
+		unformatted, err = pub.Normalise(false)
+		require.NoError(t, err)
+		assert.Empty(t, unformatted)
+	})
+}
@@ -0,0 +1,230 @@
+package publisher
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	grafana "github.com/adevinta/go-grafana-toolkit/client"
+	log "github.com/adevinta/go-log-toolkit"
+	"github.com/spf13/afero"
+)
+
+// NotificationsConfig locates the alerting notification resources published
+// to every selected stack.
+type NotificationsConfig struct {
+	// LocalFolder holds the files declaring the contact points, notification
+	// templates, mute timings and notification policy tree.
+	LocalFolder string `yaml:"localFolder"`
+
+	// FS is the filesystem LocalFolder is read from. It defaults to
+	// system.DefaultFileSystem.
+	FS afero.Fs `yaml:"-"`
+}
+
+// reference returns the notifications folder as a reference, to walk its
+// files.
+func (c NotificationsConfig) reference() DashboardReference {
+	return DashboardReference{LocalFolder: c.LocalFolder, FS: c.FS}
+}
+
+// notificationsFile is the content of a notifications file.
+type notificationsFile struct {
+	Templates     []*grafana.NotificationTemplate `json:"templates"`
+	MuteTimings   []*grafana.MuteTiming           `json:"muteTimings"`
+	ContactPoints []*grafana.ContactPoint         `json:"contactPoints"`
+	Policies      *grafana.NotificationPolicy     `json:"policies"`
+}
+
+// envReference matches the $__env{NAME} references to environment variables
+// in notification files, which keep secrets out of the repository.
+var envReference = regexp.MustCompile(`\$__env\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces the environment variable references of the strings of a
+// decoded JSON value. Referencing an unset variable is an error.
+func expandEnv(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			expanded, err := expandEnv(item)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = expanded
+		}
+	case []interface{}:
+		for i, item := range v {
+			expanded, err := expandEnv(item)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = expanded
+		}
+	case string:
+		var err error
+		expanded := envReference.ReplaceAllStringFunc(v, func(reference string) string {
+			name := envReference.FindStringSubmatch(reference)[1]
+			env, ok := os.LookupEnv(name)
+			if !ok && err == nil {
+				err = fmt.Errorf("environment variable %s is not set", name)
+			}
+			return env
+		})
+		return expanded, err
+	}
+	return value, nil
+}
+
+// readNotificationsFiles reads and merges the notifications files of the
+// configured folder, rendered for the given stack.
+func (p Publisher) readNotificationsFiles(stack *grafana.Stack) (*notificationsFile, error) {
+	notifications := &notificationsFile{}
+	policiesPath := ""
+
+	reference := p.config.Notifications.reference()
+	err := walkDashboardFiles(reference, func(path string, info os.FileInfo) error {
+		switch filepath.Ext(p.renderedPath(path)) {
+		case ".json", ".yaml", ".yml":
+		default:
+			switch p.config.UnknownFiles {
+			case UnknownFilesIgnore:
+			case UnknownFilesWarn:
+				log.DefaultLogger.WithField("file", path).WithField("destination", stack.Slug).Warn("Skipping file with unsupported extension")
+			default:
+				return fmt.Errorf("unsupported file extension %s for path %v", filepath.Ext(path), path)
+			}
+			return nil
+		}
+
+		data, err := p.readStackDashboardSource(reference.fileSystem(), path, stack)
+		if err != nil {
+			return err
+		}
+
+		var content interface{}
+		err = json.Unmarshal(data, &content)
+		if err != nil {
+			return fmt.Errorf("failed to decode notifications %s: %w", path, err)
+		}
+		content, err = expandEnv(content)
+		if err != nil {
+			return fmt.Errorf("%w in %s", err, path)
+		}
+		data, err = json.Marshal(content)
+		if err != nil {
+			return err
+		}
+
+		file := &notificationsFile{}
+		err = json.Unmarshal(data, file)
+		if err != nil {
+			return fmt.Errorf("failed to decode notifications %s: %w", path, err)
+		}
+
+		if file.Policies != nil {
+			if policiesPath != "" {
+				return fmt.Errorf("notification policies are defined in both %s and %s", policiesPath, path)
+			}
+			policiesPath = path
+			notifications.Policies = file.Policies
+		}
+		notifications.Templates = append(notifications.Templates, file.Templates...)
+		notifications.MuteTimings = append(notifications.MuteTimings, file.MuteTimings...)
+		notifications.ContactPoints = append(notifications.ContactPoints, file.ContactPoints...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return notifications, nil
+}
+
+// syncNotifications publishes the notification resources to the given stacks.
+func (p Publisher) syncNotifications(grafanaStacks grafana.Stacks) error {
+	localFolder := p.config.Notifications.LocalFolder
+
+	log.DefaultLogger.WithField("localFolder", localFolder).Println("Syncing notifications...")
+
+	_, err := p.config.Notifications.reference().fileSystem().Stat(localFolder)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("Failed to discover %s: %w", localFolder, err)
+		}
+		log.DefaultLogger.WithField("localFolder", localFolder).Info("Local folder not present, skipping sync.")
+		return nil
+	}
+
+	for _, stack := range grafanaStacks {
+		err := p.syncNotificationsForStack(&stack)
+		if err != nil {
+			return fmt.Errorf("failed to sync notifications for stack %s: %w", stack.Slug, err)
+		}
+	}
+	return nil
+}
+
+// syncNotificationsForStack publishes the notification resources to a single
+// stack, in dependency order: templates and mute timings, then the contact
+// points using them, and finally the policy tree routing to them.
+func (p Publisher) syncNotificationsForStack(stack *grafana.Stack) error {
+	notifications, err := p.readNotificationsFiles(stack)
+	if err != nil {
+		return err
+	}
+
+	sc, err := p.stackClient(stack)
+	if err != nil {
+		return fmt.Errorf("failed to get grafana stack client for stack %v, error: %w", stack.Slug, err)
+	}
+
+	for _, template := range notifications.Templates {
+		err = sc.PutNotificationTemplate(template.Name, template.Template)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, muteTiming := range notifications.MuteTimings {
+		err = sc.UploadMuteTiming(muteTiming)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(notifications.ContactPoints) > 0 {
+		existing, err := sc.ListContactPoints()
+		if err != nil {
+			return err
+		}
+
+		for _, contactPoint := range notifications.ContactPoints {
+			// Contact points without UID update the integration of the same
+			// name and type instead of creating a new one on every run.
+			if contactPoint.UID == "" {
+				for _, candidate := range existing {
+					if candidate.Name == contactPoint.Name && candidate.Type != nil && contactPoint.Type != nil && *candidate.Type == *contactPoint.Type {
+						contactPoint.UID = candidate.UID
+						break
+					}
+				}
+			}
+
+			err = sc.UploadContactPoint(contactPoint, existing)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if notifications.Policies != nil {
+		err = sc.SetNotificationPolicyTree(notifications.Policies)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package publisher
+
+import (
+	"os"
+	"testing"
+
+	grafana "github.com/adevinta/go-grafana-toolkit/client"
+	system "github.com/adevinta/go-system-toolkit"
+	testutils "github.com/adevinta/go-testutils-toolkit"
+	"github.com/grafana/grafana-openapi-client-go/models"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandEnv(t *testing.T) {
+	os.Setenv("ONCALL_TOKEN", "secret")
+	defer os.Unsetenv("ONCALL_TOKEN")
+
+	expanded, err := expandEnv(map[string]interface{}{
+		"url":     "https://hooks.example.com/$__env{ONCALL_TOKEN}",
+		"headers": []interface{}{"Bearer $__env{ONCALL_TOKEN}", "${PROMPRO}"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"url":     "https://hooks.example.com/secret",
+		"headers": []interface{}{"Bearer secret", "${PROMPRO}"},
+	}, expanded)
+
+	_, err = expandEnv(map[string]interface{}{"url": "$__env{MISSING_TOKEN}"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "environment variable MISSING_TOKEN is not set")
+}
+
+func TestPublishNotifications(t *testing.T) {
+	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+	os.Setenv("ONCALL_WEBHOOK_URL", "https://hooks.example.com/secret")
+	defer os.Unsetenv("ONCALL_WEBHOOK_URL")
+
+	system.DefaultFileSystem = afero.NewMemMapFs()
+	defer func() { system.DefaultFileSystem = afero.NewOsFs() }()
+
+	require.NoError(t, system.DefaultFileSystem.MkdirAll("/notifications", 0777))
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/notifications/contact-points.yaml", `
+templates:
+- name: summary
+  template: '{{ define "summary" }}{{ .CommonLabels.alertname }}{{ end }}'
+muteTimings:
+- name: weekends
+  time_intervals:
+  - weekdays: [saturday, sunday]
+contactPoints:
+- name: On call
+  type: webhook
+  settings:
+    url: $__env{ONCALL_WEBHOOK_URL}
+`)
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/notifications/policies.yaml.tmpl", `
+policies:
+  receiver: On call
+  group_by: [alertname]
+  routes:
+  - receiver: On call
+    object_matchers: [[team, "=", "{{ .Slug }}"]]
+    mute_time_intervals: [weekends]
+`)
+
+	cloudClient := new(MockCloudClient)
+	testStackClient := new(MockStackClient)
+
+	cloudClient.
+		On("ListStacks").
+		Return(grafana.Stacks{testStack}, nil).
+		Once()
+	cloudClient.
+		On("NewStackClient", &testStack).
+		Return(testStackClient, nil)
+
+	webhook := "webhook"
+	testStackClient.
+		On("PutNotificationTemplate", "summary", `{{ define "summary" }}{{ .CommonLabels.alertname }}{{ end }}`).
+		Return(nil).
+		Once()
+	testStackClient.
+		On("UploadMuteTiming", &grafana.MuteTiming{
+			Name:          "weekends",
+			TimeIntervals: []*models.TimeIntervalItem{{Weekdays: []string{"saturday", "sunday"}}},
+		}).
+		Return(nil).
+		Once()
+	existingContactPoints := []*grafana.ContactPoint{{UID: "oncall-uid", Name: "On call", Type: &webhook}}
+	testStackClient.
+		On("ListContactPoints").
+		Return(existingContactPoints, nil).
+		Once()
+	testStackClient.
+		On("UploadContactPoint", &grafana.ContactPoint{
+			UID:      "oncall-uid",
+			Name:     "On call",
+			Type:     &webhook,
+			Settings: map[string]interface{}{"url": "https://hooks.example.com/secret"},
+		}, existingContactPoints).
+		Return(nil).
+		Once()
+	testStackClient.
+		On("SetNotificationPolicyTree", &grafana.NotificationPolicy{
+			Receiver: "On call",
+			GroupBy:  []string{"alertname"},
+			Routes: []*grafana.NotificationPolicy{{
+				Receiver:          "On call",
+				ObjectMatchers:    models.ObjectMatchers{{"team", "=", "test-stack"}},
+				MuteTimeIntervals: []string{"weekends"},
+			}},
+		}).
+		Return(nil).
+		Once()
+	testStackClient.On("Cleanup").Return(nil)
+
+	pub, err := NewPublisher(
+		WithCloudClient(cloudClient),
+		WithConfig(&PublisherConfig{
+			Notifications:  NotificationsConfig{LocalFolder: "/notifications"},
+			TemplateSuffix: ".tmpl",
+			TestStack:      "test-stack",
+		}),
+	)
+	require.NoError(t, err)
+
+	err = pub.Publish(false)
+	assert.NoError(t, err)
+
+	cloudClient.AssertExpectations(t)
+	testStackClient.AssertExpectations(t)
+}
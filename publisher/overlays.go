@@ -0,0 +1,406 @@
+package publisher
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	grafana "github.com/adevinta/go-grafana-toolkit/client"
+	log "github.com/adevinta/go-log-toolkit"
+	"github.com/spf13/afero"
+)
+
+// overlayExtension is appended to the path of a dashboard file to get the
+// path of its overlay file.
+const overlayExtension = ".overlay"
+
+// dashboardOverlay holds the patches applied to a dashboard on the stacks
+// matching its key in the overlay file.
+type dashboardOverlay struct {
+	// JSONPatch is a RFC 6902 JSON Patch.
+	JSONPatch []jsonPatchOperation `json:"jsonPatch,omitempty"`
+	// MergePatch is a RFC 7386 JSON Merge Patch.
+	MergePatch map[string]interface{} `json:"mergePatch,omitempty"`
+}
+
+// jsonPatchOperation is an operation of a RFC 6902 JSON Patch.
+type jsonPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// readOverlays reads the overlay file of a dashboard, if any. Overlays are
+// keyed by stack slug or by a stack selector, a path.Match pattern matched
+// against the stack slugs.
+func readOverlays(fsys afero.Fs, dashboardPath string) (map[string]dashboardOverlay, error) {
+	overlayPath := dashboardPath + overlayExtension
+
+	data, err := afero.ReadFile(fsys, overlayPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", overlayPath, err)
+	}
+
+	if !json.Valid(data) {
+		data, err = yamlToJSON(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid YAML in %s: %w", overlayPath, err)
+		}
+	}
+
+	overlays := map[string]dashboardOverlay{}
+	err = json.Unmarshal(data, &overlays)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", overlayPath, err)
+	}
+	return overlays, nil
+}
+
+// stackOverlays returns the overlays applying to a stack, in the order they
+// must be applied: matching selectors sorted by key, then the overlay of the
+// stack slug, so that the most specific one wins.
+func stackOverlays(overlays map[string]dashboardOverlay, stack *grafana.Stack) ([]string, error) {
+	selectors := []string{}
+	for key := range overlays {
+		if key == stack.Slug {
+			continue
+		}
+		matched, err := path.Match(key, stack.Slug)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stack selector %s: %w", key, err)
+		}
+		if matched {
+			selectors = append(selectors, key)
+		}
+	}
+	sort.Strings(selectors)
+
+	if _, ok := overlays[stack.Slug]; ok {
+		selectors = append(selectors, stack.Slug)
+	}
+	return selectors, nil
+}
+
+// hasOverlays reports whether the overlay file of a dashboard patches it on
+// the stack.
+func hasOverlays(fsys afero.Fs, dashboardPath string, stack *grafana.Stack) (bool, error) {
+	overlays, err := readOverlays(fsys, dashboardPath)
+	if err != nil {
+		return false, err
+	}
+	keys, err := stackOverlays(overlays, stack)
+	if err != nil {
+		return false, err
+	}
+	return len(keys) > 0, nil
+}
+
+// applyOverlays patches a dashboard content with the overlays of its overlay
+// file applying to the stack. Patches must only reference existing paths, so
+// that a dashboard change cannot silently make an overlay obsolete.
+func applyOverlays(fsys afero.Fs, dashboardPath string, stack *grafana.Stack, dash map[string]interface{}) (map[string]interface{}, error) {
+	overlays, err := readOverlays(fsys, dashboardPath)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := stackOverlays(overlays, stack)
+	if err != nil {
+		return nil, fmt.Errorf("%w in %s", err, dashboardPath+overlayExtension)
+	}
+
+	for _, key := range keys {
+		log.DefaultLogger.WithField("dashboard", dashboardPath).WithField("overlay", key).WithField("destination", stack.Slug).Println("Applying overlay")
+
+		overlay := overlays[key]
+		for i, operation := range overlay.JSONPatch {
+			err = applyJSONPatchOperation(dash, operation)
+			if err != nil {
+				return nil, fmt.Errorf("failed to apply operation %d of overlay %s to %s: %w", i, key, dashboardPath, err)
+			}
+		}
+
+		if overlay.MergePatch != nil {
+			err = applyMergePatch(dash, overlay.MergePatch, "")
+			if err != nil {
+				return nil, fmt.Errorf("failed to apply merge patch of overlay %s to %s: %w", key, dashboardPath, err)
+			}
+		}
+	}
+
+	return dash, nil
+}
+
+// applyJSONPatchOperation applies a RFC 6902 operation to a dashboard.
+func applyJSONPatchOperation(dash map[string]interface{}, operation jsonPatchOperation) error {
+	tokens, err := parseJSONPointer(operation.Path)
+	if err != nil {
+		return err
+	}
+
+	value := func() (interface{}, error) {
+		if len(operation.Value) == 0 {
+			return nil, fmt.Errorf("missing value for %s operation on %s", operation.Op, operation.Path)
+		}
+		var value interface{}
+		err := json.Unmarshal(operation.Value, &value)
+		return value, err
+	}
+
+	switch operation.Op {
+	case "add":
+		v, err := value()
+		if err != nil {
+			return err
+		}
+		return addJSONPointer(dash, tokens, operation.Path, v)
+
+	case "remove":
+		_, err = removeJSONPointer(dash, tokens, operation.Path)
+		return err
+
+	case "replace":
+		v, err := value()
+		if err != nil {
+			return err
+		}
+		_, err = removeJSONPointer(dash, tokens, operation.Path)
+		if err != nil {
+			return err
+		}
+		return addJSONPointer(dash, tokens, operation.Path, v)
+
+	case "move", "copy":
+		fromTokens, err := parseJSONPointer(operation.From)
+		if err != nil {
+			return err
+		}
+		var v interface{}
+		if operation.Op == "move" {
+			v, err = removeJSONPointer(dash, fromTokens, operation.From)
+		} else {
+			v, err = getJSONPointer(dash, fromTokens, operation.From)
+			if err == nil {
+				v, err = deepCopyJSON(v)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		return addJSONPointer(dash, tokens, operation.Path, v)
+
+	case "test":
+		v, err := value()
+		if err != nil {
+			return err
+		}
+		current, err := getJSONPointer(dash, tokens, operation.Path)
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(current, v) {
+			return fmt.Errorf("test failed on %s: found %v instead of %v", operation.Path, current, v)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unsupported operation %q", operation.Op)
+}
+
+// parseJSONPointer splits a RFC 6901 JSON pointer into its unescaped tokens.
+// The whole dashboard cannot be patched, the pointer must reference one of
+// its fields.
+func parseJSONPointer(pointer string) ([]string, error) {
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid path %q: must start with /", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// updateJSONPointer calls update on the container holding the last token of
+// a pointer, and stores the container it returns in its parent.
+func updateJSONPointer(doc interface{}, tokens []string, pointer string, update func(container interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return update(doc, tokens[0])
+	}
+
+	switch container := doc.(type) {
+	case map[string]interface{}:
+		child, ok := container[tokens[0]]
+		if !ok {
+			return nil, fmt.Errorf("path %s does not exist", pointer)
+		}
+		updated, err := updateJSONPointer(child, tokens[1:], pointer, update)
+		if err != nil {
+			return nil, err
+		}
+		container[tokens[0]] = updated
+		return container, nil
+
+	case []interface{}:
+		i, err := jsonArrayIndex(tokens[0], len(container)-1, pointer)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := updateJSONPointer(container[i], tokens[1:], pointer, update)
+		if err != nil {
+			return nil, err
+		}
+		container[i] = updated
+		return container, nil
+	}
+
+	return nil, fmt.Errorf("path %s does not exist", pointer)
+}
+
+// jsonArrayIndex parses an array index token, which must be at most max.
+func jsonArrayIndex(token string, max int, pointer string) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index %q in path %s", token, pointer)
+	}
+	if i > max {
+		return 0, fmt.Errorf("path %s does not exist", pointer)
+	}
+	return i, nil
+}
+
+func getJSONPointer(doc interface{}, tokens []string, pointer string) (interface{}, error) {
+	var value interface{}
+	_, err := updateJSONPointer(doc, tokens, pointer, func(container interface{}, token string) (interface{}, error) {
+		switch container := container.(type) {
+		case map[string]interface{}:
+			v, ok := container[token]
+			if !ok {
+				return nil, fmt.Errorf("path %s does not exist", pointer)
+			}
+			value = v
+			return container, nil
+		case []interface{}:
+			i, err := jsonArrayIndex(token, len(container)-1, pointer)
+			if err != nil {
+				return nil, err
+			}
+			value = container[i]
+			return container, nil
+		}
+		return nil, fmt.Errorf("path %s does not exist", pointer)
+	})
+	return value, err
+}
+
+func addJSONPointer(doc interface{}, tokens []string, pointer string, value interface{}) error {
+	_, err := updateJSONPointer(doc, tokens, pointer, func(container interface{}, token string) (interface{}, error) {
+		switch container := container.(type) {
+		case map[string]interface{}:
+			container[token] = value
+			return container, nil
+		case []interface{}:
+			if token == "-" {
+				return append(container, value), nil
+			}
+			i, err := jsonArrayIndex(token, len(container), pointer)
+			if err != nil {
+				return nil, err
+			}
+			container = append(container, nil)
+			copy(container[i+1:], container[i:])
+			container[i] = value
+			return container, nil
+		}
+		return nil, fmt.Errorf("path %s does not exist", pointer)
+	})
+	return err
+}
+
+func removeJSONPointer(doc interface{}, tokens []string, pointer string) (interface{}, error) {
+	var removed interface{}
+	_, err := updateJSONPointer(doc, tokens, pointer, func(container interface{}, token string) (interface{}, error) {
+		switch container := container.(type) {
+		case map[string]interface{}:
+			v, ok := container[token]
+			if !ok {
+				return nil, fmt.Errorf("path %s does not exist", pointer)
+			}
+			removed = v
+			delete(container, token)
+			return container, nil
+		case []interface{}:
+			i, err := jsonArrayIndex(token, len(container)-1, pointer)
+			if err != nil {
+				return nil, err
+			}
+			removed = container[i]
+			return append(container[:i:i], container[i+1:]...), nil
+		}
+		return nil, fmt.Errorf("path %s does not exist", pointer)
+	})
+	return removed, err
+}
+
+// applyMergePatch applies a RFC 7386 merge patch to a dashboard object.
+// Unlike the RFC, every patched field must already exist; fields are added
+// with a JSON Patch add operation.
+func applyMergePatch(target map[string]interface{}, patch map[string]interface{}, pointer string) error {
+	keys := make([]string, 0, len(patch))
+	for key := range patch {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		childPointer := pointer + "/" + strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+
+		current, ok := target[key]
+		if !ok {
+			return fmt.Errorf("path %s does not exist", childPointer)
+		}
+
+		value := patch[key]
+		if value == nil {
+			delete(target, key)
+			continue
+		}
+
+		patchObject, isPatchObject := value.(map[string]interface{})
+		currentObject, isCurrentObject := current.(map[string]interface{})
+		if isPatchObject && isCurrentObject {
+			err := applyMergePatch(currentObject, patchObject, childPointer)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if isPatchObject {
+			return fmt.Errorf("path %s is not an object", childPointer)
+		}
+
+		target[key] = value
+	}
+	return nil
+}
+
+// deepCopyJSON copies a decoded JSON value.
+func deepCopyJSON(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var copied interface{}
+	err = json.Unmarshal(data, &copied)
+	return copied, err
+}
@@ -0,0 +1,215 @@
+package publisher
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	grafana "github.com/adevinta/go-grafana-toolkit/client"
+	system "github.com/adevinta/go-system-toolkit"
+	testutils "github.com/adevinta/go-testutils-toolkit"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeTestDashboard(t *testing.T, content string) map[string]interface{} {
+	t.Helper()
+	dash := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal([]byte(content), &dash))
+	return dash
+}
+
+func TestApplyJSONPatchOperation(t *testing.T) {
+	base := `{"title": "Dashboard", "tags": ["a", "b"], "panels": [{"title": "CPU", "thresholds": {"value": 80}}]}`
+
+	for _, tc := range []struct {
+		name      string
+		operation string
+		expected  string
+		err       string
+	}{
+		{
+			name:      "add to an object",
+			operation: `{"op": "add", "path": "/refresh", "value": "1m"}`,
+			expected:  `{"title": "Dashboard", "refresh": "1m", "tags": ["a", "b"], "panels": [{"title": "CPU", "thresholds": {"value": 80}}]}`,
+		},
+		{
+			name:      "add to an array",
+			operation: `{"op": "add", "path": "/tags/1", "value": "c"}`,
+			expected:  `{"title": "Dashboard", "tags": ["a", "c", "b"], "panels": [{"title": "CPU", "thresholds": {"value": 80}}]}`,
+		},
+		{
+			name:      "append to an array",
+			operation: `{"op": "add", "path": "/tags/-", "value": "c"}`,
+			expected:  `{"title": "Dashboard", "tags": ["a", "b", "c"], "panels": [{"title": "CPU", "thresholds": {"value": 80}}]}`,
+		},
+		{
+			name:      "remove",
+			operation: `{"op": "remove", "path": "/tags/0"}`,
+			expected:  `{"title": "Dashboard", "tags": ["b"], "panels": [{"title": "CPU", "thresholds": {"value": 80}}]}`,
+		},
+		{
+			name:      "replace",
+			operation: `{"op": "replace", "path": "/panels/0/thresholds/value", "value": 90}`,
+			expected:  `{"title": "Dashboard", "tags": ["a", "b"], "panels": [{"title": "CPU", "thresholds": {"value": 90}}]}`,
+		},
+		{
+			name:      "move",
+			operation: `{"op": "move", "from": "/tags/0", "path": "/tags/-"}`,
+			expected:  `{"title": "Dashboard", "tags": ["b", "a"], "panels": [{"title": "CPU", "thresholds": {"value": 80}}]}`,
+		},
+		{
+			name:      "copy",
+			operation: `{"op": "copy", "from": "/title", "path": "/panels/0/description"}`,
+			expected:  `{"title": "Dashboard", "tags": ["a", "b"], "panels": [{"title": "CPU", "description": "Dashboard", "thresholds": {"value": 80}}]}`,
+		},
+		{
+			name:      "successful test",
+			operation: `{"op": "test", "path": "/panels/0/thresholds/value", "value": 80}`,
+			expected:  base,
+		},
+		{
+			name:      "failed test",
+			operation: `{"op": "test", "path": "/panels/0/thresholds/value", "value": 90}`,
+			err:       "test failed on /panels/0/thresholds/value",
+		},
+		{
+			name:      "replace a missing path",
+			operation: `{"op": "replace", "path": "/panels/0/thresolds/value", "value": 90}`,
+			err:       "path /panels/0/thresolds/value does not exist",
+		},
+		{
+			name:      "remove an out of range index",
+			operation: `{"op": "remove", "path": "/panels/1"}`,
+			err:       "path /panels/1 does not exist",
+		},
+		{
+			name:      "add under a missing parent",
+			operation: `{"op": "add", "path": "/links/0", "value": {}}`,
+			err:       "path /links/0 does not exist",
+		},
+		{
+			name:      "unsupported operation",
+			operation: `{"op": "merge", "path": "/title"}`,
+			err:       `unsupported operation "merge"`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dash := decodeTestDashboard(t, base)
+
+			operation := jsonPatchOperation{}
+			require.NoError(t, json.Unmarshal([]byte(tc.operation), &operation))
+
+			err := applyJSONPatchOperation(dash, operation)
+			if tc.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, decodeTestDashboard(t, tc.expected), dash)
+		})
+	}
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	t.Run("merges existing fields", func(t *testing.T) {
+		dash := decodeTestDashboard(t, `{"title": "Dashboard", "refresh": "5m", "time": {"from": "now-6h", "to": "now"}}`)
+
+		err := applyMergePatch(dash, decodeTestDashboard(t, `{"title": "Dev Dashboard", "refresh": null, "time": {"from": "now-1h"}}`), "")
+		require.NoError(t, err)
+		assert.Equal(t, decodeTestDashboard(t, `{"title": "Dev Dashboard", "time": {"from": "now-1h", "to": "now"}}`), dash)
+	})
+
+	t.Run("rejects missing fields", func(t *testing.T) {
+		dash := decodeTestDashboard(t, `{"title": "Dashboard", "time": {"from": "now-6h"}}`)
+
+		err := applyMergePatch(dash, decodeTestDashboard(t, `{"time": {"form": "now-1h"}}`), "")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "path /time/form does not exist")
+	})
+}
+
+func TestPublishAppliesOverlays(t *testing.T) {
+	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+
+	system.DefaultFileSystem = afero.NewMemMapFs()
+	defer func() { system.DefaultFileSystem = afero.NewOsFs() }()
+
+	require.NoError(t, system.DefaultFileSystem.MkdirAll("/local_folder_1", 0777))
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/dashboard.json", `{
+		"dashboard": {
+			"uid": "dash-1",
+			"title": "Dashboard",
+			"refresh": "5m",
+			"panels": [{"title": "Errors", "datasource": "${PROMPRO}", "thresholds": {"value": 80}}]
+		}
+	}`)
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/dashboard.json.overlay", `
+"test-*":
+  mergePatch:
+    refresh: 1m
+    title: Overwritten Dashboard
+test-stack:
+  jsonPatch:
+  - op: replace
+    path: /panels/0/thresholds/value
+    value: 95
+  mergePatch:
+    title: Test Dashboard
+other-stack:
+  jsonPatch:
+  - op: remove
+    path: /panels/0
+`)
+
+	cloudClient := new(MockCloudClient)
+	testStackClient := new(MockStackClient)
+
+	cloudClient.
+		On("ListStacks").
+		Return(grafana.Stacks{testStack}, nil).
+		Once()
+	cloudClient.
+		On("NewStackClient", &testStack).
+		Return(testStackClient, nil)
+
+	testStackClient.
+		On("EnsureFolder", nilFolder, "Common").
+		Return(commonFolder, nil)
+	testStackClient.
+		On("UploadDashboard", mock.AnythingOfType("*client.Dashboard")).
+		Run(func(args mock.Arguments) {
+			dashboard := args.Get(0).(*grafana.Dashboard)
+			assert.Equal(t, map[string]interface{}{
+				"uid":       "dash-1",
+				"title":     "Test Dashboard",
+				"refresh":   "1m",
+				"folderUid": "common-folder-uid",
+				"panels": []interface{}{
+					map[string]interface{}{"title": "Errors", "datasource": "${PROMPRO}", "thresholds": map[string]interface{}{"value": float64(95)}},
+				},
+			}, dashboard.Dashboard)
+		}).
+		Return(nil).
+		Once()
+	testStackClient.On("Cleanup").Return(nil)
+
+	pub, err := NewPublisher(
+		WithCloudClient(cloudClient),
+		WithConfig(&PublisherConfig{
+			CommonDashboards: DashboardReferences{{LocalFolder: "/local_folder_1", GrafanaFolder: "Common"}},
+			TestStack:        "test-stack",
+		}),
+	)
+	require.NoError(t, err)
+
+	err = pub.Publish(true)
+	assert.NoError(t, err)
+
+	cloudClient.AssertExpectations(t)
+	testStackClient.AssertExpectations(t)
+}
@@ -8,7 +8,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
@@ -37,6 +39,28 @@ type Publisher struct {
 	configPath string
 	config     *PublisherConfig
 	gcc        grafana.GrafanaCloudClient
+
+	// configFS is the filesystem the configuration file is read from, and
+	// localFolderFS the filesystems local folders are read from, by path.
+	configFS      afero.Fs
+	localFolderFS map[string]afero.Fs
+
+	// mode is the operation in progress, exposed to dashboard templates.
+	mode PublishMode
+
+	// libraryPanelUIDs records the local UIDs of the library panels
+	// published during a Publish.
+	libraryPanelUIDs map[string]struct{}
+
+	// localLibraryPanels holds, by published UID, the local UIDs of the
+	// library panels during an Export, so that dashboard references to them
+	// are reverted.
+	localLibraryPanels map[string]string
+
+	// stackClients holds, by stack slug, the clients shared by all the
+	// synchronizations of a Publish, so that a single service account is
+	// created per stack and the folders it ensured are cached for the run.
+	stackClients map[string]grafana.GrafanaStackClient
 }
 
 func resolveConfigFilePath(path string) string {
@@ -55,13 +79,19 @@ func IsConfigured(path string) bool {
 // LoadPublisherConfig reads and parses the publisher configuration file.
 // Returns an error if the file cannot be read or parsed.
 func LoadPublisherConfig(path string) (*PublisherConfig, error) {
+	return loadPublisherConfig(system.DefaultFileSystem, path)
+}
+
+// loadPublisherConfig reads and parses the publisher configuration file from
+// a filesystem.
+func loadPublisherConfig(fsys afero.Fs, path string) (*PublisherConfig, error) {
 	path = resolveConfigFilePath(path)
-	_, err := system.DefaultFileSystem.Stat(path)
+	_, err := fsys.Stat(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open config file %s: %w", path, err)
 	}
 
-	data, err := afero.ReadFile(system.DefaultFileSystem, path)
+	data, err := afero.ReadFile(fsys, path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
 	}
@@ -92,6 +122,42 @@ func WithConfigPath(path string) PublisherOption {
 	}
 }
 
+// WithConfigFS reads the configuration file from fsys, such as an embed.FS,
+// instead of the default filesystem.
+func WithConfigFS(fsys fs.FS) PublisherOption {
+	return func(p *Publisher) {
+		p.configFS = afero.FromIOFS{FS: fsys}
+	}
+}
+
+// WithLocalFolderFS reads the files of the references whose local folder is
+// localFolder from fsys, such as an embed.FS, instead of the default
+// filesystem. It applies to dashboards, library panels, alert rules and
+// notifications.
+// Local folders are matched and read as io/fs paths: "dashboards",
+// "./dashboards" and "/dashboards" all read the dashboards directory of fsys,
+// and folders outside of it, such as "../dashboards", are rejected by
+// NewPublisher. The filesystem is read-only, so Export and Normalise cannot
+// write to these references.
+func WithLocalFolderFS(localFolder string, fsys fs.FS) PublisherOption {
+	return func(p *Publisher) {
+		if p.localFolderFS == nil {
+			p.localFolderFS = map[string]afero.Fs{}
+		}
+		p.localFolderFS[ioFSPath(localFolder)] = afero.FromIOFS{FS: fsys}
+	}
+}
+
+// ioFSPath returns the io/fs path of a local folder, which is unrooted and
+// slash separated.
+func ioFSPath(localFolder string) string {
+	name := strings.TrimLeft(path.Clean(filepath.ToSlash(localFolder)), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
 // NewPublisher creates a new Publisher instance.
 // It loads the configuration from the publisher-config.yaml file.
 // Returns an error if the configuration file cannot be loaded or parsed.
@@ -102,18 +168,59 @@ func NewPublisher(opts ...PublisherOption) (*Publisher, error) {
 	}
 
 	if publisher.config == nil {
-		cfg, err := LoadPublisherConfig(publisher.configPath)
+		configFS := publisher.configFS
+		if configFS == nil {
+			configFS = system.DefaultFileSystem
+		}
+		cfg, err := loadPublisherConfig(configFS, publisher.configPath)
 		if err != nil {
 			return nil, fmt.Errorf("failed to load config: %w", err)
 		}
 		publisher.config = cfg
 	}
 
+	if len(publisher.localFolderFS) > 0 {
+		for localFolder := range publisher.localFolderFS {
+			if !fs.ValidPath(localFolder) {
+				return nil, fmt.Errorf("invalid local folder %s: filesystems given with WithLocalFolderFS can only be read below their root", localFolder)
+			}
+		}
+
+		cfg := *publisher.config
+		cfg.CommonDashboards = publisher.withLocalFolderFS(cfg.CommonDashboards)
+		cfg.CustomDashboards = publisher.withLocalFolderFS(cfg.CustomDashboards)
+		cfg.LibraryPanels = publisher.withLocalFolderFS(cfg.LibraryPanels)
+		cfg.AlertRules = publisher.withLocalFolderFS(cfg.AlertRules)
+		if fsys, ok := publisher.localFolderFS[ioFSPath(cfg.Notifications.LocalFolder)]; ok {
+			cfg.Notifications.LocalFolder = ioFSPath(cfg.Notifications.LocalFolder)
+			cfg.Notifications.FS = fsys
+		}
+		publisher.config = &cfg
+	}
+
 	publisher.config.initExclusionsMap()
 
 	return publisher, nil
 }
 
+// withLocalFolderFS returns a copy of the references, reading their local
+// folder from the filesystem given with WithLocalFolderFS, if any. The local
+// folder of these references is replaced by its io/fs path.
+func (p Publisher) withLocalFolderFS(references DashboardReferences) DashboardReferences {
+	if references == nil {
+		return nil
+	}
+	result := make(DashboardReferences, 0, len(references))
+	for _, reference := range references {
+		if fsys, ok := p.localFolderFS[ioFSPath(reference.LocalFolder)]; ok {
+			reference.LocalFolder = ioFSPath(reference.LocalFolder)
+			reference.FS = fsys
+		}
+		result = append(result, reference)
+	}
+	return result
+}
+
 // NewPublisherWithCloudClient creates a new Publisher instance with a custom Grafana Cloud client.
 // Deprecated: use NewPublisher(WithCloudClient(gcc)) instead
 func NewPublisherWithCloudClient(gcc grafana.GrafanaCloudClient) (*Publisher, error) {
@@ -134,6 +241,22 @@ func (p Publisher) Publish(syncAllStacks bool) error {
 		return nil
 	}
 
+	p.mode = PublishModeTest
+	if syncAllStacks {
+		p.mode = PublishModeAll
+	}
+
+	issues, err := p.Lint()
+	if err != nil {
+		return fmt.Errorf("failed to lint dashboards: %w", err)
+	}
+	for _, issue := range issues.Warnings() {
+		log.DefaultLogger.WithField("dashboard", issue.Path).Warn(issue.Message)
+	}
+	if errs := issues.Errors(); len(errs) > 0 {
+		return fmt.Errorf("invalid dashboards: %w", errs.Err())
+	}
+
 	if p.gcc == nil {
 		cloudClient, err := grafana.NewCloudClient()
 		if err != nil {
@@ -142,33 +265,13 @@ func (p Publisher) Publish(syncAllStacks bool) error {
 		p.gcc = cloudClient
 	}
 
-	stacksWithCommonDashboards, err := p.gcc.ListStacks()
+	stacksWithCommonDashboards, stacksWithCustomDashboards, err := p.selectStacks(syncAllStacks)
 	if err != nil {
-		return fmt.Errorf("failed to list stacks: %w", err)
-	}
-
-	stacks := grafana.Stacks{}
-
-	for _, stack := range stacksWithCommonDashboards {
-		if _, ok := p.config.ExclusionsMap()[stack.Slug]; !ok {
-			log.DefaultLogger.WithField("stack", stack.Slug).Println("is not excluded, adding it to the candidates")
-			stacks = append(stacks, stack)
-		} else {
-			log.DefaultLogger.WithField("stack", stack.Slug).Println("is excluded, skipping")
-		}
+		return err
 	}
 
-	stacksWithCommonDashboards = stacks
-	var stacksWithCustomDashboards grafana.Stacks
-	if syncAllStacks {
-		log.DefaultLogger.Println("Syncing all stacks")
-		stacksWithCustomDashboards = grafana.Stacks{stackByName(&stacksWithCommonDashboards, p.config.CustomStack)}
-	} else {
-		log.DefaultLogger.Printf("Syncing only %s stack", p.config.TestStack)
-		testStack := stackByName(&stacksWithCommonDashboards, p.config.TestStack)
-		stacksWithCommonDashboards = grafana.Stacks{testStack}
-		stacksWithCustomDashboards = grafana.Stacks{testStack}
-	}
+	p.stackClients = map[string]grafana.GrafanaStackClient{}
+	defer p.cleanupStackClients()
 
 	parentFolders := map[string]*grafana.Folder{}
 	if p.config.RootFolder != "" {
@@ -184,11 +287,36 @@ func (p Publisher) Publish(syncAllStacks bool) error {
 		}
 	}
 
+	// Datasources, library panels and alert rules are published to every
+	// selected stack.
+	selectedStacks := uniqueStacks(append(stacksWithCommonDashboards, stacksWithCustomDashboards...))
+
+	// Datasources are ensured first, as dashboards and library panels are
+	// bound to them.
+	if len(p.config.Datasources) > 0 || p.config.PruneDatasources {
+		err = p.syncDatasources(selectedStacks)
+		if err != nil {
+			return fmt.Errorf("datasource sync failed: %w", err)
+		}
+	}
+
+	// Library panels are published before dashboards, as dashboards fail to
+	// reference missing library panels.
+	p.libraryPanelUIDs = map[string]struct{}{}
+	for _, libraryPanels := range p.config.LibraryPanels {
+		if libraryPanels.LocalFolder != "" && libraryPanels.GrafanaFolder != "" {
+			err = p.syncLibraryPanels(selectedStacks, parentFolders, libraryPanels)
+			if err != nil {
+				return fmt.Errorf("sync failed (%s -> %s): %w", libraryPanels.LocalFolder, libraryPanels.GrafanaFolder, err)
+			}
+		}
+	}
+
 	for _, customDashboard := range p.config.CustomDashboards {
 		localFolder := customDashboard.LocalFolder
 		grafanaFolder := customDashboard.GrafanaFolder
 		if localFolder != "" && grafanaFolder != "" {
-			err = p.syncDashboards(&stacksWithCustomDashboards, parentFolders, localFolder, grafanaFolder)
+			err = p.syncDashboards(&stacksWithCustomDashboards, parentFolders, customDashboard)
 			if err != nil {
 				return fmt.Errorf("sync failed (%s -> %s): %w", localFolder, grafanaFolder, err)
 			}
@@ -199,38 +327,155 @@ func (p Publisher) Publish(syncAllStacks bool) error {
 		localFolder := commonDashboard.LocalFolder
 		grafanaFolder := commonDashboard.GrafanaFolder
 		if localFolder != "" && grafanaFolder != "" {
-			err = p.syncDashboards(&stacksWithCommonDashboards, parentFolders, localFolder, grafanaFolder)
+			err = p.syncDashboards(&stacksWithCommonDashboards, parentFolders, commonDashboard)
 			if err != nil {
 				return fmt.Errorf("sync failed (%s -> %s): %w", localFolder, grafanaFolder, err)
 			}
 		}
 	}
 
+	// Notifications are published before the alert rules routing to them.
+	if p.config.Notifications.LocalFolder != "" {
+		err = p.syncNotifications(selectedStacks)
+		if err != nil {
+			return fmt.Errorf("sync failed (%s): %w", p.config.Notifications.LocalFolder, err)
+		}
+	}
+
+	for _, alertRules := range p.config.AlertRules {
+		if alertRules.LocalFolder != "" && alertRules.GrafanaFolder != "" {
+			err = p.syncAlertRules(selectedStacks, parentFolders, alertRules)
+			if err != nil {
+				return fmt.Errorf("sync failed (%s -> %s): %w", alertRules.LocalFolder, alertRules.GrafanaFolder, err)
+			}
+		}
+	}
+
 	return nil
 }
 
+// selectStacks returns the stacks common dashboards and custom dashboards
+// are published to.
+// If syncAllStacks is true, common dashboards go to all non-excluded stacks
+// and custom dashboards to the custom stack. Otherwise both only go to the
+// test stack.
+func (p Publisher) selectStacks(syncAllStacks bool) (grafana.Stacks, grafana.Stacks, error) {
+	stacksWithCommonDashboards, err := p.gcc.ListStacks()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list stacks: %w", err)
+	}
+
+	stacks := grafana.Stacks{}
+
+	for _, stack := range stacksWithCommonDashboards {
+		if _, ok := p.config.ExclusionsMap()[stack.Slug]; !ok {
+			log.DefaultLogger.WithField("stack", stack.Slug).Println("is not excluded, adding it to the candidates")
+			stacks = append(stacks, stack)
+		} else {
+			log.DefaultLogger.WithField("stack", stack.Slug).Println("is excluded, skipping")
+		}
+	}
+
+	stacksWithCommonDashboards = stacks
+	var stacksWithCustomDashboards grafana.Stacks
+	if syncAllStacks {
+		log.DefaultLogger.Println("Syncing all stacks")
+		stacksWithCustomDashboards = grafana.Stacks{stackByName(&stacksWithCommonDashboards, p.config.CustomStack)}
+	} else {
+		log.DefaultLogger.Printf("Syncing only %s stack", p.config.TestStack)
+		testStack := stackByName(&stacksWithCommonDashboards, p.config.TestStack)
+		stacksWithCommonDashboards = grafana.Stacks{testStack}
+		stacksWithCustomDashboards = grafana.Stacks{testStack}
+	}
+
+	return stacksWithCommonDashboards, stacksWithCustomDashboards, nil
+}
+
+// uniqueStacks returns the stacks without duplicates, in order.
+func uniqueStacks(stacks grafana.Stacks) grafana.Stacks {
+	unique := grafana.Stacks{}
+	for _, stack := range stacks {
+		if stackByName(&unique, stack.Slug).Slug == "" {
+			unique = append(unique, stack)
+		}
+	}
+	return unique
+}
+
+// stackClient returns the client of a stack shared during a Publish or a
+// Cleanup, and creates it on first use. Its service account is an Admin when
+// datasources or folder permissions are configured, as editors can neither manage
+// datasources nor change the permissions of the folders they did not create,
+// and would lose their access to the folders whose permissions do not grant
+// them Edit.
+func (p Publisher) stackClient(stack *grafana.Stack) (grafana.GrafanaStackClient, error) {
+	if sc, ok := p.stackClients[stack.Slug]; ok {
+		return sc, nil
+	}
+
+	var sc grafana.GrafanaStackClient
+	var err error
+	if p.config.requiresAdmin() {
+		sc, err = p.gcc.NewStackClientWithRole(stack, grafana.RoleAdmin)
+	} else {
+		sc, err = p.gcc.NewStackClient(stack)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if p.stackClients != nil {
+		p.stackClients[stack.Slug] = sc
+	}
+	return sc, nil
+}
+
+// cleanupStackClients deletes the service accounts of the stack clients
+// created during a Publish or a Cleanup.
+func (p Publisher) cleanupStackClients() {
+	for slug, sc := range p.stackClients {
+		err := sc.Cleanup()
+		if err != nil {
+			log.DefaultLogger.WithField("stack", slug).Warnf("failed to clean up stack client: %v", err)
+		}
+	}
+}
+
 func (p Publisher) ensureParentFolder(stack *grafana.Stack) (*grafana.Folder, error) {
-	sc, err := p.gcc.NewStackClient(stack)
+	sc, err := p.stackClient(stack)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to get grafana stack client for stack %v, error: %w", stack.Slug, err)
 	}
 
-	defer sc.Cleanup()
-
-	var parentFolder *grafana.Folder
+	parentFolder, err := p.ensureRootFolder(sc)
+	if err != nil {
+		return nil, err
+	}
 
-	if p.config.RootFolder != "" {
-		for _, folder := range strings.Split(p.config.RootFolder, "/") {
-			parentFolder, err = sc.EnsureFolder(parentFolder, folder)
-			if err != nil {
-				return nil, fmt.Errorf("could not ensure root folder %s: %w", folder, err)
-			}
+	if parentFolder != nil {
+		err = enforceFolderPermissions(sc, parentFolder, p.config.RootFolderPermissions)
+		if err != nil {
+			return nil, err
 		}
 	}
 	return parentFolder, nil
 }
 
+// ensureRootFolder ensures every level of the configured root folder exists
+// and returns the innermost one, or nil when no root folder is configured.
+func (p Publisher) ensureRootFolder(sc grafana.GrafanaStackClient) (*grafana.Folder, error) {
+	if p.config.RootFolder == "" {
+		return nil, nil
+	}
+
+	parentFolder, err := sc.EnsureFolderPath(p.config.RootFolder)
+	if err != nil {
+		return nil, fmt.Errorf("could not ensure root folder %s: %w", p.config.RootFolder, err)
+	}
+	return parentFolder, nil
+}
+
 type failedStack struct {
 	stack *grafana.Stack
 	err   error
@@ -239,7 +484,9 @@ type failedStack struct {
 // syncDashboards synchronizes dashboards from a local folder to specified Grafana stacks.
 // It handles both dashboard creation/updates and deletions.
 // Returns an error if the synchronization fails.
-func (p Publisher) syncDashboards(grafanaStacks *grafana.Stacks, parentFolders map[string]*grafana.Folder, localFolder, grafanaFolder string) error {
+func (p Publisher) syncDashboards(grafanaStacks *grafana.Stacks, parentFolders map[string]*grafana.Folder, reference DashboardReference) error {
+	localFolder := reference.LocalFolder
+	grafanaFolder := reference.GrafanaFolder
 
 	stackSlugs := []string{}
 	for _, stack := range *grafanaStacks {
@@ -248,7 +495,7 @@ func (p Publisher) syncDashboards(grafanaStacks *grafana.Stacks, parentFolders m
 
 	log.DefaultLogger.WithField("stacks", stackSlugs).WithField("localFolder", localFolder).WithField("grafanaFolder", grafanaFolder).Println("Syncing dashboards...")
 
-	_, err := system.DefaultFileSystem.Stat(localFolder)
+	_, err := reference.fileSystem().Stat(localFolder)
 	if err != nil {
 		if !os.IsNotExist(err) {
 			return fmt.Errorf("Failed to discover %s: %w", localFolder, err)
@@ -265,15 +512,25 @@ func (p Publisher) syncDashboards(grafanaStacks *grafana.Stacks, parentFolders m
 	err = backoff.Retry(func() error {
 		failedStacks := grafana.Stacks{}
 		errs := []error{}
+		permanent := false
 		for _, stack := range stacksToSync {
-			err := p.syncDashboardsForStack(&stack, parentFolders[stack.Slug], localFolder, grafanaFolder)
+			err := p.syncDashboardsForStack(&stack, parentFolders[stack.Slug], reference)
 			if err != nil {
 				errs = append(errs, err)
 				failedStacks = append(failedStacks, stack)
+				// Missing dependencies and invalid dashboards will not be fixed by retrying.
+				var missingDependencies *MissingDependenciesError
+				var invalidDashboard *InvalidDashboardError
+				if errors.As(err, &missingDependencies) || errors.As(err, &invalidDashboard) {
+					permanent = true
+				}
 			}
 		}
 		if len(errs) > 0 {
 			stacksToSync = failedStacks
+			if permanent {
+				return backoff.Permanent(errors.Join(errs...))
+			}
 			return errors.Join(errs...)
 		}
 		stacksToSync = grafana.Stacks{}
@@ -298,202 +555,192 @@ func stackByName(stacks *grafana.Stacks, name string) grafana.Stack {
 	return grafana.Stack{}
 }
 
-// syncDashboardsForStack synchronizes dashboards for a single Grafana stack.
-// Handles folder creation, dashboard uploads, and dashboard deletions.
-// Returns an error if any operation fails.
-func (p Publisher) syncDashboardsForStack(stack *grafana.Stack, parentFolder *grafana.Folder, localFolder, grafanaFolder string) error {
+// InvalidDashboardError is returned when the content of a dashboard does not
+// match the structure Grafana expects.
+type InvalidDashboardError struct {
+	Path string
+	Err  error
+}
 
-	sc, err := p.gcc.NewStackClient(stack)
+func (e *InvalidDashboardError) Error() string {
+	return fmt.Sprintf("invalid dashboard %s: %v", e.Path, e.Err)
+}
 
-	if err != nil {
-		return fmt.Errorf("failed to get grafana stack client for stack %v, error: %w", stack.Slug, err)
-	}
+func (e *InvalidDashboardError) Unwrap() error {
+	return e.Err
+}
 
-	defer sc.Cleanup()
+// dashboardUID returns the UID a local dashboard is published with, which is
+// also the UID its tombstone deletes.
+func (p Publisher) dashboardUID(dash map[string]interface{}) (string, error) {
+	uid, _ := dash["uid"].(string)
+	title, _ := dash["title"].(string)
+	return p.publishedUID(uid, title)
+}
 
-	folder, err := sc.EnsureFolder(parentFolder, grafanaFolder)
+// publishedUID returns the UID a dashboard with the given local UID and title
+// is published with.
+// Dashboards without a UID get one derived from their title. When publishing
+// under a root folder the configured IDSuffix is appended, and UIDs exceeding
+// the Grafana limit of 40 characters are hashed.
+func (p Publisher) publishedUID(uid, title string) (string, error) {
+	if uid == "" {
+		if title == "" {
+			return "", errors.New("unable to find dashboard uid or title")
+		}
+		uid = GenerateUniqueID(title)
+	}
 
-	if err != nil {
-		return fmt.Errorf("could not ensure folder %s: %w", grafanaFolder, err)
+	if p.config.RootFolder != "" {
+		uid = uid + p.config.IDSuffix
+	}
+	// Grafana UID is limited to 40 characters. If the ID is too long, generate a new one.
+	if len(uid) > 40 {
+		uid = GenerateUniqueID(uid)
 	}
+	return uid, nil
+}
 
-	err = afero.Walk(system.DefaultFileSystem, localFolder, func(path string, info os.FileInfo, err error) error {
+// syncDashboardsForStack synchronizes dashboards for a single Grafana stack.
+// Handles folder creation, dashboard uploads, and dashboard deletions.
+// Returns an error if any operation fails.
+func (p Publisher) syncDashboardsForStack(stack *grafana.Stack, parentFolder *grafana.Folder, reference DashboardReference) error {
+	localFolder := reference.LocalFolder
+	grafanaFolder := reference.GrafanaFolder
 
-		if err != nil {
-			return err
-		}
+	sc, err := p.stackClient(stack)
 
-		if info == nil {
-			return errors.New("nil info handler for path: " + path)
-		}
+	if err != nil {
+		return fmt.Errorf("failed to get grafana stack client for stack %v, error: %w", stack.Slug, err)
+	}
 
-		if info.IsDir() {
-			return nil
-		}
+	uploads := []*grafana.Dashboard{}
+	// The directories of the uploads, whose folders are only ensured when
+	// the dashboards are uploaded.
+	uploadDirs := []string{}
+	tombstoneUIDs := []string{}
+
+	err = walkDashboardFiles(reference, func(path string, info os.FileInfo) error {
 
-		switch filepath.Ext(path) {
-		case ".json":
+		switch filepath.Ext(p.renderedPath(path)) {
+		case ".json", ".yaml", ".yml":
 			log.DefaultLogger.WithField("dashboard", path).WithField("destination", stack.Slug).Println("Syncing dashboard")
-			fd, err := system.DefaultFileSystem.Open(path)
+			data, err := p.readStackDashboardSource(reference.fileSystem(), path, stack)
 
 			if err != nil {
 				return err
 			}
 
-			defer fd.Close()
-
 			dashboard := map[string]interface{}{}
-			err = json.NewDecoder(fd).Decode(&dashboard)
+			err = json.Unmarshal(data, &dashboard)
 
 			if err != nil {
 				return err
 			}
 
-			if dashboard["dashboard"] == nil {
+			dash, ok := dashboard["dashboard"].(map[string]interface{})
+			if !ok {
 				return fmt.Errorf("unable to find dashboard in %s", path)
 			}
 
-			dash := dashboard["dashboard"].(map[string]interface{})
-			delete(dash, "folderId")
-			dash["folderUid"] = folder.UID
-
-			if dash["templating"] != nil {
-
-				templating := dash["templating"].(map[string]interface{})
-				parameters := templating["list"].([]interface{})
-
-				for _, param := range parameters {
-					parameter := param.(map[string]interface{})
-					if parameter["type"] == "datasource" {
-						switch parameter["name"] {
-						case "PROMPRO", "P1EUW1":
-							datasourceName := fmt.Sprintf("grafanacloud-%s-prom", stack.Slug)
-							parameter["current"] = map[string]interface{}{
-								"selected": false,
-								"text":     datasourceName,
-								"value":    datasourceName,
-							}
-						case "LOGSPRO":
-							datasourceName := fmt.Sprintf("grafanacloud-%s-logs", stack.Slug)
-							parameter["current"] = map[string]interface{}{
-								"selected": false,
-								"text":     datasourceName,
-								"value":    datasourceName,
-							}
-						case "LOGUSAGE":
-							datasourceName := fmt.Sprintf("grafanacloud-%s-usage-insights", stack.Slug)
-							parameter["current"] = map[string]interface{}{
-								"selected": false,
-								"text":     datasourceName,
-								"value":    "grafanacloud-usage-insights",
-							}
-						}
-					}
-
-					if parameter["type"] == "custom" {
-						if parameter["name"] == "STACKID" {
-							datasourceName := fmt.Sprintf("grafanacloud-%s-logs", stack.Slug)
-							datasource, err := sc.GetDataSource(datasourceName)
-							if err != nil {
-								return err
-							}
-
-							stackid := datasource.User
-
-							parameter["current"] = map[string]interface{}{
-								"selected": false,
-								"text":     stackid,
-								"value":    stackid,
-							}
-							parameter["options"] = []map[string]interface{}{
-								{
-									"selected": true,
-									"text":     stackid,
-									"value":    stackid,
-								},
-							}
-							parameter["query"] = stackid
-						}
-					}
-				}
+			err = p.resolveInputs(sc, stack, dash)
+			if err != nil {
+				return fmt.Errorf("%w in %s", err, path)
 			}
 
-			// Grafana API will return 404 if 'id' is present, use just uid.
-			delete(dash, "id")
+			model, err := grafana.DecodeDashboardModel(dash)
+			if err != nil {
+				return &InvalidDashboardError{Path: path, Err: err}
+			}
 
-			uid, ok := dash["uid"].(string)
-			if !ok {
-				title, ok := dash["title"].(string)
-				if !ok {
-					return fmt.Errorf("unable to find dashboard title in %s", path)
-				}
-				uid = GenerateUniqueID(title)
+			model.Delete("folderId")
+
+			err = p.bindStackVariables(sc, stack, model)
+			if err != nil {
+				return err
 			}
 
-			if p.config.RootFolder != "" {
-				uid = uid + p.config.IDSuffix
+			err = p.bindLibraryPanels(model)
+			if err != nil {
+				return fmt.Errorf("%w in %s", err, path)
 			}
-			// Grafana UID is limited to 40 characters. If the ID is too long, generate a new one.
-			if len(uid) > 40 {
-				uid = GenerateUniqueID(uid)
+
+			// Grafana API will return 404 if 'id' is present, use just uid.
+			model.ID = nil
+			model.Delete("id")
+
+			uid, err := p.publishedUID(model.UID, model.Title)
+			if err != nil {
+				return fmt.Errorf("%w in %s", err, path)
 			}
-			dash["uid"] = uid
+			model.UID = uid
 
 			if p.config.Tags != nil {
-				tags, ok := dash["tags"].([]interface{})
-				if !ok {
-					tags = []interface{}{}
+				if model.Tags == nil {
+					model.Tags = []string{}
 				}
-				for _, tag := range p.config.Tags {
-					tags = append(tags, tag)
+				model.Tags = append(model.Tags, p.config.Tags...)
+			}
+
+			dash, err = model.JSON()
+			if err != nil {
+				return fmt.Errorf("failed to encode dashboard %s: %w", path, err)
+			}
+
+			// Overlays apply to the dashboard as published, once datasources
+			// are rewritten.
+			dash, err = applyOverlays(reference.fileSystem(), path, stack, dash)
+			if err != nil {
+				return err
+			}
+
+			dir := "."
+			if reference.NestedFolders {
+				dir, err = filepath.Rel(localFolder, filepath.Dir(path))
+				if err != nil {
+					return err
 				}
-				dash["tags"] = tags
 			}
 
-			err = sc.UploadDashboard(&grafana.Dashboard{
-				FolderUID: folder.UID,
+			uploads = append(uploads, &grafana.Dashboard{
 				UID:       uid,
 				Dashboard: dash,
 			})
-
-			if err != nil {
-				return fmt.Errorf("failed to upload dashboard %s: %w", folder.UID, err)
-			}
+			uploadDirs = append(uploadDirs, dir)
 
 		case ".deleted":
 			log.DefaultLogger.WithField("dashboard", path).WithField("destination", stack.Slug).Println("Deleting dashboard")
-			fd, err := system.DefaultFileSystem.Open(path)
+			data, err := readDashboardSource(reference.fileSystem(), path)
 			if err != nil {
 				return err
 			}
-			defer fd.Close()
-			dashboard := map[string]interface{}{}
-			err = json.NewDecoder(fd).Decode(&dashboard)
+			dash, err := decodeTombstoneFile(path, data)
 			if err != nil {
 				return err
 			}
-			if dashboard["dashboard"] == nil {
-				return fmt.Errorf("unable to find dashboard in %s", path)
-			}
-			dash := dashboard["dashboard"].(map[string]interface{})
-			if dash["uid"] == nil {
-				return fmt.Errorf("unable to find dashboard uid in %s", path)
-			}
-			dashboardUID, ok := dash["uid"].(string)
-			if !ok {
-				return fmt.Errorf("dashboard uid %s is not a string in path %s", dashboardUID, path)
+			// Tombstones are matched with the UID the dashboard was published with.
+			dashboardUID, err := p.dashboardUID(dash)
+			if err != nil {
+				return fmt.Errorf("%w in %s", err, path)
 			}
 
-			_, err = sc.GetDashboard(dashboardUID)
-			if err == nil {
-				err = sc.DeleteDashboard(dashboardUID)
-				if err != nil {
-					return err
-				}
+			tombstoneUIDs = append(tombstoneUIDs, dashboardUID)
+
+		case overlayExtension:
+			// Overlays are applied with their dashboard.
+			_, err := reference.fileSystem().Stat(strings.TrimSuffix(path, overlayExtension))
+			if err != nil {
+				return fmt.Errorf("unable to find the dashboard of overlay %s: %w", path, err)
 			}
 
 		default:
-			return fmt.Errorf("unsupported file extension %s for path %v", filepath.Ext(path), path)
+			switch p.config.UnknownFiles {
+			case UnknownFilesIgnore:
+			case UnknownFilesWarn:
+				log.DefaultLogger.WithField("file", path).WithField("destination", stack.Slug).Warn("Skipping file with unsupported extension")
+			default:
+				return fmt.Errorf("unsupported file extension %s for path %v", filepath.Ext(path), path)
+			}
 		}
 		return nil
 	})
@@ -502,5 +749,66 @@ func (p Publisher) syncDashboardsForStack(stack *grafana.Stack, parentFolder *gr
 		return err
 	}
 
+	// Dashboards are only written once all of them are ready, so that missing
+	// dependencies are detected before the stack is modified.
+	err = p.checkDependencies(sc, stack, uploads)
+	if err != nil {
+		return err
+	}
+
+	folder, err := sc.EnsureFolder(parentFolder, grafanaFolder)
+
+	if err != nil {
+		return fmt.Errorf("could not ensure folder %s: %w", grafanaFolder, err)
+	}
+
+	err = enforceFolderPermissions(sc, folder, reference.Permissions)
+	if err != nil {
+		return err
+	}
+
+	err = p.migratePreviousFolders(sc, stack, folder, reference)
+	if err != nil {
+		return err
+	}
+
+	err = p.deleteDashboards(sc, stack, reference)
+	if err != nil {
+		return err
+	}
+
+	for _, uid := range tombstoneUIDs {
+		err = deleteDashboard(sc, uid)
+		if err != nil {
+			return err
+		}
+	}
+
+	subfolders := map[string]*grafana.Folder{".": folder}
+	for i, dashboard := range uploads {
+		folder, err := ensureSubfolder(sc, subfolders, uploadDirs[i])
+		if err != nil {
+			return err
+		}
+		dashboard.FolderUID = folder.UID
+		dashboard.Dashboard.(map[string]interface{})["folderUid"] = folder.UID
+
+		// Only used by the dependency check and when importing dashboards.
+		delete(dashboard.Dashboard.(map[string]interface{}), "__requires")
+
+		err = sc.UploadDashboard(dashboard)
+
+		if err != nil {
+			return fmt.Errorf("failed to upload dashboard %s: %w", dashboard.FolderUID, err)
+		}
+	}
+
+	if reference.NestedFolders {
+		err = pruneSubfolders(sc, folder, reference, ".")
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"testing"
+	"testing/fstest"
 
 	grafana "github.com/adevinta/go-grafana-toolkit/client"
 	system "github.com/adevinta/go-system-toolkit"
@@ -126,10 +127,7 @@ func TestPublish(t *testing.T) {
 		// - test-stack stores common only dashboards
 		// - custom-stack stores common and custom dashboards
 		testStackClient.
-			On("EnsureFolder", nilFolder, "root").
-			Return(rootFolder, nil)
-		testStackClient.
-			On("EnsureFolder", rootFolder, "folder").
+			On("EnsureFolderPath", "root/folder").
 			Return(rootSubfolder, nil)
 
 		testStackClient.
@@ -147,10 +145,7 @@ func TestPublish(t *testing.T) {
 		testStackClient.On("Cleanup").Return(nil)
 
 		customStackClient.
-			On("EnsureFolder", nilFolder, "root").
-			Return(rootFolder, nil)
-		customStackClient.
-			On("EnsureFolder", rootFolder, "folder").
+			On("EnsureFolderPath", "root/folder").
 			Return(rootSubfolder, nil)
 		customStackClient.
 			On("EnsureFolder", rootSubfolder, "Common").
@@ -244,10 +239,7 @@ func TestPublish(t *testing.T) {
 		// - nothing is stored in custom-stack
 
 		testStackClient.
-			On("EnsureFolder", nilFolder, "root").
-			Return(rootFolder, nil)
-		testStackClient.
-			On("EnsureFolder", rootFolder, "folder").
+			On("EnsureFolderPath", "root/folder").
 			Return(rootSubfolder, nil)
 		testStackClient.
 			On("EnsureFolder", rootSubfolder, "Common").
@@ -326,6 +318,7 @@ func TestDashboardsHaveDataSourceNamesAndStackIDsInjected(t *testing.T) {
 	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/dashboard1.json", `{
 		"dashboard":{
 			"uid":"dash-1",
+			"title":"Dashboard 1",
 			 "templating": {
 				"list": [
 					{"type": "datasource", "name": "PROMPRO"},
@@ -389,6 +382,7 @@ func TestDashboardsHaveDataSourceNamesAndStackIDsInjected(t *testing.T) {
 	// Verify uploaded dashboard has injected datasource names and stack IDs
 	assert.Equal(t, map[string]interface{}{
 		"uid":       "dash-1",
+		"title":     "Dashboard 1",
 		"folderUid": "common-folder-uid",
 		"templating": map[string]interface{}{
 			"list": []interface{}{
@@ -436,8 +430,8 @@ func TestDashboardsHaveDataSourceNamesAndStackIDsInjected(t *testing.T) {
 						"text":     "123456",
 						"value":    "123456",
 					},
-					"options": []map[string]interface{}{
-						{
+					"options": []interface{}{
+						map[string]interface{}{
 							"selected": true,
 							"text":     "123456",
 							"value":    "123456",
@@ -510,6 +504,140 @@ func TestDashboardsAreDeleted(t *testing.T) {
 	testStackClient.AssertExpectations(t)
 }
 
+func TestDashboardsAreDeletedWithPublishedUID(t *testing.T) {
+	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+
+	system.DefaultFileSystem = afero.NewMemMapFs()
+	defer func() { system.DefaultFileSystem = afero.NewOsFs() }()
+
+	require.NoError(t, system.DefaultFileSystem.MkdirAll("/local_folder_1", 0777))
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/dashboard1.json.deleted", `{"dashboard": {"uid": "dash-1"}}`)
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/long.json.deleted", `{"dashboard": {"uid": "a-very-long-dashboard-uid-that-gets-hashed"}}`)
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/untitled.json.deleted", `{"dashboard": {"title": "No UID"}}`)
+
+	hashedUID := GenerateUniqueID("a-very-long-dashboard-uid-that-gets-hashed-pr-1234")
+	// Title derived UIDs are 40 characters long, so suffixing hashes them again.
+	titleUID := GenerateUniqueID(GenerateUniqueID("No UID") + "-pr-1234")
+
+	cloudClient := new(MockCloudClient)
+	testStackClient := new(MockStackClient)
+
+	cloudClient.
+		On("ListStacks").
+		Return(grafana.Stacks{testStack}, nil).
+		Once()
+	cloudClient.
+		On("NewStackClient", &testStack).
+		Return(testStackClient, nil)
+
+	testStackClient.
+		On("EnsureFolderPath", "root").
+		Return(rootFolder, nil)
+	testStackClient.
+		On("EnsureFolder", rootFolder, "Common").
+		Return(commonFolder, nil)
+
+	for _, uid := range []string{"dash-1-pr-1234", hashedUID, titleUID} {
+		testStackClient.
+			On("GetDashboard", uid).
+			Return(&grafana.Dashboard{UID: uid}, nil).
+			Once()
+		testStackClient.
+			On("DeleteDashboard", uid).
+			Return(nil).
+			Once()
+	}
+
+	testStackClient.On("Cleanup").Return(nil)
+
+	pub, err := NewPublisher(
+		WithCloudClient(cloudClient),
+		WithConfig(&PublisherConfig{
+			CommonDashboards: DashboardReferences{{LocalFolder: "/local_folder_1", GrafanaFolder: "Common"}},
+			TestStack:        "test-stack",
+			RootFolder:       "root",
+			IDSuffix:         "-pr-1234",
+		}),
+	)
+	require.NoError(t, err)
+
+	err = pub.Publish(false)
+	assert.NoError(t, err)
+
+	cloudClient.AssertExpectations(t)
+	testStackClient.AssertExpectations(t)
+}
+
+func TestDashboardsAreDeletedFromConfig(t *testing.T) {
+	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+
+	system.DefaultFileSystem = afero.NewMemMapFs()
+	defer func() { system.DefaultFileSystem = afero.NewOsFs() }()
+
+	require.NoError(t, system.DefaultFileSystem.MkdirAll("/local_folder_1", 0777))
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/dashboard3.deleted", `{"uid": "dash-3"}`)
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/dashboard4.deleted", "uid: dash-4\n")
+
+	titleUID := GenerateUniqueID("Old Dashboard")
+
+	cloudClient := new(MockCloudClient)
+	testStackClient := new(MockStackClient)
+
+	cloudClient.
+		On("ListStacks").
+		Return(grafana.Stacks{testStack}, nil).
+		Once()
+	cloudClient.
+		On("NewStackClient", &testStack).
+		Return(testStackClient, nil)
+
+	testStackClient.
+		On("EnsureFolder", nilFolder, "Common").
+		Return(commonFolder, nil)
+
+	for _, uid := range []string{"dash-1", titleUID, "dash-3", "dash-4"} {
+		testStackClient.
+			On("GetDashboard", uid).
+			Return(&grafana.Dashboard{UID: uid}, nil).
+			Once()
+		testStackClient.
+			On("DeleteDashboard", uid).
+			Return(nil).
+			Once()
+	}
+	testStackClient.
+		On("GetDashboard", "already-deleted").
+		Return((*grafana.Dashboard)(nil), fmt.Errorf("not found")).
+		Once()
+
+	testStackClient.On("Cleanup").Return(nil)
+
+	pub, err := NewPublisher(
+		WithCloudClient(cloudClient),
+		WithConfig(&PublisherConfig{
+			CommonDashboards: DashboardReferences{{
+				LocalFolder:   "/local_folder_1",
+				GrafanaFolder: "Common",
+				Deleted: []DeletedDashboard{
+					{UID: "dash-1"},
+					{Title: "Old Dashboard"},
+					{UID: "already-deleted"},
+				},
+			}},
+			TestStack: "test-stack",
+		}),
+	)
+	require.NoError(t, err)
+
+	err = pub.Publish(false)
+	assert.NoError(t, err)
+
+	cloudClient.AssertExpectations(t)
+	testStackClient.AssertExpectations(t)
+}
+
 func TestPublishRetriesOncePerStack(t *testing.T) {
 	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
 	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
@@ -590,3 +718,153 @@ func TestPublishRetriesOncePerStack(t *testing.T) {
 		assert.Equal(t, "dash-1", dash["uid"], "both attempts should be for the same dashboard")
 	}
 }
+
+func TestPublishReportsMalformedDashboards(t *testing.T) {
+	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+
+	system.DefaultFileSystem = afero.NewMemMapFs()
+	defer func() { system.DefaultFileSystem = afero.NewOsFs() }()
+
+	require.NoError(t, system.DefaultFileSystem.MkdirAll("/local_folder_1", 0777))
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/malformed.json", `{
+		"dashboard": {
+			"uid": "malformed",
+			"title": "Malformed Dashboard",
+			"templating": {"list": ["PROMPRO"]}
+		}
+	}`)
+
+	cloudClient := new(MockCloudClient)
+	testStackClient := new(MockStackClient)
+
+	cloudClient.
+		On("ListStacks").
+		Return(grafana.Stacks{testStack}, nil).
+		Once()
+	cloudClient.
+		On("NewStackClient", &testStack).
+		Return(testStackClient, nil)
+
+	testStackClient.
+		On("EnsureFolder", nilFolder, "Common").
+		Return(commonFolder, nil)
+	testStackClient.On("Cleanup").Return(nil)
+
+	pub, err := NewPublisher(
+		WithCloudClient(cloudClient),
+		WithConfig(&PublisherConfig{
+			CommonDashboards: DashboardReferences{{LocalFolder: "/local_folder_1", GrafanaFolder: "Common"}},
+			TestStack:        "test-stack",
+		}),
+	)
+	require.NoError(t, err)
+
+	err = pub.Publish(true)
+	require.Error(t, err)
+	var invalid *InvalidDashboardError
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, "/local_folder_1/malformed.json", invalid.Path)
+
+	testStackClient.AssertNotCalled(t, "UploadDashboard", mock.Anything)
+}
+
+func TestPublishFromFS(t *testing.T) {
+	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+
+	// Nothing is read from the default filesystem.
+	system.DefaultFileSystem = afero.NewMemMapFs()
+	defer func() { system.DefaultFileSystem = afero.NewOsFs() }()
+
+	embedded := fstest.MapFS{
+		"publisher-config.yaml": {Data: []byte(`
+commonDashboards:
+  localFolder: dashboards
+  grafanaFolder: Common
+testStack: test-stack
+`)},
+		"dashboards/.publisherignore":  {Data: []byte("drafts/\n")},
+		"dashboards/dashboard.json":    {Data: []byte(`{"dashboard": {"uid": "dash-1", "title": "Dashboard"}}`)},
+		"dashboards/removed.deleted":   {Data: []byte(`{"uid": "dash-2"}`)},
+		"dashboards/drafts/draft.json": {Data: []byte(`not a dashboard`)},
+	}
+
+	cloudClient := new(MockCloudClient)
+	testStackClient := new(MockStackClient)
+
+	cloudClient.
+		On("ListStacks").
+		Return(grafana.Stacks{testStack}, nil).
+		Once()
+	cloudClient.
+		On("NewStackClient", &testStack).
+		Return(testStackClient, nil)
+
+	testStackClient.
+		On("EnsureFolder", nilFolder, "Common").
+		Return(commonFolder, nil)
+	testStackClient.
+		On("GetDashboard", "dash-2").
+		Return(&grafana.Dashboard{UID: "dash-2"}, nil).
+		Once()
+	testStackClient.
+		On("DeleteDashboard", "dash-2").
+		Return(nil).
+		Once()
+	var uploaded *grafana.Dashboard
+	testStackClient.
+		On("UploadDashboard", mock.AnythingOfType("*client.Dashboard")).
+		Run(func(args mock.Arguments) {
+			uploaded = args.Get(0).(*grafana.Dashboard)
+		}).
+		Return(nil).
+		Once()
+	testStackClient.On("Cleanup").Return(nil)
+
+	pub, err := NewPublisher(
+		WithCloudClient(cloudClient),
+		WithConfigFS(embedded),
+		WithLocalFolderFS("dashboards", embedded),
+	)
+	require.NoError(t, err)
+
+	err = pub.Publish(false)
+	assert.NoError(t, err)
+
+	require.NotNil(t, uploaded)
+	assert.Equal(t, "dash-1", uploaded.UID)
+	assert.Equal(t, commonFolder.UID, uploaded.FolderUID)
+
+	cloudClient.AssertExpectations(t)
+	testStackClient.AssertExpectations(t)
+}
+
+func TestWithLocalFolderFSPaths(t *testing.T) {
+	embedded := fstest.MapFS{
+		"dashboards/dashboard.json": {Data: []byte(`{"dashboard": {"uid": "dash-1", "title": "Dashboard"}}`)},
+	}
+
+	for _, localFolder := range []string{"dashboards", "./dashboards", "/dashboards", "dashboards/"} {
+		t.Run(localFolder, func(t *testing.T) {
+			pub, err := NewPublisher(
+				WithConfig(&PublisherConfig{
+					CommonDashboards: DashboardReferences{{LocalFolder: localFolder, GrafanaFolder: "Common"}},
+				}),
+				WithLocalFolderFS(localFolder, embedded),
+			)
+			require.NoError(t, err)
+
+			reference := pub.config.CommonDashboards[0]
+			assert.Equal(t, "dashboards", reference.LocalFolder)
+			_, err = reference.fileSystem().Stat(reference.LocalFolder + "/dashboard.json")
+			assert.NoError(t, err)
+		})
+	}
+
+	_, err := NewPublisher(
+		WithConfig(&PublisherConfig{}),
+		WithLocalFolderFS("../dashboards", embedded),
+	)
+	assert.Error(t, err)
+}
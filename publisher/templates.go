@@ -0,0 +1,136 @@
+package publisher
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	grafana "github.com/adevinta/go-grafana-toolkit/client"
+	"github.com/spf13/afero"
+)
+
+// PublishMode is the operation dashboard templates are rendered for.
+type PublishMode string
+
+const (
+	// PublishModeTest is used when publishing to the test stack only.
+	PublishModeTest PublishMode = "test"
+	// PublishModeAll is used when publishing to all the non-excluded stacks.
+	PublishModeAll PublishMode = "all"
+	// PublishModeExport is used when exporting dashboards from a stack.
+	PublishModeExport PublishMode = "export"
+)
+
+// allStacksVariables is the StackVariables key holding the variables shared
+// by every stack.
+const allStacksVariables = "*"
+
+// TemplateData is the data dashboard templates are rendered with.
+// The stack fields are available directly, e.g. {{ .Slug }} or {{ .StackURL }}.
+type TemplateData struct {
+	grafana.Stack
+
+	// Vars are the variables configured for the stack in StackVariables.
+	Vars map[string]interface{}
+
+	// Mode is the operation the dashboard is rendered for.
+	Mode PublishMode
+}
+
+// templateFuncs are the functions available to dashboard templates, on top
+// of the text/template builtins.
+var templateFuncs = template.FuncMap{
+	// json encodes a value, allowing to safely inject strings in JSON dashboards.
+	"json": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+}
+
+// isTemplate reports whether a local dashboard file must be rendered before
+// being decoded.
+func (p Publisher) isTemplate(path string) bool {
+	return p.config.TemplateSuffix != "" && strings.HasSuffix(path, p.config.TemplateSuffix)
+}
+
+// renderedPath returns the path of a local dashboard file without its
+// template suffix, whose extension gives the format of the rendered content.
+func (p Publisher) renderedPath(path string) string {
+	if p.isTemplate(path) {
+		return strings.TrimSuffix(path, p.config.TemplateSuffix)
+	}
+	return path
+}
+
+// templateData returns the data dashboard templates are rendered with for a
+// stack. Variables specific to the stack override the shared ones.
+func (p Publisher) templateData(stack *grafana.Stack) TemplateData {
+	vars := map[string]interface{}{}
+	for name, value := range p.config.StackVariables[allStacksVariables] {
+		vars[name] = value
+	}
+	for name, value := range p.config.StackVariables[stack.Slug] {
+		vars[name] = value
+	}
+
+	return TemplateData{
+		Stack: *stack,
+		Vars:  vars,
+		Mode:  p.mode,
+	}
+}
+
+// renderTemplate renders a dashboard template for a stack.
+// Missing variables are reported as errors rather than rendered empty.
+func (p Publisher) renderTemplate(path string, data []byte, stack *grafana.Stack) ([]byte, error) {
+	tmpl, err := template.New(path).Option("missingkey=error").Funcs(templateFuncs).Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse dashboard template: %w", err)
+	}
+
+	buf := &bytes.Buffer{}
+	err = tmpl.Execute(buf, p.templateData(stack))
+	if err != nil {
+		return nil, fmt.Errorf("failed to render dashboard template for stack %s: %w", stack.Slug, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// readStackDashboardSource reads a local dashboard file for a stack and
+// returns its content as JSON, rendering it first when it is a template.
+func (p Publisher) readStackDashboardSource(fsys afero.Fs, path string, stack *grafana.Stack) ([]byte, error) {
+	if !p.isTemplate(path) {
+		return readDashboardSource(fsys, path)
+	}
+
+	data, err := afero.ReadFile(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = p.renderTemplate(path, data, stack)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = dashboardSourceToJSON(p.renderedPath(path), data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s rendered for stack %s: %w", path, stack.Slug, err)
+	}
+
+	var content interface{}
+	err = json.Unmarshal(data, &content)
+	var syntaxError *json.SyntaxError
+	if errors.As(err, &syntaxError) {
+		line := bytes.Count(data[:syntaxError.Offset], []byte("\n")) + 1
+		return nil, fmt.Errorf("invalid JSON in %s rendered for stack %s at line %d: %w", path, stack.Slug, line, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s rendered for stack %s: %w", path, stack.Slug, err)
+	}
+
+	return data, nil
+}
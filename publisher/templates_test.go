@@ -0,0 +1,147 @@
+package publisher
+
+import (
+	"os"
+	"testing"
+
+	grafana "github.com/adevinta/go-grafana-toolkit/client"
+	system "github.com/adevinta/go-system-toolkit"
+	testutils "github.com/adevinta/go-testutils-toolkit"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadStackDashboardSource(t *testing.T) {
+	system.DefaultFileSystem = afero.NewMemMapFs()
+	defer func() { system.DefaultFileSystem = afero.NewOsFs() }()
+
+	pub, err := NewPublisher(WithConfig(&PublisherConfig{
+		TemplateSuffix: ".tmpl",
+		StackVariables: map[string]map[string]interface{}{
+			"*":          {"region": "unknown", "threshold": 80},
+			"test-stack": {"region": "eu-west-1"},
+		},
+	}))
+	require.NoError(t, err)
+	pub.mode = PublishModeAll
+
+	t.Run("renders templates with the stack fields, variables and mode", func(t *testing.T) {
+		testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/dashboard.json.tmpl", `{
+  "dashboard": {
+    "title": {{ printf "Overview (%s)" .Vars.region | json }},
+    "links": [{"url": "{{ .StackURL }}/explore"}],
+    "threshold": {{ .Vars.threshold }},
+    "editable": {{ ne .Mode "all" }}
+  }
+}`)
+
+		data, err := pub.readStackDashboardSource(system.DefaultFileSystem, "/local_folder_1/dashboard.json.tmpl", &testStack)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{
+			"dashboard": {
+				"title": "Overview (eu-west-1)",
+				"links": [{"url": "https://test-stack.grafana.net/explore"}],
+				"threshold": 80,
+				"editable": false
+			}
+		}`, string(data))
+	})
+
+	t.Run("renders YAML templates", func(t *testing.T) {
+		testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/dashboard.yaml.tmpl", "dashboard:\n  title: Overview {{ .Slug }}\n")
+
+		data, err := pub.readStackDashboardSource(system.DefaultFileSystem, "/local_folder_1/dashboard.yaml.tmpl", &testStack)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"dashboard": {"title": "Overview test-stack"}}`, string(data))
+	})
+
+	t.Run("reads other files as is", func(t *testing.T) {
+		testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/plain.json", `{"dashboard": {"title": "{{ .Slug }}"}}`)
+
+		data, err := pub.readStackDashboardSource(system.DefaultFileSystem, "/local_folder_1/plain.json", &testStack)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"dashboard": {"title": "{{ .Slug }}"}}`, string(data))
+	})
+
+	t.Run("reports parse errors with the file and line", func(t *testing.T) {
+		testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/invalid.json.tmpl", "{\n  \"dashboard\": {{ .Slug }\n}")
+
+		_, err := pub.readStackDashboardSource(system.DefaultFileSystem, "/local_folder_1/invalid.json.tmpl", &testStack)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "/local_folder_1/invalid.json.tmpl:2")
+	})
+
+	t.Run("reports missing variables with the file and line", func(t *testing.T) {
+		testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/missing.json.tmpl", "{\n  \"dashboard\": {\n    \"title\": \"{{ .Vars.missing }}\"\n  }\n}")
+
+		_, err := pub.readStackDashboardSource(system.DefaultFileSystem, "/local_folder_1/missing.json.tmpl", &testStack)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "/local_folder_1/missing.json.tmpl:3")
+		assert.Contains(t, err.Error(), "missing")
+	})
+
+	t.Run("reports invalid rendered JSON with the line", func(t *testing.T) {
+		testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/broken.json.tmpl", "{\n  \"dashboard\": {\n    \"title\": {{ .Slug }}\n  }\n}")
+
+		_, err := pub.readStackDashboardSource(system.DefaultFileSystem, "/local_folder_1/broken.json.tmpl", &testStack)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "/local_folder_1/broken.json.tmpl")
+		assert.Contains(t, err.Error(), "line 3")
+	})
+}
+
+func TestPublishRendersTemplates(t *testing.T) {
+	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+
+	system.DefaultFileSystem = afero.NewMemMapFs()
+	defer func() { system.DefaultFileSystem = afero.NewOsFs() }()
+
+	require.NoError(t, system.DefaultFileSystem.MkdirAll("/local_folder_1", 0777))
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/dashboard.json.tmpl", `{"dashboard": {"uid": "dash-1", "title": "Dashboard {{ .Vars.region }} ({{ .Mode }})"}}`)
+
+	cloudClient := new(MockCloudClient)
+	testStackClient := new(MockStackClient)
+
+	cloudClient.
+		On("ListStacks").
+		Return(grafana.Stacks{testStack}, nil).
+		Once()
+	cloudClient.
+		On("NewStackClient", &testStack).
+		Return(testStackClient, nil)
+
+	testStackClient.
+		On("EnsureFolder", nilFolder, "Common").
+		Return(commonFolder, nil)
+	testStackClient.
+		On("UploadDashboard", mock.AnythingOfType("*client.Dashboard")).
+		Run(func(args mock.Arguments) {
+			dashboard := args.Get(0).(*grafana.Dashboard)
+			assert.Equal(t, "Dashboard eu-west-1 (test)", dashboard.Dashboard.(map[string]interface{})["title"])
+		}).
+		Return(nil).
+		Once()
+	testStackClient.On("Cleanup").Return(nil)
+
+	pub, err := NewPublisher(
+		WithCloudClient(cloudClient),
+		WithConfig(&PublisherConfig{
+			CommonDashboards: DashboardReferences{{LocalFolder: "/local_folder_1", GrafanaFolder: "Common"}},
+			TestStack:        "test-stack",
+			TemplateSuffix:   ".tmpl",
+			StackVariables: map[string]map[string]interface{}{
+				"test-stack": {"region": "eu-west-1"},
+			},
+		}),
+	)
+	require.NoError(t, err)
+
+	err = pub.Publish(false)
+	assert.NoError(t, err)
+
+	cloudClient.AssertExpectations(t)
+	testStackClient.AssertExpectations(t)
+}
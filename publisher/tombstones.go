@@ -0,0 +1,73 @@
+package publisher
+
+import (
+	"encoding/json"
+	"fmt"
+
+	grafana "github.com/adevinta/go-grafana-toolkit/client"
+	log "github.com/adevinta/go-log-toolkit"
+)
+
+// tombstoneDashboard returns the dashboard a decoded tombstone deletes.
+// Tombstones are either a full copy of the dashboard file, or only hold the
+// uid, or the title, of the dashboard.
+func tombstoneDashboard(tombstone map[string]interface{}) (map[string]interface{}, bool) {
+	if dash, ok := tombstone["dashboard"].(map[string]interface{}); ok {
+		return dash, true
+	}
+	_, hasUID := tombstone["uid"]
+	_, hasTitle := tombstone["title"]
+	return tombstone, hasUID || hasTitle
+}
+
+// decodeTombstoneFile decodes the JSON content of a tombstone and returns the
+// dashboard it deletes.
+func decodeTombstoneFile(path string, data []byte) (map[string]interface{}, error) {
+	tombstone := map[string]interface{}{}
+	err := json.Unmarshal(data, &tombstone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+
+	dash, ok := tombstoneDashboard(tombstone)
+	if !ok {
+		return nil, fmt.Errorf("unable to find dashboard in %s", path)
+	}
+	return dash, nil
+}
+
+// deletedDashboardUID returns the UID a dashboard listed in the deleted
+// dashboards of a reference was published with.
+func (p Publisher) deletedDashboardUID(deleted DeletedDashboard) (string, error) {
+	uid, err := p.publishedUID(deleted.UID, deleted.Title)
+	if err != nil {
+		return "", fmt.Errorf("%w in the deleted dashboards", err)
+	}
+	return uid, nil
+}
+
+// deleteDashboards deletes the dashboards listed in the deleted dashboards
+// of a reference from a stack.
+func (p Publisher) deleteDashboards(sc grafana.GrafanaStackClient, stack *grafana.Stack, reference DashboardReference) error {
+	for _, deleted := range reference.Deleted {
+		uid, err := p.deletedDashboardUID(deleted)
+		if err != nil {
+			return err
+		}
+		log.DefaultLogger.WithField("dashboard", uid).WithField("destination", stack.Slug).Println("Deleting dashboard")
+		err = deleteDashboard(sc, uid)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteDashboard deletes a dashboard from a stack when it exists.
+func deleteDashboard(sc grafana.GrafanaStackClient, uid string) error {
+	_, err := sc.GetDashboard(uid)
+	if err != nil {
+		return nil
+	}
+	return sc.DeleteDashboard(uid)
+}
@@ -0,0 +1,86 @@
+package publisher
+
+import (
+	"fmt"
+
+	grafana "github.com/adevinta/go-grafana-toolkit/client"
+)
+
+// stackIDVariable is the name of the custom template variable the publisher
+// fills with the logs user ID of each stack.
+const stackIDVariable = "STACKID"
+
+// datasourceVariable describes a datasource template variable the publisher
+// binds to a Grafana Cloud provisioned datasource of each stack.
+type datasourceVariable struct {
+	// name is the template variable name, as used in queries ($PROMPRO).
+	name string
+	// suffix identifies the stack datasource, named grafanacloud-<slug>-<suffix>.
+	suffix string
+	// value overrides the selected value when the datasource is shared across stacks.
+	value string
+}
+
+// datasourceVariables lists the supported datasource template variables.
+// When several variables bind to the same datasource, the first one is used
+// to restore references while exporting.
+var datasourceVariables = []datasourceVariable{
+	{name: "PROMPRO", suffix: "prom"},
+	{name: "P1EUW1", suffix: "prom"},
+	{name: "LOGSPRO", suffix: "logs"},
+	{name: "LOGUSAGE", suffix: "usage-insights", value: "grafanacloud-usage-insights"},
+}
+
+func lookupDatasourceVariable(name interface{}) (datasourceVariable, bool) {
+	for _, variable := range datasourceVariables {
+		if variable.name == name {
+			return variable, true
+		}
+	}
+	return datasourceVariable{}, false
+}
+
+// datasourceName returns the name of the datasource bound to the variable in the given stack.
+func (v datasourceVariable) datasourceName(stack *grafana.Stack) string {
+	return fmt.Sprintf("grafanacloud-%s-%s", stack.Slug, v.suffix)
+}
+
+// datasourceValue returns the value selected for the variable in the given stack.
+func (v datasourceVariable) datasourceValue(stack *grafana.Stack) string {
+	if v.value != "" {
+		return v.value
+	}
+	return v.datasourceName(stack)
+}
+
+// reference returns the expression referencing the variable in a dashboard.
+func (v datasourceVariable) reference() string {
+	return "${" + v.name + "}"
+}
+
+// bindStackVariables selects, in the template variables of a dashboard, the
+// datasources and the stack ID of the stack it is published to.
+func (p Publisher) bindStackVariables(sc grafana.GrafanaStackClient, stack *grafana.Stack, dash *grafana.DashboardModel) error {
+	for _, parameter := range dash.Variables() {
+		if parameter.Type == "datasource" {
+			if variable, ok := lookupDatasourceVariable(parameter.Name); ok {
+				parameter.Current = grafana.NewVariableOption(variable.datasourceName(stack), variable.datasourceValue(stack), false)
+			}
+		}
+
+		if parameter.Type == "custom" && parameter.Name == stackIDVariable {
+			datasourceName := fmt.Sprintf("grafanacloud-%s-logs", stack.Slug)
+			datasource, err := sc.GetDataSource(datasourceName)
+			if err != nil {
+				return err
+			}
+
+			stackid := datasource.User
+
+			parameter.Current = grafana.NewVariableOption(stackid, stackid, false)
+			parameter.Options = []*grafana.VariableOption{grafana.NewVariableOption(stackid, stackid, true)}
+			parameter.Query = stackid
+		}
+	}
+	return nil
+}
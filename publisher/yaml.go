@@ -0,0 +1,184 @@
+package publisher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v3"
+)
+
+// DashboardFormat is the encoding of the dashboard files written by the
+// publisher.
+type DashboardFormat string
+
+const (
+	// DashboardFormatJSON writes dashboards as JSON. This is the default.
+	DashboardFormatJSON DashboardFormat = "json"
+	// DashboardFormatYAML writes dashboards as YAML, which is easier to review.
+	DashboardFormatYAML DashboardFormat = "yaml"
+)
+
+// extension returns the file extension of the dashboards in this format.
+func (f DashboardFormat) extension() string {
+	if f == DashboardFormatYAML {
+		return ".yaml"
+	}
+	return ".json"
+}
+
+// isYAMLFile reports whether a path has a YAML file extension.
+func isYAMLFile(path string) bool {
+	ext := filepath.Ext(path)
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// isDashboardFile reports whether a path is a dashboard source file.
+func isDashboardFile(path string) bool {
+	return filepath.Ext(path) == ".json" || isYAMLFile(path)
+}
+
+// readDashboardSource reads a local dashboard or tombstone file and returns
+// its content as JSON.
+func readDashboardSource(fsys afero.Fs, path string) ([]byte, error) {
+	data, err := afero.ReadFile(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = dashboardSourceToJSON(path, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return data, nil
+}
+
+// dashboardSourceToJSON converts the content of a local dashboard file to
+// JSON. YAML dashboards are converted, tombstones may be written in either
+// format.
+func dashboardSourceToJSON(path string, data []byte) ([]byte, error) {
+	switch {
+	case isYAMLFile(path):
+	case filepath.Ext(path) == ".deleted" && !json.Valid(data):
+	default:
+		return data, nil
+	}
+
+	converted, err := yamlToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid YAML: %w", err)
+	}
+	return converted, nil
+}
+
+// yamlToJSON converts a YAML document to JSON.
+func yamlToJSON(data []byte) ([]byte, error) {
+	document := &yaml.Node{}
+	err := yaml.Unmarshal(data, document)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := yamlNodeValue(document)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// yamlNodeValue converts a YAML node to the values encoding/json produces.
+// Timestamps are kept as strings and mapping keys are always strings, so that
+// the conversion does not alter the dashboard content.
+func yamlNodeValue(node *yaml.Node) (interface{}, error) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+		return yamlNodeValue(node.Content[0])
+	case yaml.AliasNode:
+		return yamlNodeValue(node.Alias)
+	case yaml.MappingNode:
+		value := map[string]interface{}{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			item, err := yamlNodeValue(node.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			value[node.Content[i].Value] = item
+		}
+		return value, nil
+	case yaml.SequenceNode:
+		value := []interface{}{}
+		for _, child := range node.Content {
+			item, err := yamlNodeValue(child)
+			if err != nil {
+				return nil, err
+			}
+			value = append(value, item)
+		}
+		return value, nil
+	}
+
+	if node.ShortTag() == "!!timestamp" {
+		return node.Value, nil
+	}
+
+	var value interface{}
+	err := node.Decode(&value)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	return value, nil
+}
+
+// encodeYAML encodes a value with sorted keys and a two spaces indentation.
+// Multi-line strings, such as queries, are written as literal blocks.
+func encodeYAML(value interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	encoder := yaml.NewEncoder(buf)
+	encoder.SetIndent(2)
+	err := encoder.Encode(yamlValue(value))
+	if err != nil {
+		return nil, err
+	}
+	err = encoder.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// yamlValue converts the numbers decoded as json.Number, which YAML would
+// encode as strings.
+func yamlValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = yamlValue(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = yamlValue(item)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+	}
+	return value
+}
+
+// encodeDashboardFile encodes the content of a dashboard file in the format
+// matching its extension.
+func encodeDashboardFile(path string, value interface{}) ([]byte, error) {
+	if isYAMLFile(path) {
+		return encodeYAML(value)
+	}
+	return encodeJSON(value)
+}
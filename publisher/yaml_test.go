@@ -0,0 +1,252 @@
+package publisher
+
+import (
+	"os"
+	"testing"
+
+	grafana "github.com/adevinta/go-grafana-toolkit/client"
+	system "github.com/adevinta/go-system-toolkit"
+	testutils "github.com/adevinta/go-testutils-toolkit"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestYAMLToJSON(t *testing.T) {
+	t.Run("keeps the dashboard content unchanged", func(t *testing.T) {
+		data, err := yamlToJSON([]byte(`
+dashboard:
+  uid: dash-1
+  time:
+    from: 2024-01-01
+  schemaVersion: 39
+  graphTooltip: 0.5
+  editable: true
+  description: null
+  panels:
+  - &panel
+    id: 1
+    targets:
+    - expr: |
+        sum(rate(requests_total[5m]))
+  - *panel
+`))
+		require.NoError(t, err)
+		assert.JSONEq(t, `{
+			"dashboard": {
+				"uid": "dash-1",
+				"time": {"from": "2024-01-01"},
+				"schemaVersion": 39,
+				"graphTooltip": 0.5,
+				"editable": true,
+				"description": null,
+				"panels": [
+					{"id": 1, "targets": [{"expr": "sum(rate(requests_total[5m]))\n"}]},
+					{"id": 1, "targets": [{"expr": "sum(rate(requests_total[5m]))\n"}]}
+				]
+			}
+		}`, string(data))
+	})
+
+	t.Run("fails on invalid documents", func(t *testing.T) {
+		_, err := yamlToJSON([]byte("dashboard: [uid"))
+		assert.Error(t, err)
+	})
+}
+
+func TestFormatDashboardYAMLFile(t *testing.T) {
+	formatted, err := FormatDashboardYAMLFile([]byte(`{"dashboard": {"version": 3, "title": "Dashboard", "uid": "dash-1", "schemaVersion": 39, "panels": [{"id": 4, "targets": [{"expr": "sum(\n  up\n)"}]}]}}`))
+	require.NoError(t, err)
+	assert.Equal(t, `dashboard:
+  panels:
+    - id: 4
+      targets:
+        - expr: |-
+            sum(
+              up
+            )
+  schemaVersion: 39
+  title: Dashboard
+  uid: dash-1
+`, string(formatted))
+}
+
+func TestNormaliseConvertsToConfiguredFormat(t *testing.T) {
+	system.DefaultFileSystem = afero.NewMemMapFs()
+	defer func() { system.DefaultFileSystem = afero.NewOsFs() }()
+
+	require.NoError(t, system.DefaultFileSystem.MkdirAll("/local_folder_1", 0777))
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/dashboard.json", `{"dashboard": {"uid": "dash-1", "version": 2}}`)
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/formatted.yaml", "dashboard:\n  uid: dash-2\n")
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/removed.json.deleted", `{"dashboard": {"uid": "dash-3"}}`)
+
+	pub, err := NewPublisher(WithConfig(&PublisherConfig{
+		CommonDashboards: DashboardReferences{{LocalFolder: "/local_folder_1", GrafanaFolder: "Common"}},
+		DashboardFormat:  DashboardFormatYAML,
+	}))
+	require.NoError(t, err)
+
+	unformatted, err := pub.Normalise(true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/local_folder_1/dashboard.json"}, unformatted)
+
+	_, err = system.DefaultFileSystem.Stat("/local_folder_1/dashboard.json")
+	assert.True(t, os.IsNotExist(err), "converted dashboards should be removed")
+
+	data, err := afero.ReadFile(system.DefaultFileSystem, "/local_folder_1/dashboard.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "dashboard:\n  uid: dash-1\n", string(data))
+
+	data, err = afero.ReadFile(system.DefaultFileSystem, "/local_folder_1/removed.json.deleted")
+	require.NoError(t, err)
+	assert.Equal(t, `{"dashboard": {"uid": "dash-3"}}`, string(data), "tombstones should be left untouched")
+
+	unformatted, err = pub.Normalise(false)
+	require.NoError(t, err)
+	assert.Empty(t, unformatted)
+}
+
+func TestPublishYAMLDashboards(t *testing.T) {
+	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+
+	system.DefaultFileSystem = afero.NewMemMapFs()
+	defer func() { system.DefaultFileSystem = afero.NewOsFs() }()
+
+	require.NoError(t, system.DefaultFileSystem.MkdirAll("/local_folder_1", 0777))
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/dashboard.yaml", `
+dashboard:
+  uid: dash-1
+  title: Dashboard 1
+  templating:
+    list:
+    - name: PROMPRO
+      type: datasource
+`)
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/removed.yml.deleted", "dashboard:\n  uid: dash-2\n")
+
+	cloudClient := new(MockCloudClient)
+	testStackClient := new(MockStackClient)
+
+	cloudClient.
+		On("ListStacks").
+		Return(grafana.Stacks{testStack}, nil).
+		Once()
+	cloudClient.
+		On("NewStackClient", &testStack).
+		Return(testStackClient, nil)
+
+	testStackClient.
+		On("EnsureFolder", nilFolder, "Common").
+		Return(commonFolder, nil)
+	testStackClient.
+		On("UploadDashboard", mock.AnythingOfType("*client.Dashboard")).
+		Run(func(args mock.Arguments) {
+			dashboard := args.Get(0).(*grafana.Dashboard)
+			assert.Equal(t, "dash-1", dashboard.UID)
+			assert.Equal(t, map[string]interface{}{
+				"uid":       "dash-1",
+				"title":     "Dashboard 1",
+				"folderUid": "common-folder-uid",
+				"templating": map[string]interface{}{
+					"list": []interface{}{
+						map[string]interface{}{
+							"name": "PROMPRO",
+							"type": "datasource",
+							"current": map[string]interface{}{
+								"selected": false,
+								"text":     "grafanacloud-test-stack-prom",
+								"value":    "grafanacloud-test-stack-prom",
+							},
+						},
+					},
+				},
+			}, dashboard.Dashboard)
+		}).
+		Return(nil).
+		Once()
+	testStackClient.
+		On("GetDashboard", "dash-2").
+		Return(&grafana.Dashboard{UID: "dash-2"}, nil).
+		Once()
+	testStackClient.
+		On("DeleteDashboard", "dash-2").
+		Return(nil).
+		Once()
+	testStackClient.On("Cleanup").Return(nil)
+
+	pub, err := NewPublisher(
+		WithCloudClient(cloudClient),
+		WithConfig(&PublisherConfig{
+			CommonDashboards: DashboardReferences{{LocalFolder: "/local_folder_1", GrafanaFolder: "Common"}},
+			TestStack:        "test-stack",
+		}),
+	)
+	require.NoError(t, err)
+
+	err = pub.Publish(true)
+	assert.NoError(t, err)
+
+	cloudClient.AssertExpectations(t)
+	testStackClient.AssertExpectations(t)
+}
+
+func TestExportYAMLDashboards(t *testing.T) {
+	os.Setenv("GRAFANA_CLOUD_TOKEN", "fake-token")
+	defer os.Unsetenv("GRAFANA_CLOUD_TOKEN")
+
+	system.DefaultFileSystem = afero.NewMemMapFs()
+	defer func() { system.DefaultFileSystem = afero.NewOsFs() }()
+
+	require.NoError(t, system.DefaultFileSystem.MkdirAll("/local_folder_1", 0777))
+	testutils.EnsureFileContent(t, system.DefaultFileSystem, "/local_folder_1/existing.json", `{"dashboard": {"uid": "existing", "title": "Existing"}}`)
+
+	pub, err := NewPublisher(
+		WithConfig(&PublisherConfig{
+			CommonDashboards: DashboardReferences{{LocalFolder: "/local_folder_1", GrafanaFolder: "Common"}},
+			DashboardFormat:  DashboardFormatYAML,
+		}),
+	)
+	require.NoError(t, err)
+
+	cloudClient := new(MockCloudClient)
+	testStackClient := new(MockStackClient)
+	pub.gcc = cloudClient
+
+	cloudClient.
+		On("GetStack", "test-stack").
+		Return(&testStack, nil)
+	cloudClient.
+		On("NewStackClient", &testStack).
+		Return(testStackClient, nil)
+
+	testStackClient.
+		On("GetFolder", nilFolder, "Common").
+		Return(commonFolder, nil)
+	testStackClient.
+		On("ListDashboardIDsInFolder", "common-folder-uid").
+		Return([]string{"existing", "new"}, nil)
+	testStackClient.
+		On("GetDashboard", "existing").
+		Return(&grafana.Dashboard{UID: "existing", Dashboard: map[string]interface{}{"uid": "existing", "title": "Existing", "version": 3}}, nil)
+	testStackClient.
+		On("GetDashboard", "new").
+		Return(&grafana.Dashboard{UID: "new", Dashboard: map[string]interface{}{"uid": "new", "title": "New", "version": 1}}, nil)
+	testStackClient.On("Cleanup").Return(nil)
+
+	err = pub.Export("test-stack")
+	require.NoError(t, err)
+
+	cloudClient.AssertExpectations(t)
+	testStackClient.AssertExpectations(t)
+
+	assertDashboardFile(t, "/local_folder_1/existing.json", map[string]interface{}{
+		"uid":   "existing",
+		"title": "Existing",
+	})
+
+	data, err := afero.ReadFile(system.DefaultFileSystem, "/local_folder_1/new.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "dashboard:\n  title: New\n  uid: new\n", string(data))
+}